@@ -0,0 +1,19 @@
+data "nix_build_plan" "this" {
+  installable = "${path.module}#nixosConfigurations.awesomeHost.config.formats.amazon"
+}
+
+output "download_size" {
+  value = data.nix_build_plan.this.download_size
+}
+
+# refuse to build more than a few derivations locally
+data "nix_build_plan" "checked" {
+  installable = "${path.module}#packages.x86_64-linux.app"
+
+  lifecycle {
+    postcondition {
+      condition     = length(self.derivations) <= 3
+      error_message = "the app dependencies must be fetched from the binary cache"
+    }
+  }
+}
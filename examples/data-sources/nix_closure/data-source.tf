@@ -0,0 +1,18 @@
+resource "nix_store_path" "awesome_host" {
+  installable = provider::nix::flake_nixos_configuration(path.module, "awesomeHost", "system.build.toplevel").installable
+}
+
+data "nix_closure" "awesome_host" {
+  installable = nix_store_path.awesome_host.output_path
+
+  lifecycle {
+    postcondition {
+      condition     = self.closure_size < 4 * 1024 * 1024 * 1024
+      error_message = "awesomeHost system closure must be smaller than 4GiB."
+    }
+  }
+}
+
+output "awesome_host_manifest" {
+  value = [for p in data.nix_closure.awesome_host.paths : "${p.path} ${p.nar_hash} ${p.nar_size}"]
+}
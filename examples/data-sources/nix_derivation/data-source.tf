@@ -1,3 +1,26 @@
 data "nix_derivation" "this" {
   installable = "${path.module}#nixosConfigurations.awesomeHost.config.formats.amazon"
 }
+
+data "nix_derivation" "fork" {
+  installable = "${path.module}#nixosConfigurations.awesomeHost.config.formats.amazon"
+  override_inputs = {
+    nixpkgs = "github:my-org/nixpkgs/${var.nixpkgs_branch}"
+  }
+}
+
+output "fork_nixpkgs_revision" {
+  value = data.nix_derivation.fork.override_revisions["nixpkgs"]
+}
+
+# refuse derivations fetching from the network
+data "nix_derivation" "checked" {
+  installable = "${path.module}#packages.x86_64-linux.app"
+
+  lifecycle {
+    postcondition {
+      condition     = !self.impure_derivation && !contains(keys(self.env), "__noChroot")
+      error_message = "the app derivation must be built in the sandbox"
+    }
+  }
+}
@@ -2,3 +2,12 @@ data "nix_eval" "this" {
   installable = provider::nix::flake_nixos_configuration(path.module, "awesomeHost", "services.openssh.ports").installable
   apply       = "builtins.head"
 }
+
+data "nix_eval" "firewall" {
+  installable = provider::nix::flake_nixos_configuration(path.module, "awesomeHost", "networking.firewall").installable
+  apply       = "firewall: { inherit (firewall) enable allowedTCPPorts; }"
+}
+
+output "awesome_host_open_ports" {
+  value = data.nix_eval.firewall.value.enable ? data.nix_eval.firewall.value.allowedTCPPorts : []
+}
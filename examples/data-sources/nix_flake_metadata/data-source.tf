@@ -0,0 +1,12 @@
+data "nix_flake_metadata" "infra" {
+  flake = path.module
+}
+
+locals {
+  deployment_tags = {
+    flake_revision   = data.nix_flake_metadata.infra.revision
+    flake_nar_hash   = data.nix_flake_metadata.infra.nar_hash
+    nixpkgs_revision = data.nix_flake_metadata.infra.inputs["nixpkgs"].revision
+    nixpkgs_date     = data.nix_flake_metadata.infra.inputs["nixpkgs"].last_modified
+  }
+}
@@ -0,0 +1,18 @@
+data "nix_flake_outputs" "infra" {
+  flake = path.module
+}
+
+resource "nix_store_path" "hosts" {
+  for_each = toset(data.nix_flake_outputs.infra.nixos_configurations)
+
+  installable = provider::nix::flake_nixos_configuration(path.module, each.key, "system.build.toplevel").installable
+}
+
+resource "nix_store_path" "packages" {
+  for_each = {
+    for attr_path, output in data.nix_flake_outputs.infra.outputs : output.name => output
+    if output.category == "packages" && output.system == "x86_64-linux"
+  }
+
+  installable = each.value.installable
+}
@@ -0,0 +1,20 @@
+resource "nix_store_path" "awesome_host_vhd" {
+  installable = provider::nix::flake_nixos_configuration(path.module, "awesomeHost", "formats.amazon").installable
+}
+
+data "nix_path_info" "awesome_host_vhd" {
+  installable = nix_store_path.awesome_host_vhd.output_path
+}
+
+data "nix_path_info" "cached" {
+  installable = nix_store_path.awesome_host_vhd.output_path
+  store       = "https://cache.example.com"
+}
+
+output "awesome_host_vhd" {
+  value = {
+    nar_hash     = data.nix_path_info.awesome_host_vhd.nar_hash
+    closure_size = data.nix_path_info.awesome_host_vhd.closure_size
+    cached       = data.nix_path_info.cached.valid
+  }
+}
@@ -0,0 +1,20 @@
+provider "nix" {
+  nix_binary            = "/run/current-system/sw/bin/nix"
+  experimental_features = ["nix-command", "flakes"]
+  extra_options = {
+    "max-jobs" = "4"
+  }
+  extra_env = {
+    NIX_SSHOPTS = "-o StrictHostKeyChecking=accept-new"
+  }
+  gc_root_dir    = "${path.root}/.gcroots"
+  backend        = "daemon"
+  daemon_socket  = "/nix/var/nix/daemon-socket/socket"
+  lock_file_mode = "readonly"
+  builders = [{
+    uri      = "ssh-ng://builder@aarch64.example.com"
+    systems  = ["aarch64-linux"]
+    ssh_key  = "/etc/nix/builder_ed25519"
+    max_jobs = 8
+  }]
+}
@@ -0,0 +1,14 @@
+# update nixpkgs every week, the new revision shows in the plan
+resource "nix_flake_lock" "this" {
+  flake         = path.module
+  update_inputs = ["nixpkgs"]
+  triggers = {
+    week = formatdate("YYYY-'W'ww", timestamp())
+  }
+}
+
+# build with the lock file written by nix_flake_lock
+resource "nix_store_path" "awesome_host" {
+  installable = "${path.module}#nixosConfigurations.awesomeHost.config.formats.amazon"
+  depends_on  = [nix_flake_lock.this]
+}
@@ -1,3 +1,60 @@
 resource "nix_store_path" "this" {
   installable = "${path.module}#nixosConfigurations.awesomeHost.config.formats.amazon"
 }
+
+resource "nix_store_path" "openssl" {
+  installable  = "nixpkgs#openssl"
+  output_names = ["dev", "out"]
+}
+
+resource "nix_store_path" "image" {
+  expr        = "import ${path.module}/image.nix"
+  installable = "config.system.build.image"
+  impure      = true
+  args = {
+    network = {
+      address = aws_eip.this.public_ip
+      dns     = ["1.1.1.1", "9.9.9.9"]
+    }
+    disk_size_gb = var.disk_size_gb
+  }
+  argstrs = {
+    instance_type = var.instance_type
+  }
+}
+
+resource "nix_store_path" "release" {
+  installable = "${path.module}#packages.x86_64-linux.app"
+  impure      = true
+  eval_env = {
+    APP_VERSION = var.app_version
+  }
+}
+
+# image builds are heavy, limit them without changing nix.conf
+resource "nix_store_path" "heavy_image" {
+  installable = "${path.module}#nixosConfigurations.awesomeHost.config.formats.amazon"
+
+  build_options {
+    max_jobs        = 2
+    cores           = 4
+    fallback        = true
+    timeout         = 7200
+    max_silent_time = 1800
+  }
+}
+
+# build on a remote aarch64 machine from an x86_64 laptop
+resource "nix_store_path" "arm_image" {
+  installable = "${path.module}#nixosConfigurations.awesomeHost.config.formats.amazon"
+
+  build_options {
+    system = "aarch64-linux"
+    builders = [{
+      uri                = "ssh-ng://builder@aarch64.example.com"
+      systems            = ["aarch64-linux"]
+      ssh_key            = var.builder_ssh_key_path
+      supported_features = ["big-parallel"]
+    }]
+  }
+}
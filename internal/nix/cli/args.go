@@ -0,0 +1,300 @@
+package nixcli
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"golang.org/x/exp/maps"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+func evaluateArgs(ctx context.Context, req nix.EvaluateRequest) []string {
+	args := append([]string{"--json"}, evaluationArgs(ctx, req.Installable, req.EvaluationOptions)...)
+	if req.Apply != nil {
+		args = append(args, "--apply", applyArg(ctx, *req.Apply))
+	}
+	return args
+}
+
+// evaluationArgs returns the arguments evaluating the installable with the provided options.
+// When evaluating an expression, the installable is an attribute path that is omitted if empty.
+func evaluationArgs(ctx context.Context, installable string, options nix.EvaluationOptions) []string {
+	var args []string
+
+	for _, name := range sortedKeys(options.Args) {
+		args = append(args, "--arg", name, options.Args[name])
+	}
+	for _, name := range sortedKeys(options.ArgStrs) {
+		args = append(args, "--argstr", name, options.ArgStrs[name])
+	}
+
+	if options.Impure {
+		args = append(args, "--impure")
+	}
+	if options.PureEval != nil {
+		args = append(args, "--option", "pure-eval", strconv.FormatBool(*options.PureEval))
+	}
+	if options.AllowedURIs != nil {
+		args = append(args, "--option", "allowed-uris", strings.Join(options.AllowedURIs, " "))
+	}
+
+	args = append(args, flakeInputsArgs(options)...)
+
+	if options.Expression != "" {
+		args = append(args, "--expr", options.Expression)
+		if installable == "" {
+			return args
+		}
+	}
+
+	return append(args, installableArg(ctx, installable))
+}
+
+// flakeInputsArgs returns the arguments changing the inputs of evaluated flakes.
+func flakeInputsArgs(options nix.EvaluationOptions) []string {
+	var args []string
+	for _, name := range sortedKeys(options.OverrideInputs) {
+		args = append(args, "--override-input", name, options.OverrideInputs[name])
+	}
+	if options.InputsFrom != "" {
+		args = append(args, "--inputs-from", options.InputsFrom)
+	}
+	return args
+}
+
+// evaluationEnv returns the environment variables to set while evaluating with the provided options.
+func evaluationEnv(options nix.EvaluationOptions) []string {
+	env := make([]string, 0, len(options.Env))
+	for _, name := range sortedKeys(options.Env) {
+		env = append(env, name+"="+options.Env[name])
+	}
+	return env
+}
+
+// inheritedEnv returns the variables of environ commands inherit: all of them if inherit is nil,
+// otherwise the listed ones along with the variables nix needs to run (PATH, HOME and NIX_* variables).
+func inheritedEnv(environ, inherit []string) []string {
+	if inherit == nil {
+		return environ
+	}
+
+	// the returned slice is never nil, as commands with a nil environment inherit the whole environment
+	env := make([]string, 0, len(inherit)+2)
+	for _, variable := range environ {
+		name, _, _ := strings.Cut(variable, "=")
+		if name == "PATH" || name == "HOME" || strings.HasPrefix(name, "NIX_") || slices.Contains(inherit, name) {
+			env = append(env, variable)
+		}
+	}
+	return env
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := maps.Keys(m)
+	slices.Sort(keys)
+	return keys
+}
+
+// buildArgs returns the arguments building the request installable with the request options.
+func buildArgs(ctx context.Context, req nix.BuildRequest) []string {
+	args := []string{"--no-link", "--json"}
+
+	for _, option := range []struct {
+		name  string
+		value *int64
+	}{
+		{"max-jobs", req.Options.MaxJobs},
+		{"cores", req.Options.Cores},
+		{"timeout", req.Options.Timeout},
+		{"max-silent-time", req.Options.MaxSilentTime},
+	} {
+		if option.value != nil {
+			args = append(args, "--option", option.name, strconv.FormatInt(*option.value, 10))
+		}
+	}
+
+	for _, option := range []struct {
+		name  string
+		value *bool
+	}{
+		{"keep-going", req.Options.KeepGoing},
+		{"fallback", req.Options.Fallback},
+		{"sandbox", req.Options.Sandbox},
+		{"substitute", req.Options.Substitute},
+	} {
+		if option.value != nil {
+			args = append(args, "--option", option.name, strconv.FormatBool(*option.value))
+		}
+	}
+
+	return append(args, evaluationArgs(ctx, req.Installable, req.EvaluationOptions)...)
+}
+
+// buildersArg returns the builders as machine specifications, in the format of the builders nix setting.
+// Unset fields are replaced by a dash for nix to use its defaults.
+func buildersArg(builders []nix.Builder) string {
+	orDefault := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+
+	specs := make([]string, 0, len(builders))
+	for _, builder := range builders {
+		var maxJobs, speedFactor string
+		if builder.MaxJobs > 0 {
+			maxJobs = strconv.FormatInt(builder.MaxJobs, 10)
+		}
+		if builder.SpeedFactor > 0 {
+			speedFactor = strconv.FormatInt(builder.SpeedFactor, 10)
+		}
+
+		specs = append(specs, strings.Join([]string{
+			builder.URI,
+			orDefault(strings.Join(builder.Systems, ",")),
+			orDefault(builder.SSHKey),
+			orDefault(maxJobs),
+			orDefault(speedFactor),
+			orDefault(strings.Join(builder.SupportedFeatures, ",")),
+			orDefault(strings.Join(builder.MandatoryFeatures, ",")),
+			orDefault(builder.PublicHostKey),
+		}, " "))
+	}
+
+	return strings.Join(specs, " ; ")
+}
+
+func copyArgs(ctx context.Context, req nix.CopyRequest) []string {
+	var args []string
+	if req.From != nil {
+		args = append(args, "--from", *req.From)
+	}
+	if req.To != nil {
+		args = append(args, "--to", *req.To)
+	}
+	if req.CheckSignature != nil && !*req.CheckSignature {
+		args = append(args, "--no-check-sigs")
+	}
+	if req.SubstituteOnDestination != nil && *req.SubstituteOnDestination {
+		args = append(args, "--substitute-on-destination")
+	}
+	return append(args, installableArg(ctx, req.Installable))
+}
+
+func remoteStorePathArgs(ctx context.Context, req nix.RemoteStorePathRequest, recursive bool) []string {
+	args := []string{"--json"}
+	if req.Store != "" {
+		args = append(args, "--store", req.Store)
+	}
+	if recursive {
+		args = append(args, "--recursive")
+	}
+	return append(args, installableArg(ctx, req.Installable))
+}
+
+func sshOptionsEnv(sshOptions []string) []string {
+	if len(sshOptions) == 0 {
+		return nil
+	}
+	return []string{"NIX_SSHOPTS=" + strings.Join(sshOptions, " ")}
+}
+
+// isStorePathInstallable returns whether the installable designates store paths (like /nix/store/...-hello or /nix/store/...-hello.drv^out),
+// which are not evaluated, unlike flake installables.
+func isStorePathInstallable(installable string) bool {
+	return strings.HasPrefix(installable, "/nix/store/") && !strings.Contains(installable, "#")
+}
+
+// installableArg returns the installable as a single command argument.
+//
+// Installables used to be given to a shell, so some of them were shell quoted
+// (like .#'nixosConfigurations."host".config.system') to keep nix attribute quoting intact.
+// Such installables are unquoted the way the shell would have done it, so they keep evaluating to the same thing.
+// Only attribute paths fully quoted after the # are considered shell quoted, as single quotes are valid in attribute names.
+func installableArg(ctx context.Context, installable string) string {
+	_, attrPath, found := strings.Cut(installable, "#")
+	if !found || len(attrPath) < 2 || !strings.HasPrefix(attrPath, "'") || !strings.HasSuffix(attrPath, "'") {
+		return installable
+	}
+	return unquoteLegacyArg(ctx, "installable", installable)
+}
+
+// applyArg returns the function to apply as a single command argument.
+// Nix expressions may contain indented strings (delimited by two single quotes), so only fully quoted functions are considered shell quoted.
+func applyArg(ctx context.Context, apply string) string {
+	if len(apply) < 2 || !strings.HasPrefix(apply, "'") || !strings.HasSuffix(apply, "'") {
+		return apply
+	}
+	return unquoteLegacyArg(ctx, "apply", apply)
+}
+
+// unquoteLegacyArg unquotes arg if it is a single shell word, otherwise arg is returned as is.
+func unquoteLegacyArg(ctx context.Context, name, arg string) string {
+	unquoted, ok := shellUnquote(arg)
+	if !ok {
+		return arg
+	}
+
+	tflog.Warn(ctx, "shell quoted arguments are deprecated, quotes should be removed", map[string]any{
+		"argument": name,
+		"value":    arg,
+		"unquoted": unquoted,
+	})
+
+	return unquoted
+}
+
+// shellUnquote parses s as a single POSIX shell word, and returns it without its quotes.
+// It returns false if s is not exactly one word, or if its quotes are unbalanced.
+func shellUnquote(s string) (string, bool) {
+	var (
+		word           strings.Builder
+		inSingleQuotes bool
+		inDoubleQuotes bool
+		escaped        bool
+	)
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			if inDoubleQuotes && !strings.ContainsRune(`$`+"`"+`"\`, r) {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escaped = false
+		case inSingleQuotes:
+			if r == '\'' {
+				inSingleQuotes = false
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+		case inDoubleQuotes:
+			if r == '"' {
+				inDoubleQuotes = false
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'':
+			inSingleQuotes = true
+		case r == '"':
+			inDoubleQuotes = true
+		case r == ' ' || r == '\t' || r == '\n':
+			return "", false
+		default:
+			word.WriteRune(r)
+		}
+	}
+
+	if inSingleQuotes || inDoubleQuotes || escaped {
+		return "", false
+	}
+
+	return word.String(), true
+}
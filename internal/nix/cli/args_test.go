@@ -0,0 +1,100 @@
+package nixcli
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+func Test_installableArg(t *testing.T) {
+	for name, test := range map[string]struct {
+		installable string
+		expected    string
+	}{
+		"unquoted":                            {installable: ".#hello", expected: ".#hello"},
+		"store path":                          {installable: "/nix/store/aaa-hello", expected: "/nix/store/aaa-hello"},
+		"legacy quoted attribute path":        {installable: `.#'nixosConfigurations."host".config.system'`, expected: `.#nixosConfigurations."host".config.system`},
+		"single quote in an attribute name":   {installable: `.#nixosConfigurations."it's".config.x`, expected: `.#nixosConfigurations."it's".config.x`},
+		"quoted attribute name":               {installable: `.#nixosConfigurations.'host'.config.x`, expected: `.#nixosConfigurations.'host'.config.x`},
+		"quote not ending the attribute path": {installable: `.#'hello'.name`, expected: `.#'hello'.name`},
+		"unbalanced legacy quotes":            {installable: `.#'it's'`, expected: `.#'it's'`},
+		"no attribute path":                   {installable: `'.'`, expected: `'.'`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, installableArg(context.Background(), test.installable), test.expected)
+		})
+	}
+}
+
+func Test_shellUnquote(t *testing.T) {
+	for name, test := range map[string]struct {
+		s        string
+		expected string
+		ok       bool
+	}{
+		"unquoted word":                     {s: "hello", expected: "hello", ok: true},
+		"single quotes":                     {s: `'a "b" c'`, expected: `a "b" c`, ok: true},
+		"double quotes":                     {s: `"a 'b' c"`, expected: `a 'b' c`, ok: true},
+		"escaped characters":                {s: `a\ b\'c`, expected: `a b'c`, ok: true},
+		"escapes in double quotes":          {s: `"a\"b\\c\d"`, expected: `a"b\c\d`, ok: true},
+		"escapes in single quotes":          {s: `'a\b'`, expected: `a\b`, ok: true},
+		"concatenated quotes":               {s: `.#'a'"b"c`, expected: ".#abc", ok: true},
+		"empty quotes":                      {s: `''`, expected: "", ok: true},
+		"multiple words":                    {s: "a b", ok: false},
+		"unbalanced single quote":           {s: "it's", ok: false},
+		"unbalanced double quote":           {s: `"a`, ok: false},
+		"trailing escape":                   {s: `a\`, ok: false},
+		"quoted words separated by a space": {s: `'a' 'b'`, ok: false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			unquoted, ok := shellUnquote(test.s)
+			assert.Equal(t, ok, test.ok)
+			if test.ok {
+				assert.Equal(t, unquoted, test.expected)
+			}
+		})
+	}
+}
+
+func Test_buildersArg(t *testing.T) {
+	for name, test := range map[string]struct {
+		builders []nix.Builder
+		expected string
+	}{
+		"no builders": {
+			builders: []nix.Builder{},
+			expected: "",
+		},
+		"defaults": {
+			builders: []nix.Builder{{URI: "ssh://builder"}},
+			expected: "ssh://builder - - - - - - -",
+		},
+		"every field": {
+			builders: []nix.Builder{{
+				URI:               "ssh-ng://builder",
+				Systems:           []string{"x86_64-linux", "i686-linux"},
+				SSHKey:            "/etc/nix/builder_key",
+				MaxJobs:           8,
+				SpeedFactor:       2,
+				SupportedFeatures: []string{"kvm", "big-parallel"},
+				MandatoryFeatures: []string{"kvm"},
+				PublicHostKey:     "c3NoLWVkMjU1MTk=",
+			}},
+			expected: "ssh-ng://builder x86_64-linux,i686-linux /etc/nix/builder_key 8 2 kvm,big-parallel kvm c3NoLWVkMjU1MTk=",
+		},
+		"multiple builders": {
+			builders: []nix.Builder{
+				{URI: "ssh://x86", Systems: []string{"x86_64-linux"}},
+				{URI: "ssh://arm", Systems: []string{"aarch64-linux"}, MaxJobs: 4},
+			},
+			expected: "ssh://x86 x86_64-linux - - - - - - ; ssh://arm aarch64-linux - 4 - - - -",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, buildersArg(test.builders), test.expected)
+		})
+	}
+}
@@ -2,53 +2,220 @@ package nixcli
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
 
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"golang.org/x/exp/maps"
+
 	"github.com/krostar/terraform-provider-nix/internal/nix"
 )
 
-type cli struct{}
+// Config defines how the nix command line interface is invoked.
+type Config struct {
+	// Binary is the nix executable to run, defaults to nix.
+	Binary string
+	// ExtraOptions are nix configuration settings provided to every command with --option.
+	ExtraOptions map[string]string
+	// ExperimentalFeatures are enabled on every command with --extra-experimental-features.
+	ExperimentalFeatures []string
+	// ExtraEnv are environment variables added to the environment of every command.
+	ExtraEnv map[string]string
+	// WorkingDirectory is the directory commands are run from, defaults to the current directory.
+	WorkingDirectory string
+	// GCRootDir is the directory in which garbage collector roots are created.
+	GCRootDir string
+	// LockFileMode defines how the lock file of flakes is handled, defaults to nix.LockFileModeStrict.
+	LockFileMode nix.LockFileMode
+	// ReferenceLockFile, if set, is the lock file used instead of the lock file of flakes.
+	ReferenceLockFile string
+	// System, if set, is the system installables are evaluated and built for, instead of the local one.
+	System string
+	// ExtraPlatforms, if not nil, are the systems, other than the local one, that can be built locally.
+	ExtraPlatforms []string
+	// Builders, if not nil, are the remote machines derivations can be built on, instead of the ones of the nix configuration.
+	Builders []nix.Builder
+}
+
+type cli struct {
+	config Config
+	// inheritEnv, if not nil, restricts the environment variables commands inherit, see nix.EvaluationOptions.InheritEnv.
+	inheritEnv []string
+	// evaluating is set for commands evaluating flakes, the only ones given the lock file arguments.
+	evaluating bool
+}
 
 // New creates a new nix implementation backed by the nix command line interface.
-func New() nix.Nix {
-	return new(cli)
+func New(config Config) nix.Nix {
+	if config.Binary == "" {
+		config.Binary = "nix"
+	}
+	return &cli{config: config}
+}
+
+// ResolvedGCRootDir returns the garbage collector root directory, relative paths being relative to the working directory.
+func (c Config) ResolvedGCRootDir() string {
+	if c.GCRootDir == "" || filepath.IsAbs(c.GCRootDir) {
+		return c.GCRootDir
+	}
+	return filepath.Join(c.WorkingDirectory, c.GCRootDir)
+}
+
+// globalArgs returns the arguments derived from the configuration that are given to every command.
+func (c cli) globalArgs() []string {
+	var args []string
+
+	if len(c.config.ExperimentalFeatures) > 0 {
+		args = append(args, "--extra-experimental-features", strings.Join(c.config.ExperimentalFeatures, " "))
+	}
+
+	options := maps.Keys(c.config.ExtraOptions)
+	slices.Sort(options)
+	for _, option := range options {
+		args = append(args, "--option", option, c.config.ExtraOptions[option])
+	}
+
+	if c.config.System != "" {
+		args = append(args, "--system", c.config.System)
+	}
+	if c.config.ExtraPlatforms != nil {
+		args = append(args, "--extra-platforms", strings.Join(c.config.ExtraPlatforms, " "))
+	}
+	if c.config.Builders != nil {
+		args = append(args, "--builders", buildersArg(c.config.Builders))
+	}
+
+	return args
+}
+
+// lockFileArgs returns the arguments defining how the lock file of flakes is handled.
+func (c cli) lockFileArgs() []string {
+	var args []string
+
+	switch c.config.LockFileMode {
+	case nix.LockFileModeReadOnly:
+		args = append(args, "--no-write-lock-file")
+	case nix.LockFileModeAllowWrite:
+	case nix.LockFileModeRecreate:
+		args = append(args, "--recreate-lock-file", "--no-write-lock-file")
+	default:
+		args = append(args, "--no-update-lock-file", "--no-write-lock-file")
+	}
+
+	if c.config.ReferenceLockFile != "" {
+		args = append(args, "--reference-lock-file", c.config.ReferenceLockFile)
+	}
+
+	return args
+}
+
+// withEvaluation returns a copy of c handling lock files, evaluating for the system, and inheriting the environment, as defined by the evaluation options, if they are set.
+func (c cli) withEvaluation(options nix.EvaluationOptions) cli {
+	if options.LockFileMode != "" {
+		c.config.LockFileMode = options.LockFileMode
+	}
+	if options.ReferenceLockFile != "" {
+		c.config.ReferenceLockFile = options.ReferenceLockFile
+	}
+	if options.System != "" {
+		c.config.System = options.System
+	}
+	if options.InheritEnv != nil {
+		c.inheritEnv = options.InheritEnv
+	}
+	c.evaluating = true
+	return c
+}
+
+// withFlakeLockFile returns a copy of c handling the own lock file of flakes with the mode, ignoring the configured lock file mode and reference lock file.
+func (c cli) withFlakeLockFile(mode nix.LockFileMode) cli {
+	c.config.LockFileMode = mode
+	c.config.ReferenceLockFile = ""
+	return c
+}
+
+// withInstallable returns a copy of c handling lock files if the installable is evaluated, like flake installables are, unlike store paths.
+func (c cli) withInstallable(installable string) cli {
+	if !isStorePathInstallable(installable) {
+		c.evaluating = true
+	}
+	return c
+}
+
+// withBuild returns a copy of c building on the machines defined by the build options, if they are set.
+func (c cli) withBuild(options nix.BuildOptions) cli {
+	if options.Builders != nil {
+		c.config.Builders = options.Builders
+	}
+	if options.ExtraPlatforms != nil {
+		c.config.ExtraPlatforms = options.ExtraPlatforms
+	}
+	return c
 }
 
-func (cli) runNixCmd(ctx context.Context, additionalEnv []string, subcommand string, args ...string) (io.Reader, error) {
-	command := strings.Join(append([]string{
-		"nix",
-		subcommand,
-		"--no-update-lock-file",
-		"--no-write-lock-file",
-	}, args...), " ")
-	cmd := exec.CommandContext(ctx, "bash", "-c", command) //nolint: gosec // even if some commands uses variables from callers, it is only the nix cli arguments, not the command executed.
-	cmd.Env = append(os.Environ(), additionalEnv...)
+// globalEnv returns the environment derived from the configuration that is given to every command.
+func (c cli) globalEnv() []string {
+	keys := maps.Keys(c.config.ExtraEnv)
+	slices.Sort(keys)
+
+	env := make([]string, 0, len(keys))
+	for _, key := range keys {
+		env = append(env, key+"="+c.config.ExtraEnv[key])
+	}
+
+	return env
+}
+
+// runNixCmd executes the nix subcommand (like "build", or "derivation show") with the provided arguments.
+// Arguments are given as is to nix, without any shell interpretation.
+// Nix logs are forwarded to terraform logs while the command runs.
+func (c cli) runNixCmd(ctx context.Context, additionalEnv []string, subcommand string, args ...string) (io.Reader, error) {
+	stdout, _, err := c.runNixCmdWithLogs(ctx, additionalEnv, subcommand, args...)
+	return stdout, err
+}
+
+// runNixCmdWithLogs is like runNixCmd, it also returns the logs written by nix, to read its messages.
+func (c cli) runNixCmdWithLogs(ctx context.Context, additionalEnv []string, subcommand string, args ...string) (io.Reader, *logWriter, error) {
+	cmdArgs := strings.Fields(subcommand)
+	if c.evaluating {
+		cmdArgs = append(cmdArgs, c.lockFileArgs()...)
+	}
+	cmdArgs = append(cmdArgs, "--log-format", "internal-json")
+	cmdArgs = append(cmdArgs, c.globalArgs()...)
+	cmdArgs = append(cmdArgs, args...)
+
+	cmd := exec.CommandContext(ctx, c.config.Binary, cmdArgs...)
+	cmd.Env = append(append(inheritedEnv(os.Environ(), c.inheritEnv), c.globalEnv()...), additionalEnv...)
+	cmd.Dir = c.config.WorkingDirectory
+
+	ctx = tflog.SetField(ctx, "nix_command", subcommand)
+	tflog.Debug(ctx, "running nix command", map[string]any{"args": cmd.Args})
 
 	var stdOut bytes.Buffer
 	cmd.Stdout = &stdOut
-	var stdErr bytes.Buffer
-	cmd.Stderr = &stdErr
+	stdErr := newLogWriter(ctx)
+	cmd.Stderr = stdErr
 
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("unable to execute command %q: %v (stderr = %s)", err, command, stdErr.String())
+	err := cmd.Run()
+	_ = stdErr.Close()
+	if err != nil {
+		return nil, stdErr, classifyError(subcommand, cmd.String(), err, stdErr)
 	}
 
-	return &stdOut, nil
+	return &stdOut, stdErr, nil
 }
 
 func (c cli) EvaluateExpression(ctx context.Context, req nix.EvaluateRequest) (json.RawMessage, error) {
-	args := []string{req.Installable, "--json"}
-	if req.Apply != nil {
-		args = append(args, "--apply "+*req.Apply)
-	}
-
-	raw, err := c.runNixCmd(ctx, nil, "eval", args...)
+	raw, err := c.withEvaluation(req.EvaluationOptions).runNixCmd(ctx, evaluationEnv(req.EvaluationOptions), "eval", evaluateArgs(ctx, req)...)
 	if err != nil {
 		return nil, err
 	}
@@ -61,8 +228,8 @@ func (c cli) EvaluateExpression(ctx context.Context, req nix.EvaluateRequest) (j
 	return msg, nil
 }
 
-func (c cli) Build(ctx context.Context, installable string) (*nix.StorePath, error) {
-	stdout, err := c.runNixCmd(ctx, nil, "build", "--no-link", "--json", installable)
+func (c cli) Build(ctx context.Context, req nix.BuildRequest) (*nix.StorePath, error) {
+	stdout, err := c.withEvaluation(req.EvaluationOptions).withBuild(req.Options).runNixCmd(ctx, evaluationEnv(req.EvaluationOptions), "build", buildArgs(ctx, req)...)
 	if err != nil {
 		return nil, err
 	}
@@ -76,9 +243,9 @@ func (c cli) Build(ctx context.Context, installable string) (*nix.StorePath, err
 				derivation = d
 			}
 		case err == nil && len(derivations) == 0:
-			return nil, fmt.Errorf("no derivation built for installable %q", installable)
+			return nil, fmt.Errorf("no derivation built for installable %q", req.Installable)
 		case err == nil && len(derivations) > 1:
-			return nil, fmt.Errorf("unhandled: found more than one derivation for installable %q", installable)
+			return nil, fmt.Errorf("unhandled: found more than one derivation for installable %q", req.Installable)
 		default:
 			return nil, fmt.Errorf("unable to decode shell to stdout: %v", err)
 		}
@@ -87,11 +254,84 @@ func (c cli) Build(ctx context.Context, installable string) (*nix.StorePath, err
 	return &nix.StorePath{
 		Derivation: derivation.DrvPath,
 		Output:     derivation.outputPath(),
+		Outputs:    derivation.Outputs,
 	}, nil
 }
 
-func (c cli) DescribeDerivation(ctx context.Context, installable string) (*nix.Derivation, error) {
-	stdout, err := c.runNixCmd(ctx, nil, "derivation show", installable)
+func (c cli) PlanBuild(ctx context.Context, installable string, options nix.EvaluationOptions) (*nix.BuildPlan, error) {
+	args := append([]string{"--dry-run", "--json", "--no-link"}, evaluationArgs(ctx, installable, options)...)
+	stdout, logs, err := c.withEvaluation(options).runNixCmdWithLogs(ctx, evaluationEnv(options), "build", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var derivations cmdBuildDerivationOutput
+	if err := json.NewDecoder(stdout).Decode(&derivations); err != nil {
+		return nil, fmt.Errorf("unable to decode command output: %v", err)
+	}
+	if len(derivations) == 0 {
+		return nil, fmt.Errorf("no derivation to build for installable %q", installable)
+	}
+
+	plan, err := parseDryRun(logs.Transcript())
+	if err != nil {
+		return nil, err
+	}
+
+	// the derivations to build and the paths to fetch are only described by messages meant to be read by humans,
+	// make sure outputs missing from them are indeed in the store instead of reporting an up to date build
+	var unplanned []string
+	for _, derivation := range derivations {
+		if slices.Contains(plan.Derivations, derivation.DrvPath) {
+			continue
+		}
+		for _, output := range derivation.Outputs {
+			if output != "" && !slices.Contains(plan.Fetched, output) {
+				unplanned = append(unplanned, output)
+			}
+		}
+	}
+	if len(unplanned) == 0 {
+		return plan, nil
+	}
+
+	valid, err := c.validStorePaths(ctx, unplanned)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, fmt.Errorf("unable to read the build plan of installable %q: outputs are missing from the store but nix reported nothing to build nor fetch", installable)
+	}
+
+	return plan, nil
+}
+
+// validStorePaths returns whether every store path is valid in the store.
+func (c cli) validStorePaths(ctx context.Context, storePaths []string) (bool, error) {
+	stdout, err := c.runNixCmd(ctx, nil, "path-info", append([]string{"--json"}, storePaths...)...)
+	if err != nil {
+		if missingErr := new(nix.MissingStorePathError); errors.As(err, &missingErr) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	var pathInfo cmdPathInfoOutput
+	if err := json.NewDecoder(stdout).Decode(&pathInfo); err != nil {
+		return false, fmt.Errorf("unable to decode command output: %v", err)
+	}
+
+	for _, storePath := range pathInfo {
+		if !storePath.valid() {
+			return false, nil
+		}
+	}
+
+	return len(pathInfo) == len(storePaths), nil
+}
+
+func (c cli) DescribeDerivation(ctx context.Context, installable string, options nix.EvaluationOptions) (*nix.Derivation, error) {
+	stdout, err := c.withEvaluation(options).runNixCmd(ctx, evaluationEnv(options), "derivation show", evaluationArgs(ctx, installable, options)...)
 	if err != nil {
 		return nil, err
 	}
@@ -118,19 +358,16 @@ func (c cli) DescribeDerivation(ctx context.Context, installable string) (*nix.D
 		}
 	}
 
-	return &nix.Derivation{
-		Name: derivation.Name,
-		Path: nix.StorePath{
-			Derivation: derivationPath,
-			Output:     derivation.outputPath(),
-		},
-		System: derivation.System,
-	}, nil
+	described := derivation.derivation(derivationPath)
+	return &described, nil
 }
 
 func (c cli) GetStorePath(ctx context.Context, installable string) (bool, *nix.StorePath, error) {
-	stdout, err := c.runNixCmd(ctx, nil, "path-info", "--json", installable)
+	stdout, err := c.withInstallable(installable).runNixCmd(ctx, nil, "path-info", "--json", installableArg(ctx, installable))
 	if err != nil {
+		if missingErr := new(nix.MissingStorePathError); errors.As(err, &missingErr) {
+			return false, nil, nil
+		}
 		return false, nil, err
 	}
 
@@ -149,55 +386,145 @@ func (c cli) GetStorePath(ctx context.Context, installable string) (bool, *nix.S
 		}
 	}
 
-	return storePath.Valid, &nix.StorePath{
+	return storePath.valid(), &nix.StorePath{
 		Derivation: storePath.Deriver,
 		Output:     storePath.Path,
 	}, nil
 }
 
 func (c cli) CopyStorePath(ctx context.Context, req nix.CopyRequest) error {
-	args := []string{req.Installable}
-	if req.From != nil {
-		args = append(args, "--from "+*req.From)
+	_, err := c.withInstallable(req.Installable).runNixCmd(ctx, sshOptionsEnv(req.SSHOptions), "copy", copyArgs(ctx, req)...)
+	return err
+}
+
+func (c cli) GetRemoteStorePath(ctx context.Context, req nix.RemoteStorePathRequest) (*nix.PathInfo, error) {
+	env := sshOptionsEnv(req.SSHOptions)
+
+	// the installable is resolved first, as the closure of installables that are not store paths can't tell which path is the requested one
+	stdout, err := c.withInstallable(req.Installable).runNixCmd(ctx, env, "path-info", remoteStorePathArgs(ctx, req, false)...)
+	if missingErr := new(nix.MissingStorePathError); errors.As(err, &missingErr) {
+		return &nix.PathInfo{Path: req.Installable}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var resolved cmdPathInfoOutput
+	if err := json.NewDecoder(stdout).Decode(&resolved); err != nil {
+		return nil, fmt.Errorf("unable to decode command output: %v", err)
 	}
-	if req.To != nil {
-		args = append(args, "--to "+*req.To)
+
+	storePath, err := resolved.storePath(req.Installable)
+	if err != nil {
+		return nil, err
 	}
-	if req.CheckSignature != nil && !*req.CheckSignature {
-		args = append(args, "--no-check-sigs")
+	if !storePath.valid() {
+		return &nix.PathInfo{Path: storePath.Path}, nil
 	}
-	if req.SubstituteOnDestination != nil && *req.SubstituteOnDestination {
-		args = append(args, "--substitute-on-destination")
+
+	// querying the closure fails if any of the closure paths is missing
+	closureReq := req
+	closureReq.Installable = storePath.Path
+	result := storePath.pathInfo()
+	stdout, err = c.runNixCmd(ctx, env, "path-info", remoteStorePathArgs(ctx, closureReq, true)...)
+	if missingErr := new(nix.MissingStorePathError); errors.As(err, &missingErr) {
+		return &result, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	var env []string
-	if len(req.SSHOptions) > 0 {
-		env = []string{"NIX_SSHOPTS=" + strings.Join(req.SSHOptions, " ")}
+	var closure cmdPathInfoOutput
+	if err := json.NewDecoder(stdout).Decode(&closure); err != nil {
+		return nil, fmt.Errorf("unable to decode command output: %v", err)
 	}
 
-	_, err := c.runNixCmd(ctx, env, "copy", args...)
-	return err
+	result.ClosureComplete = true
+	for _, p := range closure {
+		result.ClosureComplete = result.ClosureComplete && p.valid()
+		result.ClosureSize += p.NarSize
+	}
+	if !result.ClosureComplete {
+		result.ClosureSize = 0
+	}
+
+	return &result, nil
 }
 
-func (c cli) RemoteStorePathExists(ctx context.Context, req nix.RemoteStorePathExistsRequest) (bool, error) {
-	args := []string{
-		"--offline",
-		"--from " + req.Store,
-		"--to " + req.Store,
-		req.Installable,
+func (c cli) GetClosure(ctx context.Context, req nix.RemoteStorePathRequest) ([]nix.PathInfo, error) {
+	stdout, err := c.withInstallable(req.Installable).runNixCmd(ctx, sshOptionsEnv(req.SSHOptions), "path-info", remoteStorePathArgs(ctx, req, true)...)
+	if err != nil {
+		return nil, err
 	}
 
-	var env []string
-	if len(req.SSHOptions) > 0 {
-		env = []string{"NIX_SSHOPTS=" + strings.Join(req.SSHOptions, " ")}
+	var pathInfo cmdPathInfoOutput
+	if err := json.NewDecoder(stdout).Decode(&pathInfo); err != nil {
+		return nil, fmt.Errorf("unable to decode command output: %v", err)
 	}
 
-	switch _, err := c.runNixCmd(ctx, env, "copy", args...); { // this can never work
-	case err == nil:
-		return true, nil
-	case strings.Contains(err.Error(), "is required, but there is no substituter that can build it"):
-		return false, nil
-	default:
-		return false, err
+	closure := make([]nix.PathInfo, 0, len(pathInfo))
+	for _, storePath := range pathInfo {
+		if !storePath.valid() {
+			return nil, &nix.MissingStorePathError{Message: fmt.Sprintf("path '%s' is not valid", storePath.Path), Path: storePath.Path}
+		}
+		closure = append(closure, storePath.pathInfo())
+	}
+
+	slices.SortFunc(closure, func(a, b nix.PathInfo) int { return cmp.Compare(a.Path, b.Path) })
+	return closure, nil
+}
+
+func (c cli) GetFlakeMetadata(ctx context.Context, req nix.FlakeMetadataRequest) (*nix.FlakeMetadata, error) {
+	if c = c.withEvaluation(req.EvaluationOptions); req.OwnLockFile {
+		c = c.withFlakeLockFile(nix.LockFileModeReadOnly)
+	}
+
+	args := append([]string{"--json"}, flakeInputsArgs(req.EvaluationOptions)...)
+	stdout, err := c.runNixCmd(ctx, evaluationEnv(req.EvaluationOptions), "flake metadata", append(args, req.Flake)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata cmdFlakeMetadataOutput
+	if err := json.NewDecoder(stdout).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("unable to decode command output: %v", err)
+	}
+
+	return metadata.flakeMetadata()
+}
+
+func (c cli) LockFlake(ctx context.Context, req nix.FlakeLockRequest) (*nix.FlakeMetadata, error) {
+	// the lock file of the flake itself is written, whatever the lock file settings used to evaluate flakes are
+	locker := c.withFlakeLockFile(nix.LockFileModeAllowWrite).withEvaluation(nix.EvaluationOptions{})
+
+	// flake update locks missing inputs as well, but updates every input when none is given
+	subcommand, args := "flake lock", []string{req.Flake}
+	if len(req.UpdateInputs) > 0 {
+		subcommand, args = "flake update", append(slices.Clone(req.UpdateInputs), "--flake", req.Flake)
+	}
+
+	if _, err := locker.runNixCmd(ctx, nil, subcommand, args...); err != nil {
+		return nil, err
+	}
+
+	return c.GetFlakeMetadata(ctx, nix.FlakeMetadataRequest{Flake: req.Flake, OwnLockFile: true})
+}
+
+func (c cli) GetFlakeOutputs(ctx context.Context, req nix.FlakeOutputsRequest) ([]nix.FlakeOutput, error) {
+	args := []string{"--json"}
+	if req.AllSystems {
+		args = append(args, "--all-systems")
 	}
+
+	stdout, err := c.withEvaluation(nix.EvaluationOptions{}).runNixCmd(ctx, nil, "flake show", append(args, req.Flake)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var outputs cmdFlakeShowOutput
+	if err := json.NewDecoder(stdout).Decode(&outputs); err != nil {
+		return nil, fmt.Errorf("unable to decode command output: %v", err)
+	}
+
+	return outputs.flakeOutputs()
 }
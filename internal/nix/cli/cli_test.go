@@ -0,0 +1,273 @@
+package nixcli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+// fakeBinary returns a nix implementation running script, a shell script standing for the nix binary.
+// Arguments of each run are appended to the args file of the returned directory.
+func fakeBinary(t *testing.T, script string) (*cli, string) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "nix")
+	assert.NilError(t, os.WriteFile(binary, []byte("#!/bin/sh\necho \"$@\" >> "+filepath.Join(dir, "args")+"\n"+script), 0o700))
+	return &cli{config: Config{Binary: binary}}, dir
+}
+
+func Test_cli_GetRemoteStorePath(t *testing.T) {
+	t.Run("installables resolving to a store path", func(t *testing.T) {
+		// the dependency sorts first in the closure
+		c, _ := fakeBinary(t, `
+case "$*" in
+  *--recursive*) echo '{"/nix/store/aaa-glibc":{"narHash":"sha256-glibc","narSize":30,"references":[]},"/nix/store/bbb-app":{"narHash":"sha256-app","narSize":12,"references":["/nix/store/aaa-glibc"]}}' ;;
+  *) echo '{"/nix/store/bbb-app":{"narHash":"sha256-app","narSize":12,"references":["/nix/store/aaa-glibc"]}}' ;;
+esac
+`)
+
+		pathInfo, err := c.GetRemoteStorePath(context.Background(), nix.RemoteStorePathRequest{Installable: ".#app"})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, pathInfo, &nix.PathInfo{
+			Path:            "/nix/store/bbb-app",
+			Valid:           true,
+			NarHash:         "sha256-app",
+			NarSize:         12,
+			References:      []string{"/nix/store/aaa-glibc"},
+			ClosureComplete: true,
+			ClosureSize:     42,
+		})
+	})
+
+	t.Run("closure of the resolved store path", func(t *testing.T) {
+		c, dir := fakeBinary(t, `echo '[{"path":"/nix/store/bbb-app","narSize":12}]'`)
+
+		_, err := c.GetRemoteStorePath(context.Background(), nix.RemoteStorePathRequest{Installable: ".#app", Store: "ssh://remote"})
+		assert.NilError(t, err)
+
+		args, err := os.ReadFile(filepath.Join(dir, "args"))
+		assert.NilError(t, err)
+		assert.Equal(t, string(args), ""+
+			"path-info --no-update-lock-file --no-write-lock-file --log-format internal-json --json --store ssh://remote .#app\n"+
+			"path-info --log-format internal-json --json --store ssh://remote --recursive /nix/store/bbb-app\n")
+	})
+
+	t.Run("invalid store paths", func(t *testing.T) {
+		c, _ := fakeBinary(t, `echo '{"/nix/store/bbb-app":null}'`)
+
+		pathInfo, err := c.GetRemoteStorePath(context.Background(), nix.RemoteStorePathRequest{Installable: "/nix/store/bbb-app"})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, pathInfo, &nix.PathInfo{Path: "/nix/store/bbb-app"})
+	})
+
+	t.Run("installables resolving to multiple store paths", func(t *testing.T) {
+		c, _ := fakeBinary(t, `echo '{"/nix/store/bbb-app":{},"/nix/store/ccc-app-doc":{}}'`)
+
+		_, err := c.GetRemoteStorePath(context.Background(), nix.RemoteStorePathRequest{Installable: ".#app^*"})
+		assert.ErrorContains(t, err, "resolves to 2 store paths")
+	})
+}
+
+func Test_cli_EvaluateExpression_environment(t *testing.T) {
+	t.Setenv("HOME", "/home/user")
+	t.Setenv("NIX_PATH", "nixpkgs=/nixpkgs")
+	t.Setenv("INHERITED", "inherited")
+	t.Setenv("SECRET", "secret")
+
+	for name, test := range map[string]struct {
+		inheritEnv []string
+		expected   []string
+		unexpected []string
+	}{
+		"whole environment inherited by default": {
+			expected: []string{"HOME=/home/user", "NIX_PATH=nixpkgs=/nixpkgs", "INHERITED=inherited", "SECRET=secret", "DECLARED=declared"},
+		},
+		"allowed variables": {
+			inheritEnv: []string{"INHERITED"},
+			expected:   []string{"HOME=/home/user", "NIX_PATH=nixpkgs=/nixpkgs", "INHERITED=inherited", "DECLARED=declared"},
+			unexpected: []string{"SECRET"},
+		},
+		"clean environment": {
+			inheritEnv: []string{},
+			expected:   []string{"HOME=/home/user", "NIX_PATH=nixpkgs=/nixpkgs", "DECLARED=declared"},
+			unexpected: []string{"INHERITED", "SECRET"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, dir := fakeBinary(t, `env > "$(dirname "$0")/env"; echo null`)
+
+			_, err := c.EvaluateExpression(context.Background(), nix.EvaluateRequest{
+				EvaluationOptions: nix.EvaluationOptions{
+					Env:        map[string]string{"DECLARED": "declared"},
+					InheritEnv: test.inheritEnv,
+				},
+				Installable: ".#value",
+			})
+			assert.NilError(t, err)
+
+			raw, err := os.ReadFile(filepath.Join(dir, "env"))
+			assert.NilError(t, err)
+			env := strings.Split(string(raw), "\n")
+			for _, variable := range test.expected {
+				assert.Assert(t, is.Contains(env, variable))
+			}
+			for _, variable := range env {
+				name, _, _ := strings.Cut(variable, "=")
+				for _, unexpected := range test.unexpected {
+					assert.Assert(t, name != unexpected, "variable %s is inherited", name)
+				}
+			}
+		})
+	}
+}
+
+func Test_cli_PlanBuild(t *testing.T) {
+	t.Run("build plan", func(t *testing.T) {
+		c, _ := fakeBinary(t, `
+# printf keeps the escaped newline of the message, unlike echo
+printf '%s\n' '@nix {"action":"msg","level":2,"msg":"this derivation will be built:\n  /nix/store/aaa-hello.drv"}' >&2
+echo '[{"drvPath":"/nix/store/aaa-hello.drv","outputs":{"out":"/nix/store/bbb-hello"}}]'
+`)
+
+		plan, err := c.PlanBuild(context.Background(), ".#hello", nix.EvaluationOptions{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, plan, &nix.BuildPlan{Derivations: []string{"/nix/store/aaa-hello.drv"}})
+	})
+
+	t.Run("outputs in the store", func(t *testing.T) {
+		c, _ := fakeBinary(t, `
+case "$1" in
+  build) echo '[{"drvPath":"/nix/store/aaa-hello.drv","outputs":{"out":"/nix/store/bbb-hello"}}]' ;;
+  path-info) echo '{"/nix/store/bbb-hello":{"narHash":"sha256-hello","narSize":12}}' ;;
+esac
+`)
+
+		plan, err := c.PlanBuild(context.Background(), ".#hello", nix.EvaluationOptions{})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, plan, &nix.BuildPlan{})
+	})
+
+	t.Run("outputs missing from the plan and the store", func(t *testing.T) {
+		c, _ := fakeBinary(t, `
+case "$1" in
+  build)
+    echo '@nix {"action":"msg","level":2,"msg":"the derivation /nix/store/aaa-hello.drv is going to be built"}' >&2
+    echo '[{"drvPath":"/nix/store/aaa-hello.drv","outputs":{"out":"/nix/store/bbb-hello"}}]' ;;
+  path-info) echo '{"/nix/store/bbb-hello":null}' ;;
+esac
+`)
+
+		_, err := c.PlanBuild(context.Background(), ".#hello", nix.EvaluationOptions{})
+		assert.ErrorContains(t, err, "unable to read the build plan")
+	})
+
+	t.Run("unexpected output", func(t *testing.T) {
+		c, _ := fakeBinary(t, `echo 'these 2 derivations will be built:'`)
+
+		_, err := c.PlanBuild(context.Background(), ".#hello", nix.EvaluationOptions{})
+		assert.ErrorContains(t, err, "unable to decode command output")
+	})
+}
+
+func Test_cli_LockFlake(t *testing.T) {
+	for name, test := range map[string]struct {
+		updateInputs []string
+		expected     string
+	}{
+		"lock missing inputs": {
+			expected: "flake lock --log-format internal-json .\n",
+		},
+		"update inputs": {
+			updateInputs: []string{"nixpkgs", "home-manager/nixpkgs"},
+			expected:     "flake update --log-format internal-json nixpkgs home-manager/nixpkgs --flake .\n",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, dir := fakeBinary(t, `
+case "$2" in
+  metadata) echo '{"locks":{"nodes":{"root":{}},"root":"root"}}' ;;
+esac
+`)
+			// the flake own lock file is written and read, whatever the lock file settings are
+			c.config.LockFileMode = nix.LockFileModeRecreate
+			c.config.ReferenceLockFile = "/src/reference.lock"
+
+			_, err := c.LockFlake(context.Background(), nix.FlakeLockRequest{Flake: ".", UpdateInputs: test.updateInputs})
+			assert.NilError(t, err)
+
+			args, err := os.ReadFile(filepath.Join(dir, "args"))
+			assert.NilError(t, err)
+			assert.Equal(t, string(args), test.expected+"flake metadata --no-write-lock-file --log-format internal-json --json .\n")
+		})
+	}
+}
+
+func Test_cli_GetFlakeMetadata(t *testing.T) {
+	for name, test := range map[string]struct {
+		req      nix.FlakeMetadataRequest
+		expected string
+	}{
+		"configured lock file settings": {
+			req:      nix.FlakeMetadataRequest{Flake: "."},
+			expected: "flake metadata --no-update-lock-file --no-write-lock-file --reference-lock-file /src/reference.lock --log-format internal-json --json .\n",
+		},
+		"overridden inputs": {
+			req: nix.FlakeMetadataRequest{
+				EvaluationOptions: nix.EvaluationOptions{OverrideInputs: map[string]string{"nixpkgs": "github:me/nixpkgs/branch"}, LockFileMode: nix.LockFileModeReadOnly},
+				Flake:             ".",
+			},
+			expected: "flake metadata --no-write-lock-file --reference-lock-file /src/reference.lock --log-format internal-json --json --override-input nixpkgs github:me/nixpkgs/branch .\n",
+		},
+		"own lock file": {
+			req:      nix.FlakeMetadataRequest{Flake: ".", OwnLockFile: true},
+			expected: "flake metadata --no-write-lock-file --log-format internal-json --json .\n",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, dir := fakeBinary(t, `echo '{"locks":{"nodes":{"root":{}},"root":"root"}}'`)
+			c.config.ReferenceLockFile = "/src/reference.lock"
+
+			_, err := c.GetFlakeMetadata(context.Background(), test.req)
+			assert.NilError(t, err)
+
+			args, err := os.ReadFile(filepath.Join(dir, "args"))
+			assert.NilError(t, err)
+			assert.Equal(t, string(args), test.expected)
+		})
+	}
+}
+
+func Test_cli_lockFileArgs(t *testing.T) {
+	c, dir := fakeBinary(t, "")
+
+	assert.NilError(t, c.CopyStorePath(context.Background(), nix.CopyRequest{Installable: "/nix/store/aaa-hello"}))
+	assert.NilError(t, c.CopyStorePath(context.Background(), nix.CopyRequest{Installable: ".#hello"}))
+
+	args, err := os.ReadFile(filepath.Join(dir, "args"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(args), ""+
+		"copy --log-format internal-json /nix/store/aaa-hello\n"+
+		"copy --no-update-lock-file --no-write-lock-file --log-format internal-json .#hello\n")
+}
+
+func Test_Config_ResolvedGCRootDir(t *testing.T) {
+	for name, test := range map[string]struct {
+		config   Config
+		expected string
+	}{
+		"not configured":                    {config: Config{WorkingDirectory: "/src"}, expected: ""},
+		"absolute":                          {config: Config{WorkingDirectory: "/src", GCRootDir: "/var/gcroots"}, expected: "/var/gcroots"},
+		"relative to the working directory": {config: Config{WorkingDirectory: "/src", GCRootDir: ".gcroots"}, expected: "/src/.gcroots"},
+		"relative to the current directory": {config: Config{GCRootDir: ".gcroots"}, expected: ".gcroots"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.config.ResolvedGCRootDir(), test.expected)
+		})
+	}
+}
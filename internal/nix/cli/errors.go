@@ -0,0 +1,110 @@
+package nixcli
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+var (
+	errorBuilderFailed        = regexp.MustCompile(`builder for '([^']+\.drv)' failed`)
+	errorCannotBuild          = regexp.MustCompile(`Cannot build '([^']+\.drv)'`)
+	errorSignatureRejected    = regexp.MustCompile(`path '([^']+)' because it lacks a (?:valid )?signature`)
+	errorMissingPath          = regexp.MustCompile(`path '(/nix/store/[^'/]+)' (?:is not valid|does not exist|is required, but there is no substituter)`)
+	errorConnectionToStore    = regexp.MustCompile(`(?:cannot open connection to remote store|cannot connect to) '([^']+)'`)
+	errorConnectionIndicators = []string{
+		"failed to start SSH connection",
+		"Connection refused",
+		"Connection timed out",
+		"Could not resolve hostname",
+		"Host key verification failed",
+		"Permission denied (publickey",
+		"No route to host",
+	}
+)
+
+// classifyError converts the error of a failed nix command to one of the nix package error types, using what nix logged.
+// If nothing allows to classify the error, a generic error is returned.
+func classifyError(subcommand string, cmd string, cmdErr error, logs *logWriter) error {
+	var (
+		messages []string
+		evalErr  *internalJSONLog
+	)
+	for i, log := range logs.Errors() {
+		messages = append(messages, cleanErrorMessage(log.Msg))
+		if evalErr == nil && (len(log.Trace) > 0 || log.File != "") {
+			evalErr = &logs.Errors()[i]
+		}
+	}
+	message := strings.Join(messages, "\n")
+
+	if m := errorSignatureRejected.FindStringSubmatch(message); m != nil {
+		return &nix.SignatureError{Message: message, Path: m[1]}
+	}
+
+	if m := errorConnectionToStore.FindStringSubmatch(message); m != nil {
+		return &nix.ConnectionError{Message: message, Store: m[1]}
+	}
+	for _, indicator := range errorConnectionIndicators {
+		if strings.Contains(message, indicator) {
+			return &nix.ConnectionError{Message: message}
+		}
+	}
+
+	if m := errorBuilderFailed.FindStringSubmatch(message); m != nil {
+		return &nix.BuildError{Message: message, Derivation: m[1], LogTail: logs.BuildLogTail(m[1])}
+	}
+	if m := errorCannotBuild.FindStringSubmatch(message); m != nil {
+		return &nix.BuildError{Message: message, Derivation: m[1], LogTail: logs.BuildLogTail(m[1])}
+	}
+
+	// only top level store paths are missing store paths, other missing paths are files an evaluation failed to read
+	if m := errorMissingPath.FindStringSubmatch(message); m != nil {
+		return &nix.MissingStorePathError{Message: message, Path: m[1]}
+	}
+
+	if evalErr != nil {
+		return evaluationError(*evalErr)
+	}
+	if len(messages) > 0 {
+		switch subcommand {
+		case "eval", "build", "derivation show", "flake metadata", "flake show", "flake lock", "flake update":
+			return &nix.EvaluationError{Message: message}
+		}
+	}
+
+	return fmt.Errorf("unable to execute command %q: %v (stderr = %s)", cmd, cmdErr, logs.Messages())
+}
+
+func evaluationError(log internalJSONLog) *nix.EvaluationError {
+	err := nix.EvaluationError{
+		Message:  cleanErrorMessage(log.RawMsg),
+		Position: errorPosition(log.File, log.Line, log.Column),
+	}
+	if err.Message == "" {
+		err.Message = cleanErrorMessage(log.Msg)
+	}
+
+	for _, trace := range log.Trace {
+		err.Trace = append(err.Trace, nix.ErrorTrace{
+			Message:  cleanErrorMessage(trace.RawMsg),
+			Position: errorPosition(trace.File, trace.Line, trace.Column),
+		})
+	}
+
+	return &err
+}
+
+func errorPosition(file string, line, column int) *nix.ErrorPosition {
+	if file == "" && line == 0 {
+		return nil
+	}
+	return &nix.ErrorPosition{File: file, Line: line, Column: column}
+}
+
+func cleanErrorMessage(msg string) string {
+	msg = strings.TrimSpace(ansiEscapeSequence.ReplaceAllString(msg, ""))
+	return strings.TrimSpace(strings.TrimPrefix(msg, "error:"))
+}
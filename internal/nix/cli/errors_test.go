@@ -0,0 +1,96 @@
+package nixcli
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+func Test_classifyError(t *testing.T) {
+	for name, test := range map[string]struct {
+		subcommand string
+		logs       []string
+		expected   error
+	}{
+		"missing store path": {
+			subcommand: "path-info",
+			logs:       []string{`@nix {"action":"msg","level":0,"msg":"error: path '/nix/store/aaa-hello' is not valid"}`},
+			expected:   &nix.MissingStorePathError{Message: "path '/nix/store/aaa-hello' is not valid", Path: "/nix/store/aaa-hello"},
+		},
+		"missing store path without substituter": {
+			subcommand: "copy",
+			logs:       []string{`@nix {"action":"msg","level":0,"msg":"error: path '/nix/store/aaa-hello' is required, but there is no substituter that can build it"}`},
+			expected: &nix.MissingStorePathError{
+				Message: "path '/nix/store/aaa-hello' is required, but there is no substituter that can build it",
+				Path:    "/nix/store/aaa-hello",
+			},
+		},
+		"missing file of an evaluation": {
+			subcommand: "eval",
+			logs:       []string{`@nix {"action":"msg","level":0,"msg":"error: path '/home/user/src/foo.nix' does not exist"}`},
+			expected:   &nix.EvaluationError{Message: "path '/home/user/src/foo.nix' does not exist"},
+		},
+		"missing file of a store path": {
+			subcommand: "build",
+			logs: []string{
+				`@nix {"action":"msg","level":0,"msg":"error: path '/nix/store/aaa-source/foo.nix' does not exist","raw_msg":"path '/nix/store/aaa-source/foo.nix' does not exist","file":"/nix/store/aaa-source/flake.nix","line":3,"column":5}`,
+			},
+			expected: &nix.EvaluationError{
+				Message:  "path '/nix/store/aaa-source/foo.nix' does not exist",
+				Position: &nix.ErrorPosition{File: "/nix/store/aaa-source/flake.nix", Line: 3, Column: 5},
+			},
+		},
+		"unknown input to update": {
+			subcommand: "flake update",
+			logs:       []string{`@nix {"action":"msg","level":0,"msg":"error: '/src' has no input named 'nixpgks'"}`},
+			expected:   &nix.EvaluationError{Message: "'/src' has no input named 'nixpgks'"},
+		},
+		"failed build": {
+			subcommand: "build",
+			logs:       []string{`@nix {"action":"msg","level":0,"msg":"error: builder for '/nix/store/aaa-hello.drv' failed with exit code 1"}`},
+			expected:   &nix.BuildError{Message: "builder for '/nix/store/aaa-hello.drv' failed with exit code 1", Derivation: "/nix/store/aaa-hello.drv"},
+		},
+		"rejected signature": {
+			subcommand: "copy",
+			logs:       []string{`@nix {"action":"msg","level":0,"msg":"error: cannot add path '/nix/store/aaa-hello' because it lacks a signature by a trusted key"}`},
+			expected: &nix.SignatureError{
+				Message: "cannot add path '/nix/store/aaa-hello' because it lacks a signature by a trusted key",
+				Path:    "/nix/store/aaa-hello",
+			},
+		},
+		"unreachable store": {
+			subcommand: "copy",
+			logs:       []string{`@nix {"action":"msg","level":0,"msg":"error: cannot open connection to remote store 'ssh://remote': failed to start SSH connection"}`},
+			expected: &nix.ConnectionError{
+				Message: "cannot open connection to remote store 'ssh://remote': failed to start SSH connection",
+				Store:   "ssh://remote",
+			},
+		},
+		"ssh failure": {
+			subcommand: "path-info",
+			logs:       []string{`@nix {"action":"msg","level":0,"msg":"error: ssh: Could not resolve hostname remote"}`},
+			expected:   &nix.ConnectionError{Message: "ssh: Could not resolve hostname remote"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			logs := newLogWriter(context.Background())
+			for _, line := range test.logs {
+				_, _ = logs.Write([]byte(line + "\n"))
+			}
+
+			assert.DeepEqual(t, classifyError(test.subcommand, "nix "+test.subcommand, errors.New("exit status 1"), logs), test.expected)
+		})
+	}
+
+	t.Run("unclassified errors", func(t *testing.T) {
+		logs := newLogWriter(context.Background())
+		_, _ = logs.Write([]byte("something went wrong\n"))
+
+		err := classifyError("path-info", "nix path-info", errors.New("exit status 1"), logs)
+		assert.Error(t, err, `unable to execute command "nix path-info": exit status 1 (stderr = something went wrong)`)
+	})
+}
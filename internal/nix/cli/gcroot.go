@@ -0,0 +1,54 @@
+package nixcli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// AddGCRoot creates a symlink to the store path in the garbage collector root directory, and registers it as an indirect root.
+func (c cli) AddGCRoot(ctx context.Context, name string, storePath string) (string, error) {
+	dir := c.config.ResolvedGCRootDir()
+	if dir == "" {
+		return "", errors.New("no garbage collector root directory configured")
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("unable to create garbage collector root directory: %v", err)
+	}
+
+	root, err := filepath.Abs(filepath.Join(dir, name))
+	if err != nil {
+		return "", fmt.Errorf("unable to get garbage collector root absolute path: %v", err)
+	}
+
+	// building an existing store path only realises it, the out link is registered by nix as an indirect root
+	if _, err := c.runNixCmd(ctx, nil, "build", "--out-link", root, storePath); err != nil {
+		return "", err
+	}
+
+	return root, nil
+}
+
+// RemoveGCRoot removes the symlink, nix ignores indirect roots whose symlink does not exist anymore.
+func (cli) RemoveGCRoot(_ context.Context, root string) error {
+	if err := os.Remove(root); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to remove garbage collector root: %v", err)
+	}
+	return nil
+}
+
+// GCRootExists checks the symlink still points to the store path.
+func (cli) GCRootExists(_ context.Context, root string, storePath string) (bool, error) {
+	target, err := os.Readlink(root)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("unable to read garbage collector root: %v", err)
+	default:
+		return target == storePath, nil
+	}
+}
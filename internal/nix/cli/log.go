@@ -0,0 +1,383 @@
+package nixcli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+)
+
+const (
+	// maxLogMessages is the number of messages kept to explain a command failure.
+	maxLogMessages = 50
+	// maxBuildLogLines is the number of build log lines kept per derivation to explain a build failure.
+	maxBuildLogLines = 25
+)
+
+// Activity and result types as defined by nix in libutil/logging.hh.
+const (
+	activityTypeCopyPath      = 100
+	activityTypeFileTransfer  = 101
+	activityTypeRealise       = 102
+	activityTypeCopyPaths     = 103
+	activityTypeBuilds        = 104
+	activityTypeBuild         = 105
+	activityTypeOptimiseStore = 106
+	activityTypeVerifyPaths   = 107
+	activityTypeSubstitute    = 108
+	activityTypeQueryPathInfo = 109
+	activityTypePostBuildHook = 110
+	activityTypeBuildWaiting  = 111
+	activityTypeFetchTree     = 112
+
+	resultTypeBuildLogLine     = 101
+	resultTypeSetPhase         = 104
+	resultTypeProgress         = 105
+	resultTypePostBuildLogLine = 107
+)
+
+// Verbosity levels as defined by nix in libutil/error.hh.
+const (
+	verbosityError  = 0
+	verbosityWarn   = 1
+	verbosityNotice = 2
+	verbosityInfo   = 3
+)
+
+var ansiEscapeSequence = regexp.MustCompile(`\x1b\[[0-9;]*[a-zA-Z]`)
+
+type (
+	internalJSONLog struct {
+		Action string            `json:"action"`
+		ID     int64             `json:"id"`
+		Level  int               `json:"level"`
+		Type   int               `json:"type"`
+		Text   string            `json:"text"`
+		Msg    string            `json:"msg"`
+		Parent int64             `json:"parent"`
+		Fields []json.RawMessage `json:"fields"`
+
+		// error messages only
+		RawMsg string                 `json:"raw_msg"`
+		File   string                 `json:"file"`
+		Line   int                    `json:"line"`
+		Column int                    `json:"column"`
+		Trace  []internalJSONLogTrace `json:"trace"`
+	}
+
+	internalJSONLogTrace struct {
+		RawMsg string `json:"raw_msg"`
+		File   string `json:"file"`
+		Line   int    `json:"line"`
+		Column int    `json:"column"`
+	}
+
+	logActivity struct {
+		typ        int
+		text       string
+		fields     []json.RawMessage
+		downloaded int64
+		expected   int64
+	}
+)
+
+// logWriter parses the internal-json log format nix writes on stderr and forwards it to terraform logs.
+// It also keeps track of the last messages to be able to explain why a command failed.
+type logWriter struct {
+	ctx        context.Context //nolint:containedctx // logs are forwarded using the context of the command
+	pending    []byte
+	activities map[int64]*logActivity
+	messages   []string
+	transcript []string
+	errors     []internalJSONLog
+	buildLogs  map[string][]string
+}
+
+func newLogWriter(ctx context.Context) *logWriter {
+	return &logWriter{
+		ctx:        ctx,
+		activities: make(map[int64]*logActivity),
+		buildLogs:  make(map[string][]string),
+	}
+}
+
+// Write implements io.Writer.
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			break
+		}
+
+		w.handleLine(string(w.pending[:i]))
+		w.pending = w.pending[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Close flushes what remains to be handled.
+func (w *logWriter) Close() error {
+	if len(w.pending) > 0 {
+		w.handleLine(string(w.pending))
+		w.pending = nil
+	}
+	return nil
+}
+
+// Messages returns the last error and warning messages written by nix.
+func (w *logWriter) Messages() string {
+	return strings.Join(w.messages, "\n")
+}
+
+// Transcript returns every line of the messages written by nix, whatever their level.
+func (w *logWriter) Transcript() []string {
+	return w.transcript
+}
+
+// Errors returns the error messages written by nix.
+func (w *logWriter) Errors() []internalJSONLog {
+	return w.errors
+}
+
+// BuildLogTail returns the last build log lines of the provided derivation.
+func (w *logWriter) BuildLogTail(drv string) []string {
+	return w.buildLogs[drv]
+}
+
+func (w *logWriter) keepMessage(msg string) {
+	if msg = strings.TrimSpace(ansiEscapeSequence.ReplaceAllString(msg, "")); msg == "" {
+		return
+	}
+
+	w.messages = append(w.messages, msg)
+	if len(w.messages) > maxLogMessages {
+		w.messages = w.messages[len(w.messages)-maxLogMessages:]
+	}
+}
+
+func (w *logWriter) keepBuildLogLine(drv, line string) {
+	lines := append(w.buildLogs[drv], line)
+	if len(lines) > maxBuildLogLines {
+		lines = lines[len(lines)-maxBuildLogLines:]
+	}
+	w.buildLogs[drv] = lines
+}
+
+func (w *logWriter) handleLine(line string) {
+	raw, isJSON := strings.CutPrefix(line, "@nix ")
+	if !isJSON {
+		tflog.Debug(w.ctx, line)
+		w.keepMessage(line)
+		return
+	}
+
+	var log internalJSONLog
+	if err := json.Unmarshal([]byte(raw), &log); err != nil {
+		tflog.Debug(w.ctx, line, map[string]any{"error": err.Error()})
+		w.keepMessage(line)
+		return
+	}
+
+	switch log.Action {
+	case "msg":
+		w.handleMessage(log)
+	case "start":
+		w.handleActivityStart(log)
+	case "stop":
+		w.handleActivityStop(log)
+	case "result":
+		w.handleActivityResult(log)
+	}
+}
+
+func (w *logWriter) handleMessage(log internalJSONLog) {
+	msg := ansiEscapeSequence.ReplaceAllString(log.Msg, "")
+	w.transcript = append(w.transcript, strings.Split(msg, "\n")...)
+
+	switch log.Level {
+	case verbosityError:
+		tflog.Error(w.ctx, msg)
+		w.keepMessage(msg)
+		w.errors = append(w.errors, log)
+	case verbosityWarn:
+		tflog.Warn(w.ctx, msg)
+		w.keepMessage(msg)
+	case verbosityNotice, verbosityInfo:
+		tflog.Info(w.ctx, msg)
+	default:
+		tflog.Debug(w.ctx, msg)
+	}
+}
+
+func (w *logWriter) handleActivityStart(log internalJSONLog) {
+	activity := &logActivity{typ: log.Type, text: log.Text, fields: log.Fields}
+	w.activities[log.ID] = activity
+
+	fields := w.activityFields(log.ID, activity)
+	switch activity.typ {
+	case activityTypeBuild, activityTypeSubstitute, activityTypeCopyPath, activityTypeFileTransfer, activityTypeFetchTree, activityTypePostBuildHook:
+		tflog.Info(w.ctx, activity.text, fields)
+	default:
+		if activity.text != "" {
+			tflog.Debug(w.ctx, activity.text, fields)
+		}
+	}
+}
+
+func (w *logWriter) handleActivityStop(log internalJSONLog) {
+	activity, exists := w.activities[log.ID]
+	if !exists {
+		return
+	}
+
+	if activity.typ == activityTypeFileTransfer && activity.downloaded > 0 {
+		tflog.Info(w.ctx, "download finished", w.activityFields(log.ID, activity))
+	}
+
+	delete(w.activities, log.ID)
+}
+
+func (w *logWriter) handleActivityResult(log internalJSONLog) {
+	activity, exists := w.activities[log.ID]
+	if !exists {
+		return
+	}
+
+	fields := w.activityFields(log.ID, activity)
+
+	switch log.Type {
+	case resultTypeBuildLogLine, resultTypePostBuildLogLine:
+		if line, ok := stringField(log.Fields, 0); ok {
+			line = ansiEscapeSequence.ReplaceAllString(line, "")
+			tflog.Debug(w.ctx, line, fields)
+			if drv, ok := fields["derivation"].(string); ok {
+				w.keepBuildLogLine(drv, line)
+			}
+		}
+	case resultTypeSetPhase:
+		if phase, ok := stringField(log.Fields, 0); ok {
+			fields["phase"] = phase
+			tflog.Info(w.ctx, "build phase started", fields)
+		}
+	case resultTypeProgress:
+		done, _ := intField(log.Fields, 0)
+		expected, _ := intField(log.Fields, 1)
+		if activity.typ == activityTypeFileTransfer {
+			activity.downloaded, activity.expected = done, expected
+			fields = w.activityFields(log.ID, activity)
+		} else {
+			fields["done"], fields["expected"] = done, expected
+		}
+		tflog.Trace(w.ctx, "progress", fields)
+	}
+}
+
+// activityFields returns the structured fields describing an activity.
+func (w *logWriter) activityFields(id int64, activity *logActivity) map[string]any {
+	fields := map[string]any{
+		"activity_id":   id,
+		"activity_type": activityTypeName(activity.typ),
+	}
+
+	switch activity.typ {
+	case activityTypeBuild:
+		if drv, ok := stringField(activity.fields, 0); ok {
+			fields["derivation"] = drv
+		}
+		if machine, ok := stringField(activity.fields, 1); ok && machine != "" {
+			fields["machine"] = machine
+		}
+	case activityTypeSubstitute:
+		if path, ok := stringField(activity.fields, 0); ok {
+			fields["store_path"] = path
+		}
+		if store, ok := stringField(activity.fields, 1); ok {
+			fields["store"] = store
+		}
+	case activityTypeCopyPath:
+		if path, ok := stringField(activity.fields, 0); ok {
+			fields["store_path"] = path
+		}
+		if from, ok := stringField(activity.fields, 1); ok {
+			fields["from"] = from
+		}
+		if to, ok := stringField(activity.fields, 2); ok {
+			fields["to"] = to
+		}
+	case activityTypeFileTransfer:
+		if uri, ok := stringField(activity.fields, 0); ok {
+			fields["uri"] = uri
+		}
+		fields["bytes_downloaded"] = activity.downloaded
+		if activity.expected > 0 {
+			fields["bytes_expected"] = activity.expected
+		}
+	}
+
+	return fields
+}
+
+func activityTypeName(typ int) string {
+	switch typ {
+	case activityTypeCopyPath:
+		return "copy-path"
+	case activityTypeFileTransfer:
+		return "file-transfer"
+	case activityTypeRealise:
+		return "realise"
+	case activityTypeCopyPaths:
+		return "copy-paths"
+	case activityTypeBuilds:
+		return "builds"
+	case activityTypeBuild:
+		return "build"
+	case activityTypeOptimiseStore:
+		return "optimise-store"
+	case activityTypeVerifyPaths:
+		return "verify-paths"
+	case activityTypeSubstitute:
+		return "substitute"
+	case activityTypeQueryPathInfo:
+		return "query-path-info"
+	case activityTypePostBuildHook:
+		return "post-build-hook"
+	case activityTypeBuildWaiting:
+		return "build-waiting"
+	case activityTypeFetchTree:
+		return "fetch-tree"
+	default:
+		return "unknown"
+	}
+}
+
+func stringField(fields []json.RawMessage, i int) (string, bool) {
+	if i >= len(fields) {
+		return "", false
+	}
+
+	var s string
+	if err := json.Unmarshal(fields[i], &s); err != nil {
+		return "", false
+	}
+
+	return s, true
+}
+
+func intField(fields []json.RawMessage, i int) (int64, bool) {
+	if i >= len(fields) {
+		return 0, false
+	}
+
+	var n int64
+	if err := json.Unmarshal(fields[i], &n); err != nil {
+		return 0, false
+	}
+
+	return n, true
+}
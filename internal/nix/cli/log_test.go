@@ -0,0 +1,101 @@
+package nixcli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func Test_logWriter(t *testing.T) {
+	for name, test := range map[string]struct {
+		lines              []string
+		expectedMessages   string
+		expectedTranscript []string
+		expectedErrors     int
+		expectedBuildLogs  map[string][]string
+	}{
+		"messages by level": {
+			lines: []string{
+				`@nix {"action":"msg","level":0,"msg":"error: \u001b[31mbuild failed\u001b[0m"}`,
+				`@nix {"action":"msg","level":1,"msg":"warning: Git tree '/src' is dirty"}`,
+				`@nix {"action":"msg","level":2,"msg":"this derivation will be built:\n  /nix/store/aaa-hello.drv"}`,
+				`@nix {"action":"msg","level":5,"msg":"evaluating file '/src/flake.nix'"}`,
+			},
+			expectedMessages: "error: build failed\nwarning: Git tree '/src' is dirty",
+			expectedTranscript: []string{
+				"error: build failed",
+				"warning: Git tree '/src' is dirty",
+				"this derivation will be built:",
+				"  /nix/store/aaa-hello.drv",
+				"evaluating file '/src/flake.nix'",
+			},
+			expectedErrors:    1,
+			expectedBuildLogs: map[string][]string{},
+		},
+		"lines that are not json": {
+			lines: []string{
+				"ssh: connect to host remote port 22: Connection refused",
+				`@nix {"action":`,
+			},
+			expectedMessages:  "ssh: connect to host remote port 22: Connection refused\n@nix {\"action\":",
+			expectedBuildLogs: map[string][]string{},
+		},
+		"build logs": {
+			lines: []string{
+				`@nix {"action":"start","id":1,"level":3,"type":105,"text":"building '/nix/store/aaa-hello.drv'","fields":["/nix/store/aaa-hello.drv","",1,1]}`,
+				`@nix {"action":"result","id":1,"type":104,"fields":["buildPhase"]}`,
+				`@nix {"action":"result","id":1,"type":101,"fields":["\u001b[1mcompiling\u001b[0m hello.c"]}`,
+				`@nix {"action":"result","id":2,"type":101,"fields":["unknown activity"]}`,
+				`@nix {"action":"stop","id":1}`,
+				`@nix {"action":"result","id":1,"type":101,"fields":["stopped activity"]}`,
+			},
+			expectedBuildLogs: map[string][]string{"/nix/store/aaa-hello.drv": {"compiling hello.c"}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := newLogWriter(context.Background())
+			for _, line := range test.lines {
+				_, err := w.Write([]byte(line + "\n"))
+				assert.NilError(t, err)
+			}
+			assert.NilError(t, w.Close())
+
+			assert.Equal(t, w.Messages(), test.expectedMessages)
+			assert.DeepEqual(t, w.Transcript(), test.expectedTranscript)
+			assert.Equal(t, len(w.Errors()), test.expectedErrors)
+			assert.DeepEqual(t, w.buildLogs, test.expectedBuildLogs)
+		})
+	}
+
+	t.Run("lines split across writes", func(t *testing.T) {
+		w := newLogWriter(context.Background())
+		for _, chunk := range []string{`@nix {"action":"msg","le`, `vel":1,"msg":"first"}` + "\n" + `@nix {"action":"msg",`, `"level":1,"msg":"second"}`} {
+			_, err := w.Write([]byte(chunk))
+			assert.NilError(t, err)
+		}
+		assert.Equal(t, w.Messages(), "first")
+
+		assert.NilError(t, w.Close())
+		assert.Equal(t, w.Messages(), "first\nsecond")
+	})
+
+	t.Run("kept messages and build log lines are bounded", func(t *testing.T) {
+		w := newLogWriter(context.Background())
+		_, _ = w.Write([]byte(`@nix {"action":"start","id":1,"type":105,"fields":["/nix/store/aaa-hello.drv"]}` + "\n"))
+		for i := range maxLogMessages + 10 {
+			_, _ = fmt.Fprintf(w, `@nix {"action":"msg","level":1,"msg":"warning %d"}`+"\n", i)
+			_, _ = fmt.Fprintf(w, `@nix {"action":"result","id":1,"type":101,"fields":["line %d"]}`+"\n", i)
+		}
+
+		messages := strings.Split(w.Messages(), "\n")
+		assert.Equal(t, len(messages), maxLogMessages)
+		assert.Equal(t, messages[0], "warning 10")
+
+		buildLogs := w.BuildLogTail("/nix/store/aaa-hello.drv")
+		assert.Equal(t, len(buildLogs), maxBuildLogLines)
+		assert.Equal(t, buildLogs[len(buildLogs)-1], fmt.Sprintf("line %d", maxLogMessages+9))
+	})
+}
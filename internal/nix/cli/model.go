@@ -2,21 +2,98 @@ package nixcli
 
 import (
 	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
 	"slices"
+	"strconv"
+	"strings"
 
 	"golang.org/x/exp/maps"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
 )
 
 type cmdPathInfoOutput []cmdPathInfoOutputStorePath
 
+// UnmarshalJSON implements json.Unmarshaler.
+// It handles the list format of nix < 2.19, and the object format keyed by store path of newer versions.
+func (o *cmdPathInfoOutput) UnmarshalJSON(raw []byte) error {
+	var list []cmdPathInfoOutputStorePath
+	if err := json.Unmarshal(raw, &list); err == nil {
+		*o = list
+		return nil
+	}
+
+	var object map[string]*cmdPathInfoOutputStorePath
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return err
+	}
+
+	paths := maps.Keys(object)
+	slices.Sort(paths)
+
+	list = make([]cmdPathInfoOutputStorePath, 0, len(paths))
+	for _, path := range paths {
+		storePath := object[path]
+		if storePath == nil { // invalid paths are null
+			valid := false
+			storePath = &cmdPathInfoOutputStorePath{Valid: &valid}
+		}
+		storePath.Path = path
+		list = append(list, *storePath)
+	}
+
+	*o = list
+	return nil
+}
+
+// storePath returns the store path the installable resolves to: the path itself for store paths,
+// or the only path of the output for other installables.
+func (o cmdPathInfoOutput) storePath(installable string) (cmdPathInfoOutputStorePath, error) {
+	for _, storePath := range o {
+		if storePath.Path == installable {
+			return storePath, nil
+		}
+	}
+
+	if len(o) != 1 {
+		return cmdPathInfoOutputStorePath{}, fmt.Errorf("installable %q resolves to %d store paths, expected one", installable, len(o))
+	}
+	return o[0], nil
+}
+
 type cmdPathInfoOutputStorePath struct {
+	CA               string   `json:"ca"`
 	Deriver          string   `json:"deriver"`
 	NarHash          string   `json:"narHash"`
-	NarSize          int      `json:"narSize"`
+	NarSize          int64    `json:"narSize"`
 	Path             string   `json:"path"`
 	References       []string `json:"references"`
-	RegistrationTime int      `json:"registrationTime"`
-	Valid            bool     `json:"valid"`
+	RegistrationTime int64    `json:"registrationTime"`
+	Signatures       []string `json:"signatures"`
+	Valid            *bool    `json:"valid"`
+}
+
+// valid returns whether the store path is valid, nix only sets the valid field for invalid paths.
+func (o cmdPathInfoOutputStorePath) valid() bool {
+	return o.Valid == nil || *o.Valid
+}
+
+// pathInfo converts the store path to its nix representation, closure related fields are not set.
+func (o cmdPathInfoOutputStorePath) pathInfo() nix.PathInfo {
+	return nix.PathInfo{
+		Path:             o.Path,
+		Valid:            o.valid(),
+		NarHash:          o.NarHash,
+		NarSize:          o.NarSize,
+		Signatures:       o.Signatures,
+		References:       o.References,
+		Deriver:          o.Deriver,
+		ContentAddress:   o.CA,
+		RegistrationTime: o.RegistrationTime,
+	}
 }
 
 type cmdDerivationShowOutput map[string]cmdDerivationShowOutputDerivation
@@ -35,10 +112,59 @@ type cmdDerivationShowOutputDerivation struct {
 		Path          string `json:"path"`
 		HashAlgorithm string `json:"hashAlgo"`
 		Hash          string `json:"hash"`
+		Method        string `json:"method"`
+		Impure        bool   `json:"impure"`
 	} `json:"outputs"`
 	System string `json:"system"`
 }
 
+func (o cmdDerivationShowOutputDerivation) derivation(derivationPath string) nix.Derivation {
+	derivation := nix.Derivation{
+		Name: o.Name,
+		Path: nix.StorePath{
+			Derivation: derivationPath,
+			Output:     o.outputPath(),
+			Outputs:    o.outputPaths(),
+		},
+		System:           o.System,
+		Builder:          o.Builder,
+		Args:             o.Args,
+		Env:              o.Env,
+		InputDerivations: make(map[string][]string, len(o.InputDrvs)),
+		InputSources:     o.InputSrcs,
+		Outputs:          make(map[string]nix.DerivationOutput, len(o.Outputs)),
+	}
+
+	for path, input := range o.InputDrvs {
+		derivation.InputDerivations[path] = input.Outputs
+	}
+
+	for name, output := range o.Outputs {
+		// recent nix versions give the ingestion method apart from the algorithm, older ones prefix recursive algorithms with r:
+		hashAlgorithm := output.HashAlgorithm
+		if output.Method == "nar" && hashAlgorithm != "" && !strings.HasPrefix(hashAlgorithm, "r:") {
+			hashAlgorithm = "r:" + hashAlgorithm
+		}
+
+		derivation.Outputs[name] = nix.DerivationOutput{
+			Path:          output.Path,
+			HashAlgorithm: hashAlgorithm,
+			Hash:          output.Hash,
+			Impure:        output.Impure,
+		}
+	}
+
+	return derivation
+}
+
+func (o cmdDerivationShowOutputDerivation) outputPaths() map[string]string {
+	paths := make(map[string]string, len(o.Outputs))
+	for name, output := range o.Outputs {
+		paths[name] = output.Path
+	}
+	return paths
+}
+
 func (o cmdDerivationShowOutputDerivation) outputPath() string {
 	if o.Outputs == nil {
 		return ""
@@ -83,3 +209,271 @@ func (o cmdBuildDerivationOutputDerivation) outputPath() string {
 	slices.SortStableFunc(keys, cmp.Compare[string])
 	return o.Outputs[keys[0]]
 }
+
+type cmdFlakeMetadataOutput struct {
+	Description  string          `json:"description"`
+	LastModified int64           `json:"lastModified"`
+	Locked       flakeAttrs      `json:"locked"`
+	Locks        json.RawMessage `json:"locks"`
+	OriginalURL  string          `json:"originalUrl"`
+	Path         string          `json:"path"`
+	ResolvedURL  string          `json:"resolvedUrl"`
+	RevCount     int64           `json:"revCount"`
+	Revision     string          `json:"revision"`
+	URL          string          `json:"url"`
+}
+
+func (o cmdFlakeMetadataOutput) flakeMetadata() (*nix.FlakeMetadata, error) {
+	var lockFile flakeLockFile
+	if err := json.Unmarshal(o.Locks, &lockFile); err != nil {
+		return nil, fmt.Errorf("unable to decode lock file: %v", err)
+	}
+
+	return &nix.FlakeMetadata{
+		Description:  o.Description,
+		OriginalURL:  o.OriginalURL,
+		ResolvedURL:  o.ResolvedURL,
+		LockedURL:    o.URL,
+		Revision:     o.Revision,
+		RevCount:     o.RevCount,
+		LastModified: o.LastModified,
+		NarHash:      o.Locked["narHash"],
+		Path:         o.Path,
+		Inputs:       lockFile.inputs(),
+		LockFile:     o.Locks,
+	}, nil
+}
+
+type flakeLockFile struct {
+	Nodes   map[string]flakeLockNode `json:"nodes"`
+	Root    string                   `json:"root"`
+	Version int                      `json:"version"`
+}
+
+type flakeLockNode struct {
+	Flake    *bool                        `json:"flake"`
+	Inputs   map[string]flakeLockInputRef `json:"inputs"`
+	Locked   flakeAttrs                   `json:"locked"`
+	Original flakeAttrs                   `json:"original"`
+}
+
+// flakeLockInputRef references the node of an input, or the path of the followed input.
+type flakeLockInputRef struct {
+	Node    string
+	Follows []string
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+// Inputs are references to a node key, or a list of input names for inputs following another input.
+func (r *flakeLockInputRef) UnmarshalJSON(raw []byte) error {
+	if err := json.Unmarshal(raw, &r.Node); err == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, &r.Follows)
+}
+
+// inputs walks the lock file from its root node, and returns every input indexed by its path.
+func (l flakeLockFile) inputs() map[string]nix.FlakeInput {
+	root := l.Root
+	if root == "" {
+		root = "root"
+	}
+
+	inputs := make(map[string]nix.FlakeInput)
+	visiting := make(map[string]bool)
+
+	var walk func(key string, prefix string)
+	walk = func(key string, prefix string) {
+		visiting[key] = true
+		defer delete(visiting, key)
+
+		for name, ref := range l.Nodes[key].Inputs {
+			inputPath := prefix + name
+			if ref.Follows != nil {
+				inputs[inputPath] = nix.FlakeInput{Follows: strings.Join(ref.Follows, "/")}
+				continue
+			}
+
+			node := l.Nodes[ref.Node]
+			inputs[inputPath] = nix.FlakeInput{
+				Locked:       node.Locked,
+				Original:     node.Original,
+				Type:         node.Locked["type"],
+				Revision:     node.Locked["rev"],
+				LastModified: node.Locked.int("lastModified"),
+				NarHash:      node.Locked["narHash"],
+				Flake:        node.Flake == nil || *node.Flake,
+			}
+
+			if !visiting[ref.Node] {
+				walk(ref.Node, inputPath+"/")
+			}
+		}
+	}
+	walk(root, "")
+
+	return inputs
+}
+
+// flakeAttrs are the attributes of a flake reference, values that are not strings are kept in their json representation.
+type flakeAttrs map[string]string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *flakeAttrs) UnmarshalJSON(raw []byte) error {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return err
+	}
+
+	attrs := make(flakeAttrs, len(values))
+	for key, value := range values {
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			s = string(value)
+		}
+		attrs[key] = s
+	}
+
+	*a = attrs
+	return nil
+}
+
+func (a flakeAttrs) int(key string) int64 {
+	i, _ := strconv.ParseInt(a[key], 10, 64)
+	return i
+}
+
+// cmdFlakeShowOutput is the tree of flake outputs, leaves are objects with a type attribute.
+type cmdFlakeShowOutput map[string]json.RawMessage
+
+type cmdFlakeShowOutputLeaf struct {
+	Type        *string `json:"type"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+}
+
+// perSystemFlakeOutputs are the flake outputs whose attributes are systems.
+var perSystemFlakeOutputs = []string{"apps", "checks", "devShells", "formatter", "legacyPackages", "packages"}
+
+// flakeOutputs walks the tree and returns its leaves sorted by attribute path.
+// Per system outputs of other systems are empty unless all systems are shown, they are skipped.
+func (o cmdFlakeShowOutput) flakeOutputs() ([]nix.FlakeOutput, error) {
+	var (
+		outputs []nix.FlakeOutput
+		walk    func(attrPath []string, node cmdFlakeShowOutput) error
+	)
+
+	walk = func(attrPath []string, node cmdFlakeShowOutput) error {
+		names := maps.Keys(node)
+		slices.Sort(names)
+
+		for _, name := range names {
+			childPath := append(slices.Clone(attrPath), name)
+
+			var leaf cmdFlakeShowOutputLeaf
+			if err := json.Unmarshal(node[name], &leaf); err == nil && leaf.Type != nil {
+				output := nix.FlakeOutput{
+					AttributePath:  childPath,
+					Type:           *leaf.Type,
+					DerivationName: leaf.Name,
+					Description:    leaf.Description,
+				}
+				if len(childPath) >= 2 && slices.Contains(perSystemFlakeOutputs, childPath[0]) {
+					output.System = childPath[1]
+				}
+				outputs = append(outputs, output)
+				continue
+			}
+
+			var child cmdFlakeShowOutput
+			if err := json.Unmarshal(node[name], &child); err != nil {
+				return fmt.Errorf("unable to decode output %s: %v", strings.Join(childPath, "."), err)
+			}
+			if err := walk(childPath, child); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := walk(nil, o); err != nil {
+		return nil, err
+	}
+
+	return outputs, nil
+}
+
+var (
+	dryRunBuiltHeader   = regexp.MustCompile(`^(this derivation|these \d+ derivations) will be built:$`)
+	dryRunFetchedHeader = regexp.MustCompile(`^(this path|these \d+ paths) will be fetched \(([\d.]+ (?:B|[KMGT]iB)) download, ([\d.]+ (?:B|[KMGT]iB)) unpacked\):$`)
+	dryRunHeader        = regexp.MustCompile(`will be (built|fetched)`)
+)
+
+// parseDryRun reads the build plan from the messages nix writes when building with --dry-run, like:
+//
+//	these 2 derivations will be built:
+//	  /nix/store/...-hello-2.12.1.drv
+//	  /nix/store/...-hello-wrapped.drv
+//	this path will be fetched (0.05 MiB download, 0.21 MiB unpacked):
+//	  /nix/store/...-glibc-2.39
+//
+// Sizes are the ones printed by nix, rounded to two decimals of their unit.
+// An error is returned for messages announcing store paths in an unknown format, instead of ignoring them.
+func parseDryRun(lines []string) (*nix.BuildPlan, error) {
+	var (
+		plan    nix.BuildPlan
+		section *[]string
+	)
+
+	for _, line := range lines {
+		if path, isPath := strings.CutPrefix(line, "  "); isPath && section != nil {
+			*section = append(*section, strings.TrimSpace(path))
+			continue
+		}
+
+		section = nil
+		line = strings.TrimSpace(line)
+		if dryRunBuiltHeader.MatchString(line) {
+			section = &plan.Derivations
+		} else if match := dryRunFetchedHeader.FindStringSubmatch(line); match != nil {
+			section = &plan.Fetched
+			var err error
+			if plan.DownloadSize, err = parseSize(match[2]); err != nil {
+				return nil, fmt.Errorf("unable to parse download size of %q: %v", line, err)
+			}
+			if plan.UnpackedSize, err = parseSize(match[3]); err != nil {
+				return nil, fmt.Errorf("unable to parse unpacked size of %q: %v", line, err)
+			}
+		} else if dryRunHeader.MatchString(line) {
+			return nil, fmt.Errorf("unable to parse build plan message %q", line)
+		}
+	}
+
+	for _, path := range slices.Concat(plan.Derivations, plan.Fetched) {
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("unable to parse build plan store path %q", path)
+		}
+	}
+
+	slices.Sort(plan.Derivations)
+	slices.Sort(plan.Fetched)
+	return &plan, nil
+}
+
+// parseSize converts a size printed by nix, like 0.21 MiB, to bytes. Nix prints sizes in binary units only.
+func parseSize(s string) (int64, error) {
+	value, unit, _ := strings.Cut(s, " ")
+	size, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	multipliers := map[string]float64{"B": 1, "KiB": 1 << 10, "MiB": 1 << 20, "GiB": 1 << 30, "TiB": 1 << 40}
+	multiplier, known := multipliers[unit]
+	if !known {
+		return 0, fmt.Errorf("unknown unit %q", unit)
+	}
+
+	return int64(math.Round(size * multiplier)), nil
+}
@@ -0,0 +1,287 @@
+package nixcli
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+func Test_parseDryRun(t *testing.T) {
+	for name, test := range map[string]struct {
+		lines       []string
+		expected    *nix.BuildPlan
+		expectedErr string
+	}{
+		"nothing to do": {
+			lines:    nil,
+			expected: &nix.BuildPlan{},
+		},
+		"derivations to build and paths to fetch": {
+			lines: []string{
+				"these 2 derivations will be built:",
+				"  /nix/store/bbb-hello-wrapped.drv",
+				"  /nix/store/aaa-hello-2.12.1.drv",
+				"this path will be fetched (0.05 MiB download, 0.21 MiB unpacked):",
+				"  /nix/store/ccc-glibc-2.39",
+			},
+			expected: &nix.BuildPlan{
+				Derivations:  []string{"/nix/store/aaa-hello-2.12.1.drv", "/nix/store/bbb-hello-wrapped.drv"},
+				Fetched:      []string{"/nix/store/ccc-glibc-2.39"},
+				DownloadSize: 52429,
+				UnpackedSize: 220201,
+			},
+		},
+		"sizes in other units": {
+			lines: []string{
+				"these 2 paths will be fetched (12.50 KiB download, 1.00 GiB unpacked):",
+				"  /nix/store/aaa-glibc-2.39",
+				"  /nix/store/bbb-bash-5.2",
+			},
+			expected: &nix.BuildPlan{
+				Fetched:      []string{"/nix/store/aaa-glibc-2.39", "/nix/store/bbb-bash-5.2"},
+				DownloadSize: 12800,
+				UnpackedSize: 1 << 30,
+			},
+		},
+		"unrelated messages": {
+			lines: []string{
+				"warning: Git tree '/src' is dirty",
+				"this derivation will be built:",
+				"  /nix/store/aaa-hello.drv",
+				"copying path '/nix/store/bbb-source' from 'https://cache.nixos.org'",
+			},
+			expected: &nix.BuildPlan{Derivations: []string{"/nix/store/aaa-hello.drv"}},
+		},
+		"unknown header format": {
+			lines: []string{
+				"these 2 paths will be fetched (12.50 kB download):",
+				"  /nix/store/aaa-glibc-2.39",
+			},
+			expectedErr: "unable to parse build plan message",
+		},
+		"decimal size units": {
+			lines: []string{
+				"this path will be fetched (12.50 KB download, 1.00 KB unpacked):",
+				"  /nix/store/aaa-glibc-2.39",
+			},
+			expectedErr: "unable to parse build plan message",
+		},
+		"decimal and binary size units": {
+			lines: []string{
+				"this path will be fetched (12.50 MB download, 1.00 MiB unpacked):",
+				"  /nix/store/aaa-glibc-2.39",
+			},
+			expectedErr: "unable to parse build plan message",
+		},
+		"unknown path format": {
+			lines: []string{
+				"this derivation will be built:",
+				"  - /nix/store/aaa-hello.drv",
+			},
+			expectedErr: "unable to parse build plan store path",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			plan, err := parseDryRun(test.lines)
+			if test.expectedErr != "" {
+				assert.ErrorContains(t, err, test.expectedErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, plan, test.expected)
+		})
+	}
+}
+
+func Test_cmdPathInfoOutput_UnmarshalJSON(t *testing.T) {
+	valid, invalid := true, false
+
+	for name, test := range map[string]struct {
+		raw      string
+		expected cmdPathInfoOutput
+	}{
+		"list format": {
+			raw: `[{"path":"/nix/store/bbb-hello","narSize":12,"references":["/nix/store/aaa-glibc"]},{"path":"/nix/store/ccc-missing","valid":false}]`,
+			expected: cmdPathInfoOutput{
+				{Path: "/nix/store/bbb-hello", NarSize: 12, References: []string{"/nix/store/aaa-glibc"}},
+				{Path: "/nix/store/ccc-missing", Valid: &invalid},
+			},
+		},
+		"object format": {
+			raw: `{"/nix/store/bbb-hello":{"narSize":12,"references":["/nix/store/aaa-glibc"]},"/nix/store/aaa-glibc":{"narSize":30,"valid":true}}`,
+			expected: cmdPathInfoOutput{
+				{Path: "/nix/store/aaa-glibc", NarSize: 30, Valid: &valid},
+				{Path: "/nix/store/bbb-hello", NarSize: 12, References: []string{"/nix/store/aaa-glibc"}},
+			},
+		},
+		"object format with invalid paths": {
+			raw:      `{"/nix/store/ccc-missing":null}`,
+			expected: cmdPathInfoOutput{{Path: "/nix/store/ccc-missing", Valid: &invalid}},
+		},
+		"empty": {
+			raw:      `[]`,
+			expected: cmdPathInfoOutput{},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var output cmdPathInfoOutput
+			assert.NilError(t, json.Unmarshal([]byte(test.raw), &output))
+			assert.DeepEqual(t, output, test.expected)
+		})
+	}
+
+	t.Run("unexpected format", func(t *testing.T) {
+		var output cmdPathInfoOutput
+		assert.Check(t, json.Unmarshal([]byte(`"/nix/store/bbb-hello"`), &output) != nil)
+	})
+}
+
+func Test_flakeLockFile_inputs(t *testing.T) {
+	for name, test := range map[string]struct {
+		raw      string
+		expected map[string]nix.FlakeInput
+	}{
+		"no inputs": {
+			raw:      `{"nodes":{"root":{}},"root":"root","version":7}`,
+			expected: map[string]nix.FlakeInput{},
+		},
+		"nested and followed inputs": {
+			raw: `{
+				"nodes": {
+					"root": {"inputs": {"nixpkgs": "nixpkgs", "home-manager": "home-manager"}},
+					"nixpkgs": {
+						"locked": {"type": "github", "owner": "NixOS", "repo": "nixpkgs", "rev": "abc", "lastModified": 1700000000, "narHash": "sha256-nixpkgs"},
+						"original": {"type": "github", "owner": "NixOS", "repo": "nixpkgs"}
+					},
+					"home-manager": {
+						"inputs": {"nixpkgs": ["nixpkgs"], "src": "src"},
+						"locked": {"type": "github", "rev": "def"},
+						"original": {"type": "github"}
+					},
+					"src": {"flake": false, "locked": {"type": "path", "path": "/src"}, "original": {"type": "path", "path": "/src"}}
+				},
+				"root": "root",
+				"version": 7
+			}`,
+			expected: map[string]nix.FlakeInput{
+				"nixpkgs": {
+					Locked:       map[string]string{"type": "github", "owner": "NixOS", "repo": "nixpkgs", "rev": "abc", "lastModified": "1700000000", "narHash": "sha256-nixpkgs"},
+					Original:     map[string]string{"type": "github", "owner": "NixOS", "repo": "nixpkgs"},
+					Type:         "github",
+					Revision:     "abc",
+					LastModified: 1700000000,
+					NarHash:      "sha256-nixpkgs",
+					Flake:        true,
+				},
+				"home-manager": {
+					Locked:   map[string]string{"type": "github", "rev": "def"},
+					Original: map[string]string{"type": "github"},
+					Type:     "github",
+					Revision: "def",
+					Flake:    true,
+				},
+				"home-manager/nixpkgs": {Follows: "nixpkgs"},
+				"home-manager/src": {
+					Locked:   map[string]string{"type": "path", "path": "/src"},
+					Original: map[string]string{"type": "path", "path": "/src"},
+					Type:     "path",
+				},
+			},
+		},
+		"cyclic inputs": {
+			raw: `{
+				"nodes": {
+					"root": {"inputs": {"self": "root"}},
+					"other": {}
+				},
+				"version": 7
+			}`,
+			expected: map[string]nix.FlakeInput{"self": {Flake: true}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var lockFile flakeLockFile
+			assert.NilError(t, json.Unmarshal([]byte(test.raw), &lockFile))
+			assert.DeepEqual(t, lockFile.inputs(), test.expected)
+		})
+	}
+}
+
+func Test_cmdFlakeShowOutput_flakeOutputs(t *testing.T) {
+	for name, test := range map[string]struct {
+		raw         string
+		expected    []nix.FlakeOutput
+		expectedErr string
+	}{
+		"no outputs": {
+			raw:      `{}`,
+			expected: nil,
+		},
+		"outputs": {
+			raw: `{
+				"packages": {
+					"x86_64-linux": {"hello": {"type": "derivation", "name": "hello-2.12.1", "description": "A program that produces a familiar, friendly greeting"}},
+					"aarch64-darwin": {}
+				},
+				"nixosConfigurations": {"host": {"type": "nixos-configuration"}},
+				"lib": {"type": "unknown"}
+			}`,
+			expected: []nix.FlakeOutput{
+				{AttributePath: []string{"lib"}, Type: "unknown"},
+				{AttributePath: []string{"nixosConfigurations", "host"}, Type: "nixos-configuration"},
+				{
+					AttributePath:  []string{"packages", "x86_64-linux", "hello"},
+					System:         "x86_64-linux",
+					Type:           "derivation",
+					DerivationName: "hello-2.12.1",
+					Description:    "A program that produces a familiar, friendly greeting",
+				},
+			},
+		},
+		"unexpected node": {
+			raw:         `{"packages": {"x86_64-linux": ["hello"]}}`,
+			expectedErr: "unable to decode output packages.x86_64-linux",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var output cmdFlakeShowOutput
+			assert.NilError(t, json.Unmarshal([]byte(test.raw), &output))
+
+			outputs, err := output.flakeOutputs()
+			if test.expectedErr != "" {
+				assert.ErrorContains(t, err, test.expectedErr)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, outputs, test.expected)
+		})
+	}
+}
+
+func Test_parseSize(t *testing.T) {
+	for size, expected := range map[string]int64{
+		"512 B":       512,
+		"12.50 KiB":   12800,
+		"0.21 MiB":    220201,
+		"1.00 GiB":    1 << 30,
+		"2.00 TiB":    2 << 40,
+		"0.00 B":      0,
+		"1024.00 KiB": 1 << 20,
+	} {
+		t.Run(size, func(t *testing.T) {
+			parsed, err := parseSize(size)
+			assert.NilError(t, err)
+			assert.Equal(t, parsed, expected)
+		})
+	}
+
+	for _, size := range []string{"12.50 KB", "1.00 MB", "1.00 GB", "1.00 TB", "12 kB", "1.00", "many MiB"} {
+		t.Run(size, func(t *testing.T) {
+			_, err := parseSize(size)
+			assert.Assert(t, err != nil)
+		})
+	}
+}
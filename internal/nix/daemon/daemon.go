@@ -0,0 +1,332 @@
+// Package nixdaemon implements the nix interface by speaking the worker protocol with the nix daemon over its unix socket.
+// Store queries don't spawn any process, operations requiring evaluation are delegated to another implementation.
+package nixdaemon
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+const (
+	// DefaultSocket is the path of the nix daemon socket when not configured, and not set in NIX_DAEMON_SOCKET_PATH.
+	DefaultSocket = "/nix/var/nix/daemon-socket/socket"
+
+	storeDir = "/nix/store"
+	// maxIdleConns is the number of connections kept open to be reused by later operations.
+	maxIdleConns = 8
+)
+
+// Config defines the configuration of the daemon client.
+type Config struct {
+	// Socket is the path of the nix daemon unix socket.
+	Socket string
+	// GCRootDir is the directory in which garbage collector roots are created.
+	GCRootDir string
+	// FallbackBuilds builds every installable with the fallback implementation,
+	// for builds to follow its configuration (like remote builders) instead of the daemon one.
+	FallbackBuilds bool
+}
+
+type daemon struct {
+	// Nix handles operations the daemon can't, like evaluations or operations on other stores.
+	nix.Nix
+
+	config Config
+	dial   func(ctx context.Context) (net.Conn, error)
+
+	m    sync.Mutex
+	idle []*conn
+}
+
+// New creates a nix implementation talking to the nix daemon for store operations on the daemon store,
+// and relying on fallback for everything else.
+func New(config Config, fallback nix.Nix) nix.Nix {
+	if config.Socket == "" {
+		config.Socket = os.Getenv("NIX_DAEMON_SOCKET_PATH")
+	}
+	if config.Socket == "" {
+		config.Socket = DefaultSocket
+	}
+
+	return &daemon{
+		Nix:    fallback,
+		config: config,
+		dial: func(ctx context.Context) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", config.Socket)
+		},
+	}
+}
+
+// Build builds store paths, and derivations referenced by their path, using the daemon.
+// Other installables need to be evaluated and, like builds tuned by build options or for another system, are built by the fallback implementation.
+func (d *daemon) Build(ctx context.Context, req nix.BuildRequest) (*nix.StorePath, error) {
+	storePath, outputs, _ := strings.Cut(req.Installable, "^")
+	if d.config.FallbackBuilds || !isStorePath(storePath) || req.Expression != "" || req.System != "" || !req.Options.IsZero() {
+		return d.Nix.Build(ctx, req)
+	}
+
+	var outputNames []string
+	if outputs != "" && outputs != "*" {
+		outputNames = strings.Split(outputs, ",")
+	}
+
+	if !strings.HasSuffix(storePath, ".drv") {
+		err := d.withConn(ctx, func(c *conn) error {
+			if err := c.buildPaths(ctx, storePath, nil); err != nil {
+				return fmt.Errorf("unable to realise %s: %w", storePath, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		// like the nix cli, store paths are reported as the default output
+		return &nix.StorePath{Output: storePath, Outputs: map[string]string{"out": storePath}}, nil
+	}
+
+	derivation, err := d.Nix.DescribeDerivation(ctx, storePath, nix.EvaluationOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	result := nix.StorePath{Derivation: storePath, Outputs: make(map[string]string)}
+	if len(outputNames) == 0 {
+		result.Output, result.Outputs = derivation.Path.Output, derivation.Path.Outputs
+		outputNames = []string{"*"}
+	} else {
+		for _, name := range outputNames {
+			output, exists := derivation.Path.Outputs[name]
+			if !exists {
+				return nil, fmt.Errorf("derivation %s has no output named %q", storePath, name)
+			}
+			result.Outputs[name] = output
+		}
+		result.Output = result.Outputs[outputNames[0]]
+		if out, exists := result.Outputs["out"]; exists {
+			result.Output = out
+		}
+	}
+
+	err = d.withConn(ctx, func(c *conn) error {
+		if err := c.buildPaths(ctx, storePath, outputNames); err != nil {
+			var remoteErr *remoteError
+			if errors.As(err, &remoteErr) {
+				return &nix.BuildError{Message: remoteErr.Error(), Derivation: storePath}
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// GetStorePath queries store paths using the daemon, other installables are handled by the fallback implementation.
+func (d *daemon) GetStorePath(ctx context.Context, installable string) (bool, *nix.StorePath, error) {
+	if !isStorePath(installable) {
+		return d.Nix.GetStorePath(ctx, installable)
+	}
+
+	var info *pathInfo
+	if err := d.withConn(ctx, func(c *conn) (err error) {
+		info, err = c.queryPathInfo(ctx, installable)
+		return err
+	}); err != nil {
+		return false, nil, fmt.Errorf("unable to query %s info: %w", installable, err)
+	}
+
+	if info == nil {
+		return false, nil, nil
+	}
+
+	return true, &nix.StorePath{Derivation: info.Deriver, Output: installable}, nil
+}
+
+// GetRemoteStorePath queries store paths of the daemon store using the daemon, other stores are handled by the fallback implementation.
+func (d *daemon) GetRemoteStorePath(ctx context.Context, req nix.RemoteStorePathRequest) (*nix.PathInfo, error) {
+	if !isStorePath(req.Installable) || !d.isDaemonStore(req.Store) {
+		return d.Nix.GetRemoteStorePath(ctx, req)
+	}
+
+	result := nix.PathInfo{Path: req.Installable}
+	err := d.withConn(ctx, func(c *conn) error {
+		info, err := c.queryPathInfo(ctx, req.Installable)
+		if err != nil || info == nil {
+			return err
+		}
+
+		result = info.pathInfo(req.Installable)
+
+		// walk the closure until a missing store path is found
+		closureSize := result.NarSize
+		seen := map[string]bool{req.Installable: true}
+		queue := info.References
+		for len(queue) > 0 {
+			storePath := queue[0]
+			queue = queue[1:]
+			if seen[storePath] {
+				continue
+			}
+			seen[storePath] = true
+
+			info, err := c.queryPathInfo(ctx, storePath)
+			if err != nil {
+				return err
+			}
+			if info == nil {
+				return nil
+			}
+			closureSize += int64(info.NarSize)
+			queue = append(queue, info.References...)
+		}
+
+		result.ClosureComplete = true
+		result.ClosureSize = closureSize
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to query %s info: %w", req.Installable, err)
+	}
+
+	return &result, nil
+}
+
+// GetClosure queries the closure of store paths of the daemon store using the daemon, other stores are handled by the fallback implementation.
+func (d *daemon) GetClosure(ctx context.Context, req nix.RemoteStorePathRequest) ([]nix.PathInfo, error) {
+	if !isStorePath(req.Installable) || !d.isDaemonStore(req.Store) {
+		return d.Nix.GetClosure(ctx, req)
+	}
+
+	var closure []nix.PathInfo
+	err := d.withConn(ctx, func(c *conn) error {
+		seen := make(map[string]bool)
+		queue := []string{req.Installable}
+		for len(queue) > 0 {
+			storePath := queue[0]
+			queue = queue[1:]
+			if seen[storePath] {
+				continue
+			}
+			seen[storePath] = true
+
+			info, err := c.queryPathInfo(ctx, storePath)
+			if err != nil {
+				return err
+			}
+			if info == nil {
+				return &nix.MissingStorePathError{Message: fmt.Sprintf("path '%s' is not valid", storePath), Path: storePath}
+			}
+
+			closure = append(closure, info.pathInfo(storePath))
+			queue = append(queue, info.References...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to query %s closure: %w", req.Installable, err)
+	}
+
+	slices.SortFunc(closure, func(a, b nix.PathInfo) int { return cmp.Compare(a.Path, b.Path) })
+	return closure, nil
+}
+
+// withConn runs f with a connection to the daemon, reusing idle connections when possible.
+// The connection is interrupted if the context is done.
+func (d *daemon) withConn(ctx context.Context, f func(c *conn) error) error {
+	c, err := d.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	stop := context.AfterFunc(ctx, func() { _ = c.conn.SetDeadline(time.Unix(1, 0)) })
+	err = f(c)
+	if !stop() {
+		// the deadline may have been set while f was running, the connection can't be trusted anymore
+		c.broken = true
+		if err != nil {
+			err = errors.Join(ctx.Err(), err)
+		}
+	}
+
+	d.release(c)
+	return err
+}
+
+func (d *daemon) acquire(ctx context.Context) (*conn, error) {
+	d.m.Lock()
+	if n := len(d.idle); n > 0 {
+		c := d.idle[n-1]
+		d.idle = d.idle[:n-1]
+		d.m.Unlock()
+		return c, nil
+	}
+	d.m.Unlock()
+
+	nc, err := d.dial(ctx)
+	if err != nil {
+		return nil, &nix.ConnectionError{Message: err.Error(), Store: "unix://" + d.config.Socket}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = nc.SetDeadline(deadline)
+	}
+
+	c, err := handshake(ctx, nc)
+	if err != nil {
+		_ = nc.Close()
+		return nil, &nix.ConnectionError{Message: fmt.Sprintf("handshake failed: %v", err), Store: "unix://" + d.config.Socket}
+	}
+
+	_ = nc.SetDeadline(time.Time{})
+	return c, nil
+}
+
+func (d *daemon) release(c *conn) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if c.broken || len(d.idle) >= maxIdleConns {
+		_ = c.conn.Close()
+		return
+	}
+
+	d.idle = append(d.idle, c)
+}
+
+// isDaemonStore returns whether the store url designates the store of the daemon, the default store being the store of the daemon.
+func (d *daemon) isDaemonStore(store string) bool {
+	store, _, _ = strings.Cut(store, "?")
+	return store == "" || store == "daemon" || store == "unix://"+d.config.Socket
+}
+
+// isStorePath returns whether s is a top level store path, like /nix/store/<hash>-<name>.
+func isStorePath(s string) bool {
+	name, found := strings.CutPrefix(s, storeDir+"/")
+	return found && name != "" && !strings.Contains(name, "/")
+}
+
+// sriHash converts a base16 sha256 hash, as sent by the daemon, to the SRI format used by the nix cli.
+func sriHash(hash string) string {
+	hash = strings.TrimPrefix(hash, "sha256:")
+	raw, err := hex.DecodeString(hash)
+	if err != nil {
+		return hash
+	}
+	return "sha256-" + base64.StdEncoding.EncodeToString(raw)
+}
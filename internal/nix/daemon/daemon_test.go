@@ -0,0 +1,642 @@
+package nixdaemon
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+	"github.com/krostar/terraform-provider-nix/internal/nix/fake"
+)
+
+// fakeServer is an in-memory nix daemon, speaking the worker protocol over net.Pipe connections.
+type fakeServer struct {
+	t       *testing.T
+	version uint64
+
+	m             sync.Mutex
+	paths         map[string]*pathInfo
+	tempRoots     []string
+	indirectRoots []string
+	builds        []string
+	buildError    string
+	dials         int
+}
+
+func newFakeServer(t *testing.T, version uint64) *fakeServer {
+	return &fakeServer{t: t, version: version, paths: make(map[string]*pathInfo)}
+}
+
+func (s *fakeServer) addPath(storePath string, references ...string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.paths[storePath] = &pathInfo{
+		Deriver:          storePath + ".drv",
+		NarHash:          "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		References:       append([]string{storePath}, references...),
+		NarSize:          42,
+		Signatures:       []string{"cache.nixos.org-1:sig"},
+		RegistrationTime: 1700000000,
+	}
+}
+
+// daemon returns a daemon client connecting to the fake server, using fallback for operations it does not handle.
+func (s *fakeServer) daemon(config Config, fallback nix.Nix) *daemon {
+	return &daemon{
+		Nix:    fallback,
+		config: config,
+		dial: func(context.Context) (net.Conn, error) {
+			client, server := net.Pipe()
+			s.m.Lock()
+			s.dials++
+			s.m.Unlock()
+			go s.serve(server)
+			return client, nil
+		},
+	}
+}
+
+func (s *fakeServer) serve(nc net.Conn) {
+	defer nc.Close()
+
+	c := &conn{conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	if err := s.handshake(c); err != nil {
+		return
+	}
+
+	for {
+		op, err := c.readUint64()
+		if err != nil {
+			return
+		}
+		if err := s.handle(c, op); err != nil {
+			s.t.Errorf("fake server unable to handle operation %d: %v", op, err)
+			return
+		}
+	}
+}
+
+func (s *fakeServer) handshake(c *conn) error {
+	if magic, err := c.readUint64(); err != nil || magic != workerMagic1 {
+		return fmt.Errorf("bad magic: %v", err)
+	}
+
+	c.writeUint64(workerMagic2)
+	c.writeUint64(s.version)
+	if err := c.flush(); err != nil {
+		return err
+	}
+
+	clientVersion, err := c.readUint64()
+	if err != nil {
+		return err
+	}
+	c.version = min(clientVersion, s.version)
+
+	if c.minor() >= 14 {
+		if affinity, err := c.readUint64(); err != nil || affinity != 0 {
+			return fmt.Errorf("unexpected affinity: %v", err)
+		}
+	}
+	if c.minor() >= 11 {
+		if _, err := c.readUint64(); err != nil {
+			return err
+		}
+	}
+	if c.minor() >= 33 {
+		c.writeString("2.18.1")
+	}
+	if c.minor() >= 35 {
+		c.writeUint64(1)
+	}
+
+	c.writeUint64(stderrNext)
+	c.writeString("warning: this is a fake daemon\n")
+	c.writeUint64(stderrLast)
+	return c.flush()
+}
+
+func (s *fakeServer) handle(c *conn, op uint64) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	switch op {
+	case opIsValidPath:
+		storePath, err := c.readString()
+		if err != nil {
+			return err
+		}
+		c.writeUint64(stderrLast)
+		c.writeUint64(boolToUint64(s.paths[storePath] != nil))
+
+	case opQueryPathInfo:
+		storePath, err := c.readString()
+		if err != nil {
+			return err
+		}
+
+		// some logs are sent to check they are properly skipped
+		c.writeUint64(stderrStartActivity)
+		c.writeUint64(1)
+		c.writeUint64(4)
+		c.writeUint64(109)
+		c.writeString("querying info about " + storePath)
+		c.writeUint64(2)
+		c.writeUint64(1)
+		c.writeString(storePath)
+		c.writeUint64(0)
+		c.writeUint64(42)
+		c.writeUint64(0)
+		c.writeUint64(stderrResult)
+		c.writeUint64(1)
+		c.writeUint64(resultTypeBuildLogLine)
+		c.writeUint64(1)
+		c.writeUint64(1)
+		c.writeString("log line")
+		c.writeUint64(stderrStopActivity)
+		c.writeUint64(1)
+
+		info := s.paths[storePath]
+		if info == nil && c.minor() < 17 {
+			s.writeError(c, fmt.Sprintf("path '%s' is not valid", storePath))
+			break
+		}
+
+		c.writeUint64(stderrLast)
+		if c.minor() >= 17 {
+			c.writeUint64(boolToUint64(info != nil))
+		}
+		if info != nil {
+			c.writeString(info.Deriver)
+			c.writeString(info.NarHash)
+			c.writeStrings(info.References)
+			c.writeUint64(info.RegistrationTime)
+			c.writeUint64(info.NarSize)
+			if c.minor() >= 16 {
+				c.writeUint64(boolToUint64(info.Ultimate))
+				c.writeStrings(info.Signatures)
+				c.writeString(info.ContentAddress)
+			}
+		}
+
+	case opAddTempRoot, opAddIndirectRoot:
+		root, err := c.readString()
+		if err != nil {
+			return err
+		}
+		if op == opAddTempRoot {
+			s.tempRoots = append(s.tempRoots, root)
+		} else {
+			s.indirectRoots = append(s.indirectRoots, root)
+		}
+		c.writeUint64(stderrLast)
+		c.writeUint64(1)
+
+	case opBuildPaths:
+		paths, err := c.readStrings()
+		if err != nil {
+			return err
+		}
+		if c.minor() >= 15 {
+			if _, err := c.readUint64(); err != nil {
+				return err
+			}
+		}
+		s.builds = append(s.builds, paths...)
+
+		if s.buildError != "" {
+			s.writeError(c, s.buildError)
+			break
+		}
+		c.writeUint64(stderrLast)
+		c.writeUint64(1)
+
+	default:
+		return fmt.Errorf("unknown operation %d", op)
+	}
+
+	return c.flush()
+}
+
+func (*fakeServer) writeError(c *conn, msg string) {
+	c.writeUint64(stderrError)
+	if c.minor() < 26 {
+		c.writeString(msg)
+		c.writeUint64(1)
+		return
+	}
+	c.writeString("Error")
+	c.writeUint64(0)
+	c.writeString("Error")
+	c.writeString(msg)
+	c.writeUint64(0)
+	c.writeUint64(1)
+	c.writeUint64(0)
+	c.writeString("while doing something")
+}
+
+func boolToUint64(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func Test_daemon_GetStorePath(t *testing.T) {
+	for _, version := range []uint64{1<<8 | 21, 1<<8 | 32, 1<<8 | 35, 1<<8 | 37} {
+		t.Run(fmt.Sprintf("1.%d", version&0xff), func(t *testing.T) {
+			server := newFakeServer(t, version)
+			server.addPath("/nix/store/aaa-hello")
+
+			fallback := fake.New()
+			d := server.daemon(Config{}, fallback)
+
+			valid, storePath, err := d.GetStorePath(context.Background(), "/nix/store/aaa-hello")
+			assert.NilError(t, err)
+			assert.Check(t, valid)
+			assert.DeepEqual(t, storePath, &nix.StorePath{Derivation: "/nix/store/aaa-hello.drv", Output: "/nix/store/aaa-hello"})
+
+			valid, storePath, err = d.GetStorePath(context.Background(), "/nix/store/bbb-missing")
+			assert.NilError(t, err)
+			assert.Check(t, !valid)
+			assert.Check(t, storePath == nil)
+
+			// the connection is reused between operations
+			assert.Equal(t, server.dials, 1)
+			assert.Equal(t, fallback.Calls("GetStorePath"), 0)
+
+			// installables that are not store paths are handled by the fallback
+			_, _, _ = d.GetStorePath(context.Background(), "nixpkgs#hello")
+			assert.Equal(t, fallback.Calls("GetStorePath"), 1)
+		})
+	}
+}
+
+func Test_daemon_GetRemoteStorePath(t *testing.T) {
+	server := newFakeServer(t, clientVersion)
+	server.addPath("/nix/store/aaa-hello", "/nix/store/bbb-glibc")
+	server.addPath("/nix/store/bbb-glibc", "/nix/store/ccc-libidn")
+	server.addPath("/nix/store/ddd-broken", "/nix/store/eee-missing")
+
+	fallback := fake.New()
+	fallback.AddStorePath("ssh://remote", "/nix/store/aaa-hello")
+	d := server.daemon(Config{Socket: "/run/nix.sock"}, fallback)
+
+	t.Run("closure is incomplete", func(t *testing.T) {
+		pathInfo, err := d.GetRemoteStorePath(context.Background(), nix.RemoteStorePathRequest{Installable: "/nix/store/aaa-hello", Store: "daemon"})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, pathInfo, &nix.PathInfo{
+			Path:             "/nix/store/aaa-hello",
+			Valid:            true,
+			NarHash:          "sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+			NarSize:          42,
+			Signatures:       []string{"cache.nixos.org-1:sig"},
+			ClosureComplete:  false,
+			References:       []string{"/nix/store/aaa-hello", "/nix/store/bbb-glibc"},
+			Deriver:          "/nix/store/aaa-hello.drv",
+			RegistrationTime: 1700000000,
+		})
+	})
+
+	t.Run("closure is complete", func(t *testing.T) {
+		server.addPath("/nix/store/ccc-libidn")
+
+		pathInfo, err := d.GetRemoteStorePath(context.Background(), nix.RemoteStorePathRequest{Installable: "/nix/store/aaa-hello", Store: "unix:///run/nix.sock"})
+		assert.NilError(t, err)
+		assert.Check(t, pathInfo.Valid)
+		assert.Check(t, pathInfo.ClosureComplete)
+		assert.Equal(t, pathInfo.ClosureSize, int64(3*42))
+	})
+
+	t.Run("store path is missing", func(t *testing.T) {
+		pathInfo, err := d.GetRemoteStorePath(context.Background(), nix.RemoteStorePathRequest{Installable: "/nix/store/eee-missing", Store: "daemon"})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, pathInfo, &nix.PathInfo{Path: "/nix/store/eee-missing"})
+	})
+
+	t.Run("default store is the store of the daemon", func(t *testing.T) {
+		pathInfo, err := d.GetRemoteStorePath(context.Background(), nix.RemoteStorePathRequest{Installable: "/nix/store/aaa-hello"})
+		assert.NilError(t, err)
+		assert.Check(t, pathInfo.Valid)
+		assert.Equal(t, fallback.Calls("GetRemoteStorePath"), 0)
+	})
+
+	t.Run("other stores are handled by the fallback", func(t *testing.T) {
+		pathInfo, err := d.GetRemoteStorePath(context.Background(), nix.RemoteStorePathRequest{Installable: "/nix/store/aaa-hello", Store: "ssh://remote"})
+		assert.NilError(t, err)
+		assert.Check(t, pathInfo.Valid)
+		assert.Equal(t, fallback.Calls("GetRemoteStorePath"), 1)
+	})
+}
+
+func Test_daemon_GetClosure(t *testing.T) {
+	server := newFakeServer(t, clientVersion)
+	server.addPath("/nix/store/aaa-hello", "/nix/store/ccc-glibc")
+	server.addPath("/nix/store/ccc-glibc", "/nix/store/bbb-libidn")
+	server.addPath("/nix/store/ddd-broken", "/nix/store/eee-missing")
+
+	d := server.daemon(Config{}, fake.New())
+
+	closure, err := d.GetClosure(context.Background(), nix.RemoteStorePathRequest{Installable: "/nix/store/aaa-hello", Store: "daemon"})
+	assert.ErrorContains(t, err, "/nix/store/bbb-libidn")
+	var missingErr *nix.MissingStorePathError
+	assert.Assert(t, errors.As(err, &missingErr))
+	assert.Equal(t, missingErr.Path, "/nix/store/bbb-libidn")
+	assert.Check(t, closure == nil)
+
+	server.addPath("/nix/store/bbb-libidn")
+
+	closure, err = d.GetClosure(context.Background(), nix.RemoteStorePathRequest{Installable: "/nix/store/aaa-hello", Store: "daemon"})
+	assert.NilError(t, err)
+	assert.Equal(t, len(closure), 3)
+	for i, storePath := range []string{"/nix/store/aaa-hello", "/nix/store/bbb-libidn", "/nix/store/ccc-glibc"} {
+		assert.Equal(t, closure[i].Path, storePath)
+		assert.Check(t, closure[i].Valid)
+		assert.Equal(t, closure[i].NarSize, int64(42))
+	}
+}
+
+func Test_daemon_AddGCRoot(t *testing.T) {
+	server := newFakeServer(t, clientVersion)
+	server.addPath("/nix/store/aaa-hello")
+
+	gcRootDir := filepath.Join(t.TempDir(), "gcroots")
+	d := server.daemon(Config{GCRootDir: gcRootDir}, fake.New())
+
+	root, err := d.AddGCRoot(context.Background(), "hello", "/nix/store/aaa-hello")
+	assert.NilError(t, err)
+	assert.Equal(t, root, filepath.Join(gcRootDir, "hello"))
+
+	target, err := os.Readlink(root)
+	assert.NilError(t, err)
+	assert.Equal(t, target, "/nix/store/aaa-hello")
+	assert.DeepEqual(t, server.tempRoots, []string{"/nix/store/aaa-hello"})
+	assert.DeepEqual(t, server.indirectRoots, []string{root})
+
+	// creating the root again replaces it
+	_, err = d.AddGCRoot(context.Background(), "hello", "/nix/store/aaa-hello")
+	assert.NilError(t, err)
+
+	_, err = d.AddGCRoot(context.Background(), "missing", "/nix/store/bbb-missing")
+	var missingErr *nix.MissingStorePathError
+	assert.Assert(t, errors.As(err, &missingErr))
+	assert.Equal(t, missingErr.Path, "/nix/store/bbb-missing")
+
+	_, err = server.daemon(Config{}, fake.New()).AddGCRoot(context.Background(), "hello", "/nix/store/aaa-hello")
+	assert.ErrorContains(t, err, "no garbage collector root directory configured")
+}
+
+func Test_daemon_Build(t *testing.T) {
+	hello := nix.Derivation{
+		Name:   "hello",
+		System: "x86_64-linux",
+		Path: nix.StorePath{
+			Derivation: "/nix/store/aaa-hello.drv",
+			Output:     "/nix/store/bbb-hello",
+			Outputs:    map[string]string{"out": "/nix/store/bbb-hello", "doc": "/nix/store/ccc-hello-doc"},
+		},
+	}
+
+	for _, test := range []struct {
+		version       uint64
+		installable   string
+		expectedBuild string
+		expected      *nix.StorePath
+	}{
+		{
+			version:       clientVersion,
+			installable:   "/nix/store/aaa-hello.drv^doc",
+			expectedBuild: "/nix/store/aaa-hello.drv^doc",
+			expected:      &nix.StorePath{Derivation: "/nix/store/aaa-hello.drv", Output: "/nix/store/ccc-hello-doc", Outputs: map[string]string{"doc": "/nix/store/ccc-hello-doc"}},
+		},
+		{
+			version:       1<<8 | 29,
+			installable:   "/nix/store/aaa-hello.drv",
+			expectedBuild: "/nix/store/aaa-hello.drv!*",
+			expected:      &hello.Path,
+		},
+		{
+			version:       clientVersion,
+			installable:   "/nix/store/bbb-hello",
+			expectedBuild: "/nix/store/bbb-hello",
+			expected:      &nix.StorePath{Output: "/nix/store/bbb-hello", Outputs: map[string]string{"out": "/nix/store/bbb-hello"}},
+		},
+	} {
+		t.Run(test.installable, func(t *testing.T) {
+			server := newFakeServer(t, test.version)
+			fallback := fake.New()
+			fallback.AddDerivation("nixpkgs#hello", hello)
+
+			storePath, err := server.daemon(Config{}, fallback).Build(context.Background(), nix.BuildRequest{Installable: test.installable})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, storePath, test.expected)
+			assert.DeepEqual(t, server.builds, []string{test.expectedBuild})
+			assert.Equal(t, fallback.Calls("Build"), 0)
+		})
+	}
+
+	for _, version := range []uint64{1<<8 | 25, clientVersion} {
+		t.Run(fmt.Sprintf("failure with 1.%d", version&0xff), func(t *testing.T) {
+			server := newFakeServer(t, version)
+			server.buildError = "builder for '/nix/store/aaa-hello.drv' failed with exit code 1"
+			fallback := fake.New()
+			fallback.AddDerivation("nixpkgs#hello", hello)
+
+			_, err := server.daemon(Config{}, fallback).Build(context.Background(), nix.BuildRequest{Installable: "/nix/store/aaa-hello.drv^out"})
+			var buildErr *nix.BuildError
+			assert.Assert(t, errors.As(err, &buildErr))
+			assert.Equal(t, buildErr.Derivation, "/nix/store/aaa-hello.drv")
+			assert.Check(t, is.Contains(buildErr.Message, "failed with exit code 1"))
+		})
+	}
+
+	t.Run("installables are built by the fallback", func(t *testing.T) {
+		server := newFakeServer(t, clientVersion)
+		fallback := fake.New()
+		fallback.AddDerivation("nixpkgs#hello", hello)
+
+		_, err := server.daemon(Config{}, fallback).Build(context.Background(), nix.BuildRequest{Installable: "nixpkgs#hello"})
+		assert.NilError(t, err)
+		assert.Equal(t, fallback.Calls("Build"), 1)
+		assert.Equal(t, len(server.builds), 0)
+	})
+
+	t.Run("expression attributes are built by the fallback", func(t *testing.T) {
+		server := newFakeServer(t, clientVersion)
+		fallback := fake.New()
+		options := nix.EvaluationOptions{Expression: "{ hello }: hello", Args: map[string]string{"hello": `"/nix/store/aaa-hello"`}}
+		fallback.AddDerivationWithOptions("", options, hello)
+
+		_, err := server.daemon(Config{}, fallback).Build(context.Background(), nix.BuildRequest{EvaluationOptions: options})
+		assert.NilError(t, err)
+		assert.Equal(t, fallback.Calls("Build"), 1)
+		assert.Equal(t, len(server.builds), 0)
+	})
+
+	t.Run("builds with options are built by the fallback", func(t *testing.T) {
+		server := newFakeServer(t, clientVersion)
+		fallback := fake.New()
+		fallback.AddDerivation("nixpkgs#hello", hello)
+		keepGoing := true
+
+		req := nix.BuildRequest{Installable: "/nix/store/aaa-hello.drv^out", Options: nix.BuildOptions{KeepGoing: &keepGoing}}
+		_, err := server.daemon(Config{}, fallback).Build(context.Background(), req)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, fallback.BuildRequests(), []nix.BuildRequest{req})
+		assert.Equal(t, len(server.builds), 0)
+	})
+	t.Run("builds are built by the fallback when configured", func(t *testing.T) {
+		server := newFakeServer(t, clientVersion)
+		fallback := fake.New()
+		fallback.AddDerivation("nixpkgs#hello", hello)
+
+		_, err := server.daemon(Config{FallbackBuilds: true}, fallback).Build(context.Background(), nix.BuildRequest{Installable: "/nix/store/aaa-hello.drv^out"})
+		assert.NilError(t, err)
+		assert.Equal(t, fallback.Calls("Build"), 1)
+		assert.Equal(t, len(server.builds), 0)
+	})
+}
+
+func Test_daemon_connection(t *testing.T) {
+	t.Run("unreachable socket", func(t *testing.T) {
+		d := New(Config{Socket: filepath.Join(t.TempDir(), "socket")}, fake.New())
+
+		_, _, err := d.GetStorePath(context.Background(), "/nix/store/aaa-hello")
+		var connectionErr *nix.ConnectionError
+		assert.Assert(t, errors.As(err, &connectionErr))
+		assert.Check(t, is.Contains(connectionErr.Store, "unix://"))
+	})
+
+	t.Run("not a daemon", func(t *testing.T) {
+		d := &daemon{dial: func(context.Context) (net.Conn, error) {
+			client, server := net.Pipe()
+			go func() {
+				defer server.Close()
+				_, _ = server.Read(make([]byte, 8))
+				_, _ = server.Write([]byte("HTTP/1.1"))
+			}()
+			return client, nil
+		}}
+
+		_, _, err := d.GetStorePath(context.Background(), "/nix/store/aaa-hello")
+		assert.ErrorContains(t, err, "unexpected daemon magic number")
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		_, _, err := newFakeServer(t, 1<<8|20).daemon(Config{}, nil).GetStorePath(context.Background(), "/nix/store/aaa-hello")
+		assert.ErrorContains(t, err, "unsupported daemon protocol version 1.20")
+	})
+
+	t.Run("context is cancelled", func(t *testing.T) {
+		d := &daemon{dial: func(context.Context) (net.Conn, error) {
+			client, server := net.Pipe()
+			go func() {
+				// the server never answers operations
+				defer server.Close()
+				c := &conn{conn: server, r: bufio.NewReader(server), w: bufio.NewWriter(server)}
+				if err := newFakeServer(t, clientVersion).handshake(c); err == nil {
+					_, _ = c.readUint64()
+					time.Sleep(time.Second)
+				}
+			}()
+			return client, nil
+		}}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, _, err := d.GetStorePath(ctx, "/nix/store/aaa-hello")
+		assert.Assert(t, errors.Is(err, context.DeadlineExceeded))
+		assert.Equal(t, len(d.idle), 0)
+	})
+}
+
+func Test_isStorePath(t *testing.T) {
+	for s, expected := range map[string]bool{
+		"/nix/store/aaa-hello":       true,
+		"/nix/store/aaa-hello.drv":   true,
+		"/nix/store/aaa-hello/bin":   false,
+		"/nix/store/":                false,
+		"nixpkgs#hello":              false,
+		"/tmp/nix/store/aaa-hello":   false,
+		"path:/nix/store/aaa-source": false,
+	} {
+		assert.Check(t, isStorePath(s) == expected, s)
+	}
+}
+
+// Test_daemon_local runs a real nix daemon, serving a temporary store on its standard input and output.
+func Test_daemon_local(t *testing.T) {
+	nixDaemon, err := exec.LookPath("nix-daemon")
+	if err != nil {
+		t.Skip("nix-daemon is not available")
+	}
+
+	root := t.TempDir()
+	store := "local?root=" + root
+
+	file := filepath.Join(t.TempDir(), "hello.txt")
+	assert.NilError(t, os.WriteFile(file, []byte("hello"), 0o600))
+	out, err := exec.Command("nix-store", "--store", store, "--add", file).Output()
+	assert.NilError(t, err)
+	storePath := strings.TrimSpace(string(out))
+
+	d := &daemon{
+		Nix:    fake.New(),
+		config: Config{GCRootDir: filepath.Join(t.TempDir(), "gcroots")},
+		dial: func(ctx context.Context) (net.Conn, error) {
+			client, server := net.Pipe()
+
+			cmd := exec.CommandContext(ctx, nixDaemon, "--stdio", "--store", store)
+			cmd.Stdin, cmd.Stdout = server, server
+			if err := cmd.Start(); err != nil {
+				return nil, err
+			}
+			t.Cleanup(func() {
+				_ = client.Close()
+				_ = cmd.Wait()
+			})
+
+			return client, nil
+		},
+	}
+	ctx := context.Background()
+
+	valid, info, err := d.GetStorePath(ctx, storePath)
+	assert.NilError(t, err)
+	assert.Check(t, valid)
+	assert.Equal(t, info.Output, storePath)
+
+	valid, _, err = d.GetStorePath(ctx, "/nix/store/00000000000000000000000000000000-missing")
+	assert.NilError(t, err)
+	assert.Check(t, !valid)
+
+	pathInfo, err := d.GetRemoteStorePath(ctx, nix.RemoteStorePathRequest{Installable: storePath, Store: "daemon"})
+	assert.NilError(t, err)
+	assert.Check(t, pathInfo.Valid)
+	assert.Check(t, pathInfo.ClosureComplete)
+	assert.Check(t, is.Contains(pathInfo.NarHash, "sha256-"))
+	assert.Check(t, pathInfo.NarSize > 0)
+
+	gcRoot, err := d.AddGCRoot(ctx, "hello", storePath)
+	assert.NilError(t, err)
+	exists, err := d.GCRootExists(ctx, gcRoot, storePath)
+	assert.NilError(t, err)
+	assert.Check(t, exists)
+
+	_, err = d.Build(ctx, nix.BuildRequest{Installable: storePath})
+	assert.NilError(t, err)
+}
@@ -0,0 +1,84 @@
+package nixdaemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+// AddGCRoot creates a symlink to the store path in the garbage collector root directory, and registers it as an indirect root.
+func (d *daemon) AddGCRoot(ctx context.Context, name string, storePath string) (string, error) {
+	if d.config.GCRootDir == "" {
+		return "", errors.New("no garbage collector root directory configured")
+	}
+
+	if err := os.MkdirAll(d.config.GCRootDir, 0o755); err != nil {
+		return "", fmt.Errorf("unable to create garbage collector root directory: %v", err)
+	}
+
+	root, err := filepath.Abs(filepath.Join(d.config.GCRootDir, name))
+	if err != nil {
+		return "", fmt.Errorf("unable to get garbage collector root absolute path: %v", err)
+	}
+
+	err = d.withConn(ctx, func(c *conn) error {
+		// the temporary root protects the store path until the indirect root is registered
+		if err := c.addTempRoot(ctx, storePath); err != nil {
+			return fmt.Errorf("unable to add temporary root: %w", err)
+		}
+
+		valid, err := c.isValidPath(ctx, storePath)
+		if err != nil {
+			return fmt.Errorf("unable to check store path validity: %w", err)
+		}
+		if !valid {
+			return &nix.MissingStorePathError{Message: fmt.Sprintf("path '%s' is not valid", storePath), Path: storePath}
+		}
+
+		// the symlink is replaced atomically if it already exists
+		tmp := root + ".tmp"
+		_ = os.Remove(tmp)
+		if err := os.Symlink(storePath, tmp); err != nil {
+			return fmt.Errorf("unable to create garbage collector root: %v", err)
+		}
+		if err := os.Rename(tmp, root); err != nil {
+			return fmt.Errorf("unable to create garbage collector root: %v", err)
+		}
+
+		if err := c.addIndirectRoot(ctx, root); err != nil {
+			return fmt.Errorf("unable to register garbage collector root: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return root, nil
+}
+
+// RemoveGCRoot removes the symlink, nix ignores indirect roots whose symlink does not exist anymore.
+func (*daemon) RemoveGCRoot(_ context.Context, root string) error {
+	if err := os.Remove(root); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to remove garbage collector root: %v", err)
+	}
+	return nil
+}
+
+// GCRootExists checks the symlink still points to the store path.
+func (*daemon) GCRootExists(_ context.Context, root string, storePath string) (bool, error) {
+	target, err := os.Readlink(root)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("unable to read garbage collector root: %v", err)
+	default:
+		return target == storePath, nil
+	}
+}
@@ -0,0 +1,540 @@
+package nixdaemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+// Worker protocol constants as defined by nix in libstore/worker-protocol.hh.
+const (
+	workerMagic1 = 0x6e697863
+	workerMagic2 = 0x6478696f
+
+	// clientVersion is the protocol version spoken by this client, 1.35.
+	clientVersion = 1<<8 | 35
+	// minimumServerVersion is the oldest protocol version supported by this client, 1.21 (nix 2.3).
+	minimumServerVersion = 1<<8 | 21
+
+	opIsValidPath     = 1
+	opBuildPaths      = 9
+	opAddTempRoot     = 11
+	opAddIndirectRoot = 12
+	opQueryPathInfo   = 26
+
+	stderrNext          = 0x6f6c6d67
+	stderrRead          = 0x64617461
+	stderrWrite         = 0x64617416
+	stderrLast          = 0x616c7473
+	stderrError         = 0x63787470
+	stderrStartActivity = 0x53545254
+	stderrStopActivity  = 0x53544f50
+	stderrResult        = 0x52534c54
+
+	resultTypeBuildLogLine = 101
+
+	// maxStringLength is the maximum size of strings read from the daemon, to avoid huge allocations on corrupted streams.
+	maxStringLength = 64 << 20
+)
+
+type (
+	// conn is a connection to the nix daemon, on which the handshake has been done.
+	// Operations on a connection are sequential, a connection can't be used concurrently.
+	conn struct {
+		conn    net.Conn
+		r       *bufio.Reader
+		w       *bufio.Writer
+		version uint64
+		// broken is set when the connection stream is in an unknown state, and cannot be reused.
+		broken bool
+	}
+
+	// remoteError is an error sent by the daemon while processing an operation.
+	remoteError struct {
+		Message string
+		Traces  []string
+	}
+
+	// pathInfo is the daemon representation of a valid store path.
+	pathInfo struct {
+		Deriver          string
+		NarHash          string
+		References       []string
+		RegistrationTime uint64
+		NarSize          uint64
+		Ultimate         bool
+		Signatures       []string
+		ContentAddress   string
+	}
+)
+
+// pathInfo converts the daemon representation of the store path to its nix representation, closure related fields are not set.
+func (info pathInfo) pathInfo(storePath string) nix.PathInfo {
+	return nix.PathInfo{
+		Path:             storePath,
+		Valid:            true,
+		NarHash:          sriHash(info.NarHash),
+		NarSize:          int64(info.NarSize),
+		Signatures:       info.Signatures,
+		References:       info.References,
+		Deriver:          info.Deriver,
+		ContentAddress:   info.ContentAddress,
+		RegistrationTime: int64(info.RegistrationTime),
+	}
+}
+
+func (e *remoteError) Error() string {
+	if len(e.Traces) == 0 {
+		return e.Message
+	}
+	return e.Message + ": " + strings.Join(e.Traces, ": ")
+}
+
+// handshake negotiates the protocol version with the daemon, and processes the daemon startup messages.
+func handshake(ctx context.Context, nc net.Conn) (*conn, error) {
+	c := &conn{conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	c.writeUint64(workerMagic1)
+	if err := c.flush(); err != nil {
+		return nil, err
+	}
+
+	magic, err := c.readUint64()
+	if err != nil {
+		return nil, err
+	}
+	if magic != workerMagic2 {
+		return nil, fmt.Errorf("unexpected daemon magic number %#x, is it a nix daemon socket", magic)
+	}
+
+	serverVersion, err := c.readUint64()
+	if err != nil {
+		return nil, err
+	}
+	if serverVersion>>8 != clientVersion>>8 || serverVersion < minimumServerVersion {
+		return nil, fmt.Errorf("unsupported daemon protocol version %d.%d", serverVersion>>8, serverVersion&0xff)
+	}
+	c.version = min(serverVersion, clientVersion)
+
+	c.writeUint64(clientVersion)
+	if c.minor() >= 14 {
+		c.writeUint64(0) // no cpu affinity
+	}
+	if c.minor() >= 11 {
+		c.writeUint64(0) // obsolete reserve space
+	}
+	if err := c.flush(); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]any{"protocol_version": fmt.Sprintf("%d.%d", c.version>>8, c.minor())}
+	if c.minor() >= 33 {
+		daemonVersion, err := c.readString()
+		if err != nil {
+			return nil, err
+		}
+		fields["daemon_version"] = daemonVersion
+	}
+	if c.minor() >= 35 {
+		trusted, err := c.readUint64()
+		if err != nil {
+			return nil, err
+		}
+		fields["trusted"] = trusted == 1
+	}
+	tflog.Debug(ctx, "connected to nix daemon", fields)
+
+	if err := c.processStderr(ctx); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *conn) minor() uint64 { return c.version & 0xff }
+
+// isValidPath checks whether the store path is valid.
+func (c *conn) isValidPath(ctx context.Context, storePath string) (bool, error) {
+	c.writeUint64(opIsValidPath)
+	c.writeString(storePath)
+	if err := c.run(ctx); err != nil {
+		return false, err
+	}
+	return c.readBool()
+}
+
+// queryPathInfo returns information about the store path, or nil if the store path is not valid.
+func (c *conn) queryPathInfo(ctx context.Context, storePath string) (*pathInfo, error) {
+	c.writeUint64(opQueryPathInfo)
+	c.writeString(storePath)
+	if err := c.run(ctx); err != nil {
+		return nil, err
+	}
+
+	if c.minor() >= 17 {
+		valid, err := c.readBool()
+		if err != nil || !valid {
+			return nil, err
+		}
+	}
+
+	var (
+		info pathInfo
+		err  error
+	)
+
+	info.Deriver, err = c.readString()
+	if err == nil {
+		info.NarHash, err = c.readString()
+	}
+	if err == nil {
+		info.References, err = c.readStrings()
+	}
+	if err == nil {
+		info.RegistrationTime, err = c.readUint64()
+	}
+	if err == nil {
+		info.NarSize, err = c.readUint64()
+	}
+	if err == nil && c.minor() >= 16 {
+		info.Ultimate, err = c.readBool()
+		if err == nil {
+			info.Signatures, err = c.readStrings()
+		}
+		if err == nil {
+			info.ContentAddress, err = c.readString()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// addTempRoot protects the store path from garbage collection as long as the connection is open.
+func (c *conn) addTempRoot(ctx context.Context, storePath string) error {
+	c.writeUint64(opAddTempRoot)
+	c.writeString(storePath)
+	if err := c.run(ctx); err != nil {
+		return err
+	}
+	_, err := c.readUint64()
+	return err
+}
+
+// addIndirectRoot registers the symlink, pointing to a store path, as a garbage collector root.
+func (c *conn) addIndirectRoot(ctx context.Context, symlink string) error {
+	c.writeUint64(opAddIndirectRoot)
+	c.writeString(symlink)
+	if err := c.run(ctx); err != nil {
+		return err
+	}
+	_, err := c.readUint64()
+	return err
+}
+
+// buildPaths builds derivation outputs (drv path and output names) or substitutes opaque store paths (no output names).
+func (c *conn) buildPaths(ctx context.Context, derivation string, outputNames []string) error {
+	derivedPath := derivation
+	if len(outputNames) > 0 {
+		separator := "^"
+		if c.minor() < 30 {
+			separator = "!"
+		}
+		derivedPath += separator + strings.Join(outputNames, ",")
+	}
+
+	c.writeUint64(opBuildPaths)
+	c.writeStrings([]string{derivedPath})
+	if c.minor() >= 15 {
+		c.writeUint64(0) // normal build mode
+	}
+	if err := c.run(ctx); err != nil {
+		return err
+	}
+	_, err := c.readUint64()
+	return err
+}
+
+// run sends the operation written on the connection, and processes the messages sent by the daemon while the operation runs.
+func (c *conn) run(ctx context.Context) error {
+	if err := c.flush(); err != nil {
+		return err
+	}
+	return c.processStderr(ctx)
+}
+
+// processStderr forwards logs sent by the daemon until the daemon is done with the operation.
+// It returns a *remoteError if the operation failed.
+func (c *conn) processStderr(ctx context.Context) error {
+	for {
+		code, err := c.readUint64()
+		if err != nil {
+			return err
+		}
+
+		switch code {
+		case stderrLast:
+			return nil
+
+		case stderrNext, stderrWrite:
+			msg, err := c.readString()
+			if err != nil {
+				return err
+			}
+			tflog.Debug(ctx, strings.TrimSpace(msg))
+
+		case stderrStartActivity:
+			var (
+				id, level, typ uint64
+				text           string
+			)
+			id, err = c.readUint64()
+			if err == nil {
+				level, err = c.readUint64()
+			}
+			if err == nil {
+				typ, err = c.readUint64()
+			}
+			if err == nil {
+				text, err = c.readString()
+			}
+			if err == nil {
+				_, err = c.readFields()
+			}
+			if err == nil {
+				_, err = c.readUint64() // parent activity
+			}
+			if err != nil {
+				return err
+			}
+			if text != "" {
+				fields := map[string]any{"activity_id": id, "activity_type": typ}
+				if level <= 3 {
+					tflog.Info(ctx, text, fields)
+				} else {
+					tflog.Debug(ctx, text, fields)
+				}
+			}
+
+		case stderrStopActivity:
+			if _, err := c.readUint64(); err != nil {
+				return err
+			}
+
+		case stderrResult:
+			var (
+				id, typ uint64
+				fields  []any
+			)
+			id, err = c.readUint64()
+			if err == nil {
+				typ, err = c.readUint64()
+			}
+			if err == nil {
+				fields, err = c.readFields()
+			}
+			if err != nil {
+				return err
+			}
+			if line, ok := firstStringField(fields); ok && typ == resultTypeBuildLogLine {
+				tflog.Debug(ctx, line, map[string]any{"activity_id": id})
+			}
+
+		case stderrError:
+			return c.readError()
+
+		case stderrRead:
+			c.broken = true
+			return errors.New("daemon requested data, which is not supported by this client")
+
+		default:
+			c.broken = true
+			return fmt.Errorf("unexpected daemon message %#x", code)
+		}
+	}
+}
+
+// readError reads an error sent by the daemon.
+func (c *conn) readError() error {
+	if c.minor() < 26 {
+		msg, err := c.readString()
+		if err == nil {
+			_, err = c.readUint64() // exit status
+		}
+		if err != nil {
+			return err
+		}
+		return &remoteError{Message: msg}
+	}
+
+	var (
+		remoteErr remoteError
+		nbTraces  uint64
+	)
+
+	_, err := c.readString() // type, always "Error"
+	if err == nil {
+		_, err = c.readUint64() // level
+	}
+	if err == nil {
+		_, err = c.readString() // name, always "Error"
+	}
+	if err == nil {
+		remoteErr.Message, err = c.readString()
+	}
+	if err == nil {
+		_, err = c.readUint64() // position, always empty
+	}
+	if err == nil {
+		nbTraces, err = c.readUint64()
+	}
+	for i := uint64(0); err == nil && i < nbTraces; i++ {
+		var trace string
+		_, err = c.readUint64() // position, always empty
+		if err == nil {
+			trace, err = c.readString()
+		}
+		remoteErr.Traces = append(remoteErr.Traces, trace)
+	}
+	if err != nil {
+		return err
+	}
+
+	return &remoteErr
+}
+
+func (c *conn) readFields() ([]any, error) {
+	count, err := c.readUint64()
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]any, 0, min(count, 16))
+	for i := uint64(0); i < count; i++ {
+		typ, err := c.readUint64()
+		if err != nil {
+			return nil, err
+		}
+
+		switch typ {
+		case 0:
+			v, err := c.readUint64()
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, v)
+		case 1:
+			v, err := c.readString()
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, v)
+		default:
+			c.broken = true
+			return nil, fmt.Errorf("unexpected field type %d", typ)
+		}
+	}
+
+	return fields, nil
+}
+
+func firstStringField(fields []any) (string, bool) {
+	if len(fields) == 0 {
+		return "", false
+	}
+	s, ok := fields[0].(string)
+	return s, ok
+}
+
+// Numbers are sent as 64 bits little endian integers, strings as their length followed by their content padded to 8 bytes.
+
+func (c *conn) writeUint64(n uint64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], n)
+	_, _ = c.w.Write(buf[:]) // errors are reported by flush
+}
+
+func (c *conn) writeString(s string) {
+	c.writeUint64(uint64(len(s)))
+	_, _ = c.w.WriteString(s)
+	_, _ = c.w.Write(make([]byte, padding(uint64(len(s)))))
+}
+
+func (c *conn) writeStrings(ss []string) {
+	c.writeUint64(uint64(len(ss)))
+	for _, s := range ss {
+		c.writeString(s)
+	}
+}
+
+func (c *conn) flush() error {
+	if err := c.w.Flush(); err != nil {
+		c.broken = true
+		return fmt.Errorf("unable to write to daemon: %v", err)
+	}
+	return nil
+}
+
+func (c *conn) readUint64() (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(c.r, buf[:]); err != nil {
+		c.broken = true
+		return 0, fmt.Errorf("unable to read from daemon: %v", err)
+	}
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
+func (c *conn) readBool() (bool, error) {
+	n, err := c.readUint64()
+	return n != 0, err
+}
+
+func (c *conn) readString() (string, error) {
+	length, err := c.readUint64()
+	if err != nil {
+		return "", err
+	}
+	if length > maxStringLength {
+		c.broken = true
+		return "", fmt.Errorf("daemon sent a string too long (%d bytes)", length)
+	}
+
+	buf := make([]byte, length+padding(length))
+	if _, err := io.ReadFull(c.r, buf); err != nil {
+		c.broken = true
+		return "", fmt.Errorf("unable to read from daemon: %v", err)
+	}
+
+	return string(buf[:length]), nil
+}
+
+func (c *conn) readStrings() ([]string, error) {
+	count, err := c.readUint64()
+	if err != nil {
+		return nil, err
+	}
+
+	ss := make([]string, 0, min(count, 1024))
+	for i := uint64(0); i < count; i++ {
+		s, err := c.readString()
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+
+	return ss, nil
+}
+
+func padding(length uint64) uint64 { return (8 - length%8) % 8 }
@@ -0,0 +1,95 @@
+package nix
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrorPosition locates a position in a nix file.
+type ErrorPosition struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p ErrorPosition) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// ErrorTrace is one step of the trace leading to a nix evaluation error.
+type ErrorTrace struct {
+	Message  string
+	Position *ErrorPosition
+}
+
+// EvaluationError is returned when nix fails to evaluate an expression.
+type EvaluationError struct {
+	Message  string
+	Position *ErrorPosition
+	Trace    []ErrorTrace
+}
+
+func (e *EvaluationError) Error() string {
+	var b strings.Builder
+	b.WriteString("evaluation failed: " + e.Message)
+	if e.Position != nil {
+		b.WriteString(" at " + e.Position.String())
+	}
+
+	for _, trace := range e.Trace {
+		b.WriteString("\n  " + trace.Message)
+		if trace.Position != nil {
+			b.WriteString(" at " + trace.Position.String())
+		}
+	}
+
+	return b.String()
+}
+
+// BuildError is returned when a derivation fails to build.
+type BuildError struct {
+	Message    string
+	Derivation string
+	LogTail    []string
+}
+
+func (e *BuildError) Error() string {
+	msg := fmt.Sprintf("build of %s failed: %s", e.Derivation, e.Message)
+	if len(e.LogTail) > 0 {
+		msg += "\nlast log lines:\n" + strings.Join(e.LogTail, "\n")
+	}
+	return msg
+}
+
+// MissingStorePathError is returned when a store path does not exist in a store.
+type MissingStorePathError struct {
+	Message string
+	Path    string
+}
+
+func (e *MissingStorePathError) Error() string {
+	return fmt.Sprintf("store path %s is missing: %s", e.Path, e.Message)
+}
+
+// ConnectionError is returned when nix is not able to connect to a store (ssh failure, unreachable host, ...).
+type ConnectionError struct {
+	Message string
+	Store   string
+}
+
+func (e *ConnectionError) Error() string {
+	if e.Store == "" {
+		return "unable to connect to store: " + e.Message
+	}
+	return fmt.Sprintf("unable to connect to store %s: %s", e.Store, e.Message)
+}
+
+// SignatureError is returned when a store refuses a store path because it is not signed by a trusted key.
+type SignatureError struct {
+	Message string
+	Path    string
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("store path %s signature rejected: %s", e.Path, e.Message)
+}
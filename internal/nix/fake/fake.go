@@ -0,0 +1,609 @@
+// Package fake provides an in-memory implementation of the nix interface, to test code relying on nix without a nix installation.
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/exp/maps"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+// GCRootDir is the directory in which garbage collector roots are created.
+const GCRootDir = "/fake/gcroots"
+
+// Nix is an in-memory implementation of nix.Nix.
+//
+// It holds a local store and remote stores containing valid store paths, and knows about
+// derivations and evaluation results that are configured beforehand.
+// Building a derivation makes the derivation and its outputs valid in the local store.
+type Nix struct {
+	m            sync.Mutex
+	derivations  map[string]nix.Derivation
+	evaluations  map[string]json.RawMessage
+	localStore   map[string]bool
+	remoteStores map[string]map[string]bool
+	pathInfos    map[string]nix.PathInfo
+	flakes       map[string]nix.FlakeMetadata
+	flakeOutputs map[string][]nix.FlakeOutput
+	flakeLocks   map[string]nix.FlakeMetadata
+	buildPlans   map[string]nix.BuildPlan
+	builds       []nix.BuildRequest
+	gcRoots      map[string]string
+	errors       map[string]error
+	calls        map[string]int
+}
+
+// New creates a new in-memory nix implementation with an empty local store.
+func New() *Nix {
+	return &Nix{
+		derivations:  make(map[string]nix.Derivation),
+		evaluations:  make(map[string]json.RawMessage),
+		localStore:   make(map[string]bool),
+		remoteStores: make(map[string]map[string]bool),
+		pathInfos:    make(map[string]nix.PathInfo),
+		flakes:       make(map[string]nix.FlakeMetadata),
+		flakeOutputs: make(map[string][]nix.FlakeOutput),
+		flakeLocks:   make(map[string]nix.FlakeMetadata),
+		buildPlans:   make(map[string]nix.BuildPlan),
+		gcRoots:      make(map[string]string),
+		errors:       make(map[string]error),
+		calls:        make(map[string]int),
+	}
+}
+
+// AddDerivation makes installable evaluate to the provided derivation.
+// The derivation can also be referenced by its derivation path, or its output paths.
+// Adding a derivation with an installable already known replaces the previous one.
+func (n *Nix) AddDerivation(installable string, derivation nix.Derivation) {
+	n.AddDerivationWithOptions(installable, nix.EvaluationOptions{}, derivation)
+}
+
+// AddDerivationWithOptions makes installable evaluate to the provided derivation when evaluated with the options.
+// The derivation can also be referenced by its derivation path, or its output paths, without options.
+func (n *Nix) AddDerivationWithOptions(installable string, options nix.EvaluationOptions, derivation nix.Derivation) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	n.derivations[derivationKey(installable, options)] = derivation
+	n.derivations[derivation.Path.Derivation] = derivation
+	for _, output := range derivation.Path.Outputs {
+		n.derivations[output] = derivation
+	}
+}
+
+// AddEvaluation makes the evaluation request evaluate to the json encoded result.
+func (n *Nix) AddEvaluation(req nix.EvaluateRequest, result any) error {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("unable to encode result: %v", err)
+	}
+
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	n.evaluations[requestKey(req)] = raw
+	return nil
+}
+
+// AddRemoteStore creates an empty remote store reachable at the provided url.
+func (n *Nix) AddRemoteStore(url string) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	n.remoteStores[url] = make(map[string]bool)
+}
+
+// AddStorePath makes store paths valid in the store (the local store if store is empty).
+// The store is created if it does not exist.
+func (n *Nix) AddStorePath(store string, storePaths ...string) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	for _, storePath := range storePaths {
+		n.store(store)[storePath] = true
+	}
+}
+
+// SetPathInfo sets the metadata (like nar size or references) of a store path, whatever the store it is in.
+// Validity and closure related fields are ignored, they are computed from the content of the store.
+func (n *Nix) SetPathInfo(info nix.PathInfo) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	n.pathInfos[info.Path] = info
+}
+
+// AddFlake makes the flake reference resolve to the provided metadata.
+func (n *Nix) AddFlake(flake string, metadata nix.FlakeMetadata) {
+	n.AddFlakeWithOptions(flake, nix.EvaluationOptions{}, metadata)
+}
+
+// AddFlakeWithOptions makes the flake reference resolve to the provided metadata when read with the options (like overridden inputs).
+func (n *Nix) AddFlakeWithOptions(flake string, options nix.EvaluationOptions, metadata nix.FlakeMetadata) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	n.flakes[derivationKey(flake, options)] = metadata
+}
+
+// AddFlakeOutputs makes the request list the provided flake outputs.
+func (n *Nix) AddFlakeOutputs(req nix.FlakeOutputsRequest, outputs ...nix.FlakeOutput) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	n.flakeOutputs[requestKey(req)] = outputs
+}
+
+// AddBuildPlan makes planning the build of installable, evaluated with options, return the provided plan.
+func (n *Nix) AddBuildPlan(installable string, options nix.EvaluationOptions, plan nix.BuildPlan) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	n.buildPlans[derivationKey(installable, options)] = plan
+}
+
+// AddFlakeLock makes the lock request succeed, the flake then resolves to the provided metadata.
+func (n *Nix) AddFlakeLock(req nix.FlakeLockRequest, metadata nix.FlakeMetadata) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	n.flakeLocks[requestKey(req)] = metadata
+}
+
+// DeleteStorePath removes store paths from the store (the local store if store is empty), like the garbage collector would.
+func (n *Nix) DeleteStorePath(store string, storePaths ...string) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	for _, storePath := range storePaths {
+		delete(n.store(store), storePath)
+	}
+}
+
+// StorePathExists returns whether the store path is valid in the store (the local store if store is empty).
+func (n *Nix) StorePathExists(store string, storePath string) bool {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	return n.store(store)[storePath]
+}
+
+// GCRoots returns the garbage collector roots, and the store path they protect.
+func (n *Nix) GCRoots() map[string]string {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	return maps.Clone(n.gcRoots)
+}
+
+// SetError makes the calls to the method (like "Build") of the nix interface fail with err, until it is set to nil.
+func (n *Nix) SetError(method string, err error) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if err == nil {
+		delete(n.errors, method)
+	} else {
+		n.errors[method] = err
+	}
+}
+
+// Calls returns the number of calls made to the method (like "Build") of the nix interface.
+func (n *Nix) Calls(method string) int {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	return n.calls[method]
+}
+
+// BuildRequests returns the requests made to Build, in order.
+func (n *Nix) BuildRequests() []nix.BuildRequest {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	return slices.Clone(n.builds)
+}
+
+// EvaluateExpression implements nix.Nix.
+func (n *Nix) EvaluateExpression(_ context.Context, req nix.EvaluateRequest) (json.RawMessage, error) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if err := n.call("EvaluateExpression"); err != nil {
+		return nil, err
+	}
+
+	result, exists := n.evaluations[requestKey(req)]
+	if !exists {
+		return nil, &nix.EvaluationError{Message: fmt.Sprintf("unable to evaluate %q", req.Installable)}
+	}
+
+	return result, nil
+}
+
+// Build implements nix.Nix.
+func (n *Nix) Build(_ context.Context, req nix.BuildRequest) (*nix.StorePath, error) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	n.builds = append(n.builds, req)
+	if err := n.call("Build"); err != nil {
+		return nil, err
+	}
+
+	installable, outputNames, _ := strings.Cut(req.Installable, "^")
+
+	derivation, err := n.derivation(installable, req.EvaluationOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	storePath := nix.StorePath{
+		Derivation: derivation.Path.Derivation,
+		Output:     derivation.Path.Output,
+		Outputs:    maps.Clone(derivation.Path.Outputs),
+	}
+
+	if outputNames != "" && outputNames != "*" {
+		storePath.Outputs = make(map[string]string)
+		for _, name := range strings.Split(outputNames, ",") {
+			output, exists := derivation.Path.Outputs[name]
+			if !exists {
+				return nil, &nix.EvaluationError{Message: fmt.Sprintf("derivation %q does not have an output named %q", derivation.Path.Derivation, name)}
+			}
+			storePath.Outputs[name] = output
+		}
+
+		names := maps.Keys(storePath.Outputs)
+		slices.Sort(names)
+		if _, exists := storePath.Outputs["out"]; exists {
+			storePath.Output = storePath.Outputs["out"]
+		} else {
+			storePath.Output = storePath.Outputs[names[0]]
+		}
+	}
+
+	n.localStore[storePath.Derivation] = true
+	for _, output := range storePath.Outputs {
+		n.localStore[output] = true
+	}
+
+	return &storePath, nil
+}
+
+// PlanBuild implements nix.Nix.
+// Without plan added by AddBuildPlan, the derivation is planned to be built if one of its outputs is not in the local store.
+func (n *Nix) PlanBuild(_ context.Context, installable string, options nix.EvaluationOptions) (*nix.BuildPlan, error) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if err := n.call("PlanBuild"); err != nil {
+		return nil, err
+	}
+
+	installable, _, _ = strings.Cut(installable, "^")
+	if plan, exists := n.buildPlans[derivationKey(installable, options)]; exists {
+		return &plan, nil
+	}
+
+	derivation, err := n.derivation(installable, options)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, output := range derivation.Path.Outputs {
+		if !n.localStore[output] {
+			return &nix.BuildPlan{Derivations: []string{derivation.Path.Derivation}}, nil
+		}
+	}
+
+	return &nix.BuildPlan{}, nil
+}
+
+// DescribeDerivation implements nix.Nix.
+func (n *Nix) DescribeDerivation(_ context.Context, installable string, options nix.EvaluationOptions) (*nix.Derivation, error) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if err := n.call("DescribeDerivation"); err != nil {
+		return nil, err
+	}
+
+	derivation, err := n.derivation(installable, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &derivation, nil
+}
+
+// GetStorePath implements nix.Nix.
+func (n *Nix) GetStorePath(_ context.Context, installable string) (bool, *nix.StorePath, error) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if err := n.call("GetStorePath"); err != nil {
+		return false, nil, err
+	}
+
+	if !n.localStore[installable] {
+		return false, nil, nil
+	}
+
+	storePath := nix.StorePath{Output: installable}
+	if derivation, exists := n.derivations[installable]; exists {
+		storePath.Derivation = derivation.Path.Derivation
+	}
+
+	return true, &storePath, nil
+}
+
+// CopyStorePath implements nix.Nix.
+func (n *Nix) CopyStorePath(_ context.Context, req nix.CopyRequest) error {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if err := n.call("CopyStorePath"); err != nil {
+		return err
+	}
+
+	var from, to string
+	if req.From != nil {
+		from = *req.From
+	}
+	if req.To != nil {
+		to = *req.To
+	}
+
+	for _, store := range []string{from, to} {
+		if _, exists := n.remoteStores[store]; store != "" && !exists {
+			return &nix.ConnectionError{Message: "store does not exist", Store: store}
+		}
+	}
+
+	// the whole closure is copied
+	closure := []string{req.Installable}
+	for i := 0; i < len(closure); i++ {
+		if !n.store(from)[closure[i]] {
+			return &nix.MissingStorePathError{Message: "path is not valid", Path: closure[i]}
+		}
+		for _, reference := range n.pathInfos[closure[i]].References {
+			if !slices.Contains(closure, reference) {
+				closure = append(closure, reference)
+			}
+		}
+	}
+
+	for _, storePath := range closure {
+		n.store(to)[storePath] = true
+	}
+	return nil
+}
+
+// GetRemoteStorePath implements nix.Nix.
+func (n *Nix) GetRemoteStorePath(_ context.Context, req nix.RemoteStorePathRequest) (*nix.PathInfo, error) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if err := n.call("GetRemoteStorePath"); err != nil {
+		return nil, err
+	}
+
+	if _, exists := n.remoteStores[req.Store]; req.Store != "" && !exists {
+		return nil, &nix.ConnectionError{Message: "store does not exist", Store: req.Store}
+	}
+
+	store := n.store(req.Store)
+	if !store[req.Installable] {
+		return &nix.PathInfo{Path: req.Installable}, nil
+	}
+
+	info := n.pathInfos[req.Installable]
+	info.Path, info.Valid, info.ClosureComplete, info.ClosureSize = req.Installable, true, true, 0
+
+	seen := make(map[string]bool)
+	queue := []string{req.Installable}
+	for len(queue) > 0 {
+		storePath := queue[0]
+		queue = queue[1:]
+		if seen[storePath] {
+			continue
+		}
+		seen[storePath] = true
+
+		if !store[storePath] {
+			info.ClosureComplete, info.ClosureSize = false, 0
+			break
+		}
+		info.ClosureSize += n.pathInfos[storePath].NarSize
+		queue = append(queue, n.pathInfos[storePath].References...)
+	}
+
+	return &info, nil
+}
+
+// GetClosure implements nix.Nix.
+func (n *Nix) GetClosure(_ context.Context, req nix.RemoteStorePathRequest) ([]nix.PathInfo, error) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if err := n.call("GetClosure"); err != nil {
+		return nil, err
+	}
+
+	if _, exists := n.remoteStores[req.Store]; req.Store != "" && !exists {
+		return nil, &nix.ConnectionError{Message: "store does not exist", Store: req.Store}
+	}
+
+	store := n.store(req.Store)
+	seen := make(map[string]bool)
+	queue := []string{req.Installable}
+
+	var closure []nix.PathInfo
+	for len(queue) > 0 {
+		storePath := queue[0]
+		queue = queue[1:]
+		if seen[storePath] {
+			continue
+		}
+		seen[storePath] = true
+
+		if !store[storePath] {
+			return nil, &nix.MissingStorePathError{Message: "path is not valid", Path: storePath}
+		}
+
+		info := n.pathInfos[storePath]
+		info.Path, info.Valid = storePath, true
+		closure = append(closure, info)
+		queue = append(queue, info.References...)
+	}
+
+	slices.SortFunc(closure, func(a, b nix.PathInfo) int { return strings.Compare(a.Path, b.Path) })
+	return closure, nil
+}
+
+// GetFlakeMetadata implements nix.Nix.
+func (n *Nix) GetFlakeMetadata(_ context.Context, req nix.FlakeMetadataRequest) (*nix.FlakeMetadata, error) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if err := n.call("GetFlakeMetadata"); err != nil {
+		return nil, err
+	}
+
+	metadata, exists := n.flakes[derivationKey(req.Flake, req.EvaluationOptions)]
+	if !exists {
+		return nil, &nix.EvaluationError{Message: fmt.Sprintf("unable to find flake %q", req.Flake)}
+	}
+
+	return &metadata, nil
+}
+
+// LockFlake implements nix.Nix.
+func (n *Nix) LockFlake(_ context.Context, req nix.FlakeLockRequest) (*nix.FlakeMetadata, error) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if err := n.call("LockFlake"); err != nil {
+		return nil, err
+	}
+
+	metadata, exists := n.flakeLocks[requestKey(req)]
+	if !exists {
+		return nil, &nix.EvaluationError{Message: fmt.Sprintf("unable to lock flake %q", req.Flake)}
+	}
+
+	n.flakes[req.Flake] = metadata
+	return &metadata, nil
+}
+
+// GetFlakeOutputs implements nix.Nix.
+func (n *Nix) GetFlakeOutputs(_ context.Context, req nix.FlakeOutputsRequest) ([]nix.FlakeOutput, error) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if err := n.call("GetFlakeOutputs"); err != nil {
+		return nil, err
+	}
+
+	outputs, exists := n.flakeOutputs[requestKey(req)]
+	if !exists {
+		return nil, &nix.EvaluationError{Message: fmt.Sprintf("unable to find flake %q", req.Flake)}
+	}
+
+	outputs = slices.Clone(outputs)
+	slices.SortFunc(outputs, func(a, b nix.FlakeOutput) int { return slices.Compare(a.AttributePath, b.AttributePath) })
+	return outputs, nil
+}
+
+// AddGCRoot implements nix.Nix.
+func (n *Nix) AddGCRoot(_ context.Context, name string, storePath string) (string, error) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if err := n.call("AddGCRoot"); err != nil {
+		return "", err
+	}
+
+	if !n.localStore[storePath] {
+		return "", &nix.MissingStorePathError{Message: "path is not valid", Path: storePath}
+	}
+
+	root := path.Join(GCRootDir, name)
+	n.gcRoots[root] = storePath
+	return root, nil
+}
+
+// RemoveGCRoot implements nix.Nix.
+func (n *Nix) RemoveGCRoot(_ context.Context, root string) error {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if err := n.call("RemoveGCRoot"); err != nil {
+		return err
+	}
+
+	delete(n.gcRoots, root)
+	return nil
+}
+
+// GCRootExists implements nix.Nix.
+func (n *Nix) GCRootExists(_ context.Context, root string, storePath string) (bool, error) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if err := n.call("GCRootExists"); err != nil {
+		return false, err
+	}
+
+	return n.gcRoots[root] == storePath, nil
+}
+
+// call records the call to the method and returns the error to inject, if any.
+func (n *Nix) call(method string) error {
+	n.calls[method]++
+	return n.errors[method]
+}
+
+func (n *Nix) derivation(installable string, options nix.EvaluationOptions) (nix.Derivation, error) {
+	derivation, exists := n.derivations[derivationKey(installable, options)]
+	if !exists {
+		return nix.Derivation{}, &nix.EvaluationError{Message: fmt.Sprintf("unable to find installable %q", installable)}
+	}
+	return derivation, nil
+}
+
+func (n *Nix) store(url string) map[string]bool {
+	if url == "" {
+		return n.localStore
+	}
+
+	store, exists := n.remoteStores[url]
+	if !exists {
+		store = make(map[string]bool)
+		n.remoteStores[url] = store
+	}
+
+	return store
+}
+
+// derivationKey identifies an installable evaluated with options.
+func derivationKey(installable string, options nix.EvaluationOptions) string {
+	if options.IsZero() {
+		return installable
+	}
+	return requestKey(nix.EvaluateRequest{EvaluationOptions: options, Installable: installable})
+}
+
+// requestKey identifies a request, to find the result configured for it.
+func requestKey(req any) string {
+	raw, _ := json.Marshal(req)
+	return string(raw)
+}
@@ -6,30 +6,64 @@ import (
 )
 
 // Nix exposes ways to interact with nix.
+// When possible, implementations return errors of this package's error types (EvaluationError, BuildError, ...).
 type Nix interface {
 	// EvaluateExpression evaluate a nix expression.
 	EvaluateExpression(ctx context.Context, req EvaluateRequest) (json.RawMessage, error)
 
 	// Build a derivation or fetch a store path.
-	Build(ctx context.Context, installable string) (*StorePath, error)
+	Build(ctx context.Context, req BuildRequest) (*StorePath, error)
+
+	// PlanBuild tells what building the installable would do: the derivations to build, and the store paths to fetch.
+	PlanBuild(ctx context.Context, installable string, options EvaluationOptions) (*BuildPlan, error)
 
 	// DescribeDerivation queries information about a store paths.
-	DescribeDerivation(ctx context.Context, installable string) (*Derivation, error)
+	DescribeDerivation(ctx context.Context, installable string, options EvaluationOptions) (*Derivation, error)
 
 	// GetStorePath returns a store path and whenever it is valid.
+	// Store paths missing from the store are reported as not valid, without error.
 	GetStorePath(ctx context.Context, installable string) (bool, *StorePath, error)
 
 	// CopyStorePath copies store path closures between two Nix stores.
 	CopyStorePath(ctx context.Context, req CopyRequest) error
 
-	// RemoteStorePathExists checks whether a nix store path exists.
-	RemoteStorePathExists(ctx context.Context, req RemoteStorePathExistsRequest) (bool, error)
+	// GetRemoteStorePath queries information about a store path in a store (the default store if none is provided), and whether its closure is complete.
+	// Store paths missing from the store are reported as not valid, without error.
+	GetRemoteStorePath(ctx context.Context, req RemoteStorePathRequest) (*PathInfo, error)
+
+	// GetClosure queries information about every store path of the closure of a store path in a store (the default store if none is provided).
+	// Store paths are sorted by path, an error of type MissingStorePathError is returned if any of them is missing.
+	GetClosure(ctx context.Context, req RemoteStorePathRequest) ([]PathInfo, error)
+
+	// GetFlakeMetadata resolves and locks a flake, and describes it along with its locked inputs.
+	GetFlakeMetadata(ctx context.Context, req FlakeMetadataRequest) (*FlakeMetadata, error)
+
+	// GetFlakeOutputs lists the outputs of a flake, like packages or nixos configurations, sorted by attribute path.
+	GetFlakeOutputs(ctx context.Context, req FlakeOutputsRequest) ([]FlakeOutput, error)
+
+	// LockFlake writes the lock file of a local flake, locking missing inputs and updating the requested ones.
+	// It returns the flake metadata once locked.
+	LockFlake(ctx context.Context, req FlakeLockRequest) (*FlakeMetadata, error)
+
+	// AddGCRoot registers an indirect garbage collector root named name, protecting the store path from garbage collection.
+	// It returns the path of the created root.
+	AddGCRoot(ctx context.Context, name string, storePath string) (string, error)
+
+	// RemoveGCRoot removes a garbage collector root created by AddGCRoot.
+	// Removing a root that does not exist is not an error.
+	RemoveGCRoot(ctx context.Context, root string) error
+
+	// GCRootExists checks whether the garbage collector root exists and still protects the store path.
+	GCRootExists(ctx context.Context, root string, storePath string) (bool, error)
 }
 
 // StorePath defines the path on the filesystem, usually on /nix/store, of the derivation and its outputs.
 type StorePath struct {
 	Derivation string
-	Output     string
+	// Output is the path of the main output of the derivation: out, or the first output by name if out does not exist.
+	Output string
+	// Outputs maps each output name of the derivation to its path.
+	Outputs map[string]string
 }
 
 // Derivation description.
@@ -37,14 +71,261 @@ type Derivation struct {
 	Name   string
 	Path   StorePath
 	System string
+	// Builder is the program run to build the derivation, with Args as arguments and Env as environment.
+	Builder string
+	Args    []string
+	Env     map[string]string
+	// InputDerivations maps the path of each derivation the build depends on to the names of the outputs it uses.
+	InputDerivations map[string][]string
+	// InputSources are the store paths, not built by derivations, the build depends on.
+	InputSources []string
+	// Outputs describes each output of the derivation, by name.
+	Outputs map[string]DerivationOutput
+}
+
+// DerivationOutput describes an output of a derivation.
+type DerivationOutput struct {
+	// Path of the output, empty for content addressed outputs which are only known once built.
+	Path string
+	// HashAlgorithm is set for fixed output and content addressed outputs (like sha256, or r:sha256 for hashes of the whole directory).
+	HashAlgorithm string
+	// Hash is the expected hash of fixed output outputs.
+	Hash string
+	// Impure is set for outputs of impure derivations, that are built again each time.
+	Impure bool
+}
+
+// FixedOutput returns whether the outputs of the derivation are fixed: their hash is known before building them.
+func (d Derivation) FixedOutput() bool {
+	for _, output := range d.Outputs {
+		if output.Hash == "" {
+			return false
+		}
+	}
+	return len(d.Outputs) > 0
+}
+
+// ContentAddressed returns whether the derivation has floating content addressed outputs: their path is computed from their content once built.
+func (d Derivation) ContentAddressed() bool {
+	for _, output := range d.Outputs {
+		if output.HashAlgorithm != "" && output.Hash == "" && !output.Impure {
+			return true
+		}
+	}
+	return false
+}
+
+// Impure returns whether the derivation is impure: it can access the network, and is built again each time.
+func (d Derivation) Impure() bool {
+	for _, output := range d.Outputs {
+		if output.Impure {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildPlan describes what a build would do.
+type BuildPlan struct {
+	// Derivations are the paths of the derivations that would be built, sorted.
+	Derivations []string
+	// Fetched are the store paths that would be fetched from substituters, sorted.
+	Fetched []string
+	// DownloadSize is the estimated size in bytes of the downloads of the fetched paths, possibly compressed.
+	// Like UnpackedSize, it is computed from the size nix prints, so it is only as precise as nix rounding (like 0.01 MiB).
+	DownloadSize int64
+	// UnpackedSize is the estimated size in bytes of the fetched paths once unpacked in the store.
+	UnpackedSize int64
+}
+
+// PathInfo describes a store path in a store.
+type PathInfo struct {
+	Path       string
+	Valid      bool
+	NarHash    string
+	NarSize    int64
+	Signatures []string
+	// ClosureComplete is true when the store path and all the store paths it references, recursively, are valid.
+	ClosureComplete bool
+	// ClosureSize is the sum of the nar size of every store path of the closure, it is only set when the closure is complete.
+	ClosureSize int64
+	References  []string
+	Deriver     string
+	// ContentAddress is set for content addressed store paths, like fixed output derivations outputs or sources added to the store.
+	ContentAddress string
+	// RegistrationTime is the unix time at which the store path was registered in the store.
+	RegistrationTime int64
 }
 
+// FlakeMetadata describes a locked flake.
+type FlakeMetadata struct {
+	Description string
+	// OriginalURL is the flake reference as provided, ResolvedURL is the reference after registry resolution,
+	// and LockedURL is the reference pinned to the fetched content.
+	OriginalURL string
+	ResolvedURL string
+	LockedURL   string
+	// Revision is the commit of the flake, it is empty for flakes that are not in a repository or have uncommitted changes.
+	Revision     string
+	RevCount     int64
+	LastModified int64
+	NarHash      string
+	// Path is the store path of the flake source.
+	Path string
+	// Inputs maps the path of every input of the lock file, like "nixpkgs" or "home-manager/nixpkgs", to its description.
+	Inputs map[string]FlakeInput
+	// LockFile is the json encoded lock file of the flake.
+	LockFile json.RawMessage
+}
+
+// FlakeInput describes an input of a locked flake.
+type FlakeInput struct {
+	// Follows is set to the path of the followed input for inputs following another input, other fields are not set.
+	Follows string
+	// Locked and Original are the attributes of the locked and original input references, like type, owner, or rev.
+	Locked       map[string]string
+	Original     map[string]string
+	Type         string
+	Revision     string
+	LastModified int64
+	NarHash      string
+	// Flake is false for inputs that are not flakes, like plain source trees.
+	Flake bool
+}
+
+// FlakeOutput describes an output of a flake.
+type FlakeOutput struct {
+	// AttributePath is the path of the output in the flake outputs, like ["packages", "x86_64-linux", "hello"].
+	AttributePath []string
+	// System is the system of per system outputs (like packages or apps), it is empty for other outputs.
+	System string
+	// Type is the kind of output, like derivation, app, nixos-configuration, or unknown.
+	Type string
+	// DerivationName is the name of the derivation for derivation outputs.
+	DerivationName string
+	Description    string
+}
+
+// EvaluationOptions defines how installables are evaluated.
+type EvaluationOptions struct {
+	// Expression is a nix expression evaluated instead of a flake, installables are then attribute paths of its result (possibly empty).
+	Expression string
+	// Args are nix expressions given, by name, to the evaluated value if it is a function.
+	Args map[string]string
+	// ArgStrs are strings given, by name, to the evaluated value if it is a function.
+	ArgStrs map[string]string
+	// Impure allows the evaluation to access the environment, like environment variables or files outside of flakes.
+	Impure bool
+	// PureEval, if set, overrides the pure-eval nix setting.
+	PureEval *bool
+	// AllowedURIs, if not nil, overrides the allowed-uris nix setting listing the URIs the evaluation can fetch.
+	AllowedURIs []string
+	// Env are environment variables set while evaluating, they can be read with builtins.getEnv by impure evaluations.
+	Env map[string]string
+	// InheritEnv, if not nil, restricts the environment variables inherited from the current process to the listed ones,
+	// along with the variables nix needs to run (PATH, HOME and NIX_* variables). An empty slice inherits only the latter.
+	InheritEnv []string
+	// OverrideInputs replaces, by input path, flake inputs of the evaluated flake by other flake references.
+	OverrideInputs map[string]string
+	// InputsFrom is a flake reference whose inputs are used to resolve flake references of the installable.
+	InputsFrom string
+	// LockFileMode, if set, overrides how the lock file of the evaluated flake is handled.
+	LockFileMode LockFileMode
+	// ReferenceLockFile, if set, is the lock file used instead of the flake lock file.
+	ReferenceLockFile string
+	// System, if set, overrides the system installables are evaluated and built for (like aarch64-linux).
+	System string
+}
+
+// IsZero returns whether the options are the default ones.
+func (o EvaluationOptions) IsZero() bool {
+	return o.Expression == "" && len(o.Args) == 0 && len(o.ArgStrs) == 0 &&
+		!o.Impure && o.PureEval == nil && o.AllowedURIs == nil && len(o.Env) == 0 && o.InheritEnv == nil &&
+		len(o.OverrideInputs) == 0 && o.InputsFrom == "" && o.LockFileMode == "" && o.ReferenceLockFile == "" && o.System == ""
+}
+
+// LockFileMode defines how nix handles the lock file of flakes it evaluates.
+type LockFileMode string
+
+const (
+	// LockFileModeStrict requires the lock file to be up to date, it is never written.
+	LockFileModeStrict LockFileMode = "strict"
+	// LockFileModeReadOnly locks missing inputs, without writing the lock file.
+	LockFileModeReadOnly LockFileMode = "readonly"
+	// LockFileModeAllowWrite locks missing inputs, and writes the lock file.
+	LockFileModeAllowWrite LockFileMode = "allow-write"
+	// LockFileModeRecreate ignores the lock file and locks every input again, without writing the lock file.
+	LockFileModeRecreate LockFileMode = "recreate"
+)
+
+// LockFileModes lists the supported lock file modes.
+var LockFileModes = []LockFileMode{LockFileModeStrict, LockFileModeReadOnly, LockFileModeAllowWrite, LockFileModeRecreate}
+
 // EvaluateRequest is the input parameter provided to the EvaluateExpression of the Nix interface.
 type EvaluateRequest struct {
+	EvaluationOptions
 	Installable string
 	Apply       *string
 }
 
+// BuildRequest is the input parameter provided to the Build method of the Nix interface.
+type BuildRequest struct {
+	EvaluationOptions
+	Installable string
+	Options     BuildOptions
+}
+
+// BuildOptions tunes how derivations are built, options that are not set use the nix configuration.
+type BuildOptions struct {
+	// MaxJobs is the maximum number of builds run in parallel locally, 0 only builds on remote builders.
+	MaxJobs *int64
+	// Cores is the number of cores each build can use, 0 uses all of them.
+	Cores *int64
+	// KeepGoing keeps building other derivations when a build fails.
+	KeepGoing *bool
+	// Fallback builds derivations from source when their outputs cannot be substituted.
+	Fallback *bool
+	// Timeout is the maximum duration of a build in seconds, 0 means no limit.
+	Timeout *int64
+	// MaxSilentTime is the maximum duration in seconds a build can run without writing logs, 0 means no limit.
+	MaxSilentTime *int64
+	// Sandbox builds derivations in a sandbox, isolated from the system.
+	Sandbox *bool
+	// Substitute fetches outputs from substituters instead of building them, when possible.
+	Substitute *bool
+	// Builders, if not nil, overrides the remote machines derivations can be built on, an empty slice only builds locally.
+	Builders []Builder
+	// ExtraPlatforms, if not nil, overrides the systems, other than the local one, that can be built locally (like i686-linux on x86_64-linux).
+	ExtraPlatforms []string
+}
+
+// IsZero returns whether the options are the default ones.
+func (o BuildOptions) IsZero() bool {
+	return o.MaxJobs == nil && o.Cores == nil && o.KeepGoing == nil && o.Fallback == nil &&
+		o.Timeout == nil && o.MaxSilentTime == nil && o.Sandbox == nil && o.Substitute == nil &&
+		o.Builders == nil && o.ExtraPlatforms == nil
+}
+
+// Builder describes a remote machine derivations can be built on.
+type Builder struct {
+	// URI of the machine store, like ssh-ng://builder@aarch64.example.com.
+	URI string
+	// Systems are the systems the machine builds for, like aarch64-linux, defaults to the local system.
+	Systems []string
+	// SSHKey is the path of the ssh private key used to connect to the machine, ssh defaults are used if empty.
+	SSHKey string
+	// MaxJobs is the maximum number of builds run in parallel on the machine, defaults to 1.
+	MaxJobs int64
+	// SpeedFactor is the relative speed of the machine, faster machines are preferred, defaults to 1.
+	SpeedFactor int64
+	// SupportedFeatures are the system features of the machine, like kvm or big-parallel.
+	SupportedFeatures []string
+	// MandatoryFeatures are the features derivations have to require to be built on the machine.
+	MandatoryFeatures []string
+	// PublicHostKey is the base64 encoded public host key of the machine, ssh known hosts are used if empty.
+	PublicHostKey string
+}
+
 // CopyRequest is the input parameter provided to the CopyStorePath method of the Nix interface.
 type CopyRequest struct {
 	Installable             string
@@ -55,9 +336,34 @@ type CopyRequest struct {
 	SSHOptions              []string
 }
 
-// RemoteStorePathExistsRequest is the input parameter provided to the RemoteStorePathExists method of the Nix interface.
-type RemoteStorePathExistsRequest struct {
+// RemoteStorePathRequest is the input parameter provided to the GetRemoteStorePath and GetClosure methods of the Nix interface.
+type RemoteStorePathRequest struct {
 	Installable string
 	Store       string
 	SSHOptions  []string
 }
+
+// FlakeMetadataRequest is the input parameter provided to the GetFlakeMetadata method of the Nix interface.
+// Only the options changing flake inputs and lock file handling apply, along with the evaluation environment.
+type FlakeMetadataRequest struct {
+	EvaluationOptions
+	Flake string
+	// OwnLockFile reads the flake with its own lock file, locking missing inputs without writing it,
+	// whatever the lock file mode and reference lock file are.
+	OwnLockFile bool
+}
+
+// FlakeLockRequest is the input parameter provided to the LockFlake method of the Nix interface.
+type FlakeLockRequest struct {
+	// Flake is the reference of a local flake, whose lock file can be written.
+	Flake string
+	// UpdateInputs are the inputs updated to their latest revision, other inputs are only locked if missing.
+	UpdateInputs []string
+}
+
+// FlakeOutputsRequest is the input parameter provided to the GetFlakeOutputs method of the Nix interface.
+type FlakeOutputsRequest struct {
+	Flake string
+	// AllSystems lists per system outputs of every system, instead of only the ones of the current system.
+	AllSystems bool
+}
@@ -0,0 +1,634 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/plancheck"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
+	"gotest.tools/v3/assert"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+	nixcli "github.com/krostar/terraform-provider-nix/internal/nix/cli"
+)
+
+// Acceptance tests run the provider against a real nix binary, they only run when TF_ACC is set.
+// They only rely on the flake in testdata/flake and on temporary stores, so they can run offline.
+
+// testAccProviderFactories returns provider factories for acceptance tests, the provider uses the nix cli.
+func testAccProviderFactories() map[string]func() (tfprotov6.ProviderServer, error) {
+	return map[string]func() (tfprotov6.ProviderServer, error){
+		"nix": providerserver.NewProtocol6WithError(New("test")()),
+	}
+}
+
+// testAccPreCheck ensures the environment is able to run acceptance tests.
+func testAccPreCheck(t *testing.T) {
+	if _, err := exec.LookPath("nix"); err != nil {
+		t.Fatalf("nix binary is required to run acceptance tests: %v", err)
+	}
+}
+
+// testAccProviderConfig returns the provider configuration, with substitutions disabled to stay offline.
+func testAccProviderConfig(gcRootDir string) string {
+	config := `
+provider "nix" {
+  experimental_features = ["nix-command", "flakes"]
+  extra_options         = { substituters = "" }
+`
+	if gcRootDir != "" {
+		config += fmt.Sprintf("  gc_root_dir           = %q\n", gcRootDir)
+	}
+	return config + "}\n"
+}
+
+// testAccFlake copies the flake fixture to a temporary directory, and returns the flake reference to use in installables.
+func testAccFlake(t *testing.T, version string) (string, string) {
+	dir := t.TempDir()
+
+	raw, err := os.ReadFile(filepath.Join("testdata", "flake", "flake.nix"))
+	assert.NilError(t, err)
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "flake.nix"), raw, 0o600))
+	testAccSetFlakeVersion(t, dir, version)
+
+	return "path:" + dir, dir
+}
+
+// testAccSetFlakeVersion changes the version of the flake fixture, which changes all its derivations.
+func testAccSetFlakeVersion(t *testing.T, dir, version string) {
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "version"), []byte(version+"\n"), 0o600))
+}
+
+// testAccCheckStorePathValid checks the store path stored in the attribute of the resource is valid in the store.
+func testAccCheckStorePathValid(store, name, key string, valid bool) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, found := s.RootModule().Resources[name]
+		if !found {
+			return fmt.Errorf("resource %s not found", name)
+		}
+
+		storePath := rs.Primary.Attributes[key]
+		pathInfo, err := nixcli.New(nixcli.Config{ExperimentalFeatures: []string{"nix-command"}}).
+			GetRemoteStorePath(context.Background(), nix.RemoteStorePathRequest{Installable: storePath, Store: store})
+		if err != nil {
+			return fmt.Errorf("unable to get store path %q info from store %q: %v", storePath, store, err)
+		}
+
+		if pathInfo.Valid != valid {
+			return fmt.Errorf("expected store path %q validity in store %q to be %t", storePath, store, valid)
+		}
+
+		return nil
+	}
+}
+
+// testAccCheckFileContent checks the file at the path stored in the attribute of the resource has the expected content.
+func testAccCheckFileContent(name, key, expected string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, found := s.RootModule().Resources[name]
+		if !found {
+			return fmt.Errorf("resource %s not found", name)
+		}
+
+		raw, err := os.ReadFile(rs.Primary.Attributes[key])
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %v", key, err)
+		}
+
+		if content := strings.TrimSpace(string(raw)); content != expected {
+			return fmt.Errorf("expected %s content to be %q, got %q", key, expected, content)
+		}
+
+		return nil
+	}
+}
+
+func TestAcc_resourceStorePath(t *testing.T) {
+	flake, flakeDir := testAccFlake(t, "1")
+	gcRootDir := filepath.Join(t.TempDir(), "gcroots")
+
+	config := testAccProviderConfig(gcRootDir) + fmt.Sprintf(`
+resource "nix_store_path" "hello" {
+  installable = "%[1]s#hello"
+  gc_root     = true
+}
+
+resource "nix_store_path" "multi" {
+  installable  = "%[1]s#multi"
+  output_names = ["dev", "out"]
+}
+`, flake)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProviderFactories(),
+		CheckDestroy: func(*terraform.State) error {
+			roots, err := os.ReadDir(gcRootDir)
+			if err != nil {
+				return err
+			}
+			if len(roots) > 0 {
+				return fmt.Errorf("expected garbage collector roots to be removed, got %d", len(roots))
+			}
+			return nil
+		},
+		Steps: []resource.TestStep{{
+			Config: config,
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestMatchResourceAttr("nix_store_path.hello", "drv_path", regexp.MustCompile(`^/nix/store/[a-z0-9]{32}-hello-1\.drv$`)),
+				resource.TestMatchResourceAttr("nix_store_path.hello", "output_path", regexp.MustCompile(`^/nix/store/[a-z0-9]{32}-hello-1$`)),
+				resource.TestMatchResourceAttr("nix_store_path.hello", "gc_roots.out", regexp.MustCompile("^"+regexp.QuoteMeta(gcRootDir)+"/")),
+				testAccCheckFileContent("nix_store_path.hello", "output_path", "hello 1"),
+				testAccCheckFileContent("nix_store_path.hello", "gc_roots.out", "hello 1"),
+				resource.TestCheckResourceAttr("nix_store_path.multi", "outputs.%", "2"),
+				resource.TestCheckResourceAttrPair("nix_store_path.multi", "output_path", "nix_store_path.multi", "outputs.dev"),
+				testAccCheckFileContent("nix_store_path.multi", "outputs.dev", "dev"),
+				testAccCheckFileContent("nix_store_path.multi", "outputs.out", "out"),
+			),
+		}, {
+			Config: config,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{plancheck.ExpectEmptyPlan()},
+			},
+		}, {
+			PreConfig: func() { testAccSetFlakeVersion(t, flakeDir, "2") },
+			Config:    config,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{
+					plancheck.ExpectResourceAction("nix_store_path.hello", plancheck.ResourceActionUpdate),
+					plancheck.ExpectResourceAction("nix_store_path.multi", plancheck.ResourceActionUpdate),
+				},
+			},
+			Check: resource.ComposeAggregateTestCheckFunc(
+				testAccCheckFileContent("nix_store_path.hello", "output_path", "hello 2"),
+				testAccCheckFileContent("nix_store_path.hello", "gc_roots.out", "hello 2"),
+				resource.TestMatchResourceAttr("nix_store_path.multi", "drv_path", regexp.MustCompile(`-multi-2\.drv$`)),
+			),
+		}},
+	})
+}
+
+func TestAcc_resourceStorePathCopy(t *testing.T) {
+	flake, _ := testAccFlake(t, "1")
+	binaryCache := "file://" + t.TempDir()
+	localStore := "local?root=" + t.TempDir()
+
+	config := testAccProviderConfig("") + fmt.Sprintf(`
+resource "nix_store_path" "hello" {
+  installable = "%s#hello"
+}
+
+resource "nix_store_path_copy" "binary_cache" {
+  store_path = nix_store_path.hello.output_path
+  to         = %q
+}
+
+resource "nix_store_path_copy" "local_store" {
+  store_path = nix_store_path.hello.output_path
+  to         = %q
+  check_sigs = false
+}
+`, flake, binaryCache, localStore)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProviderFactories(),
+		Steps: []resource.TestStep{{
+			Config: config,
+			Check: resource.ComposeAggregateTestCheckFunc(
+				testAccCheckStorePathValid(binaryCache, "nix_store_path_copy.binary_cache", "store_path", true),
+				testAccCheckStorePathValid(localStore, "nix_store_path_copy.local_store", "store_path", true),
+			),
+		}, {
+			Config: config,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{plancheck.ExpectEmptyPlan()},
+			},
+		}, {
+			PreConfig: func() {
+				narInfos, err := filepath.Glob(filepath.Join(strings.TrimPrefix(binaryCache, "file://"), "*.narinfo"))
+				assert.NilError(t, err)
+				assert.Assert(t, len(narInfos) > 0)
+				for _, narInfo := range narInfos {
+					assert.NilError(t, os.Remove(narInfo))
+				}
+			},
+			Config: config,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{
+					plancheck.ExpectResourceAction("nix_store_path_copy.binary_cache", plancheck.ResourceActionCreate),
+					plancheck.ExpectResourceAction("nix_store_path_copy.local_store", plancheck.ResourceActionNoop),
+				},
+			},
+			Check: testAccCheckStorePathValid(binaryCache, "nix_store_path_copy.binary_cache", "store_path", true),
+		}},
+	})
+}
+
+func TestAcc_resourceStorePathCopy_missingStorePath(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProviderFactories(),
+		Steps: []resource.TestStep{{
+			Config: testAccProviderConfig("") + fmt.Sprintf(`
+resource "nix_store_path_copy" "this" {
+  store_path = "/nix/store/00000000000000000000000000000000-missing"
+  to         = %q
+}
+`, "file://"+t.TempDir()),
+			ExpectError: regexp.MustCompile(`Unable to copy`),
+		}},
+	})
+}
+
+func TestAcc_dataSourceEval(t *testing.T) {
+	flake, _ := testAccFlake(t, "1")
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProviderFactories(),
+		Steps: []resource.TestStep{{
+			Config: testAccProviderConfig("") + fmt.Sprintf(`
+data "nix_eval" "greeting" {
+  installable = "%[1]s#lib.greeting"
+}
+
+data "nix_eval" "names" {
+  installable = "%[1]s#lib.greeting"
+  apply       = "greeting: builtins.concatStringsSep \", \" greeting.names"
+}
+`, flake),
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("data.nix_eval.greeting", "output", `{"message":"hello","names":["world","nix"]}`),
+				resource.TestCheckResourceAttr("data.nix_eval.greeting", "value.message", "hello"),
+				resource.TestCheckResourceAttr("data.nix_eval.greeting", "value.names.1", "nix"),
+				resource.TestCheckResourceAttr("data.nix_eval.names", "output", `"world, nix"`),
+				resource.TestCheckResourceAttr("data.nix_eval.names", "value", "world, nix"),
+			),
+		}, {
+			Config: testAccProviderConfig("") + `
+data "nix_eval" "pure" {
+  expr     = "builtins.getEnv \"GREETING\""
+  eval_env = { GREETING = "hello" }
+}
+
+data "nix_eval" "impure" {
+  expr     = "builtins.getEnv \"GREETING\""
+  impure   = true
+  eval_env = { GREETING = "hello" }
+}
+`,
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("data.nix_eval.pure", "output", `""`),
+				resource.TestCheckResourceAttr("data.nix_eval.pure", "impure", "false"),
+				resource.TestCheckResourceAttr("data.nix_eval.impure", "output", `"hello"`),
+				resource.TestCheckResourceAttr("data.nix_eval.impure", "impure", "true"),
+			),
+		}, {
+			Config: testAccProviderConfig("") + fmt.Sprintf(`
+data "nix_eval" "this" {
+  installable = "%s#lib.doesNotExist"
+}
+`, flake),
+			ExpectError: regexp.MustCompile(`Unable to evaluate expression: evaluation failed`),
+		}},
+	})
+}
+
+func TestAcc_dataSourceDerivation(t *testing.T) {
+	flake, _ := testAccFlake(t, "1")
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProviderFactories(),
+		Steps: []resource.TestStep{{
+			Config: testAccProviderConfig("") + fmt.Sprintf(`
+data "nix_derivation" "all" {
+  installable = "%[1]s#multi"
+}
+
+data "nix_derivation" "doc" {
+  installable  = "%[1]s#multi"
+  output_names = ["doc"]
+}
+`, flake),
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestMatchResourceAttr("data.nix_derivation.all", "drv_path", regexp.MustCompile(`^/nix/store/[a-z0-9]{32}-multi-1\.drv$`)),
+				resource.TestMatchResourceAttr("data.nix_derivation.all", "output_path", regexp.MustCompile(`^/nix/store/[a-z0-9]{32}-multi-1$`)),
+				resource.TestCheckResourceAttr("data.nix_derivation.all", "outputs.%", "3"),
+				resource.TestMatchResourceAttr("data.nix_derivation.all", "outputs.dev", regexp.MustCompile(`-multi-1-dev$`)),
+				resource.TestCheckResourceAttrPair("data.nix_derivation.doc", "output_path", "data.nix_derivation.all", "outputs.doc"),
+				resource.TestCheckResourceAttrSet("data.nix_derivation.all", "system"),
+				resource.TestCheckResourceAttrSet("data.nix_derivation.all", "builder"),
+				resource.TestCheckResourceAttr("data.nix_derivation.all", "derivation_outputs.%", "3"),
+				resource.TestCheckResourceAttr("data.nix_derivation.all", "fixed_output", "false"),
+			),
+		}},
+	})
+}
+
+func TestAcc_dataSourceBuildPlan(t *testing.T) {
+	flake, _ := testAccFlake(t, "1")
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProviderFactories(),
+		Steps: []resource.TestStep{{
+			Config: testAccProviderConfig("") + fmt.Sprintf(`
+data "nix_build_plan" "multi" {
+  installable = "%[1]s#multi"
+}
+`, flake),
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("data.nix_build_plan.multi", "up_to_date", "false"),
+				resource.TestMatchResourceAttr("data.nix_build_plan.multi", "derivations.0", regexp.MustCompile(`-multi-1\.drv$`)),
+			),
+		}, {
+			Config: testAccProviderConfig("") + fmt.Sprintf(`
+resource "nix_store_path" "multi" {
+  installable = "%[1]s#multi"
+}
+
+data "nix_build_plan" "multi" {
+  installable = "%[1]s#multi"
+
+  depends_on = [nix_store_path.multi]
+}
+`, flake),
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("data.nix_build_plan.multi", "up_to_date", "true"),
+				resource.TestCheckResourceAttr("data.nix_build_plan.multi", "derivations.#", "0"),
+			),
+		}},
+	})
+}
+
+func TestAcc_dataSourcePathInfo(t *testing.T) {
+	flake, _ := testAccFlake(t, "1")
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProviderFactories(),
+		Steps: []resource.TestStep{{
+			Config: testAccProviderConfig("") + fmt.Sprintf(`
+resource "nix_store_path" "hello" {
+  installable = "%s#hello"
+}
+
+data "nix_path_info" "hello" {
+  installable = nix_store_path.hello.output_path
+}
+`, flake),
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttrPair("data.nix_path_info.hello", "path", "nix_store_path.hello", "output_path"),
+				resource.TestCheckResourceAttrPair("data.nix_path_info.hello", "deriver", "nix_store_path.hello", "drv_path"),
+				resource.TestCheckResourceAttr("data.nix_path_info.hello", "valid", "true"),
+				resource.TestCheckResourceAttr("data.nix_path_info.hello", "closure_complete", "true"),
+				resource.TestMatchResourceAttr("data.nix_path_info.hello", "nar_hash", regexp.MustCompile(`^sha256[-:]`)),
+				resource.TestCheckResourceAttrPair("data.nix_path_info.hello", "closure_size", "data.nix_path_info.hello", "nar_size"),
+				resource.TestCheckResourceAttr("data.nix_path_info.hello", "references.#", "0"),
+				resource.TestCheckResourceAttrSet("data.nix_path_info.hello", "registration_time"),
+			),
+		}, {
+			// flake installables are resolved to their output, not to another path of their closure
+			Config: testAccProviderConfig("") + fmt.Sprintf(`
+resource "nix_store_path" "greeter" {
+  installable = "%[1]s#greeter"
+}
+
+data "nix_path_info" "greeter" {
+  installable = "%[1]s#greeter"
+
+  depends_on = [nix_store_path.greeter]
+}
+`, flake),
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttrPair("data.nix_path_info.greeter", "path", "nix_store_path.greeter", "output_path"),
+				resource.TestCheckResourceAttrPair("data.nix_path_info.greeter", "deriver", "nix_store_path.greeter", "drv_path"),
+				resource.TestCheckResourceAttr("data.nix_path_info.greeter", "references.#", "1"),
+				resource.TestCheckResourceAttr("data.nix_path_info.greeter", "closure_complete", "true"),
+			),
+		}},
+	})
+}
+
+func TestAcc_dataSourceClosure(t *testing.T) {
+	flake, _ := testAccFlake(t, "1")
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProviderFactories(),
+		Steps: []resource.TestStep{{
+			Config: testAccProviderConfig("") + fmt.Sprintf(`
+resource "nix_store_path" "hello" {
+  installable = "%s#hello"
+}
+
+data "nix_closure" "hello" {
+  installable = nix_store_path.hello.output_path
+}
+
+data "nix_path_info" "hello" {
+  installable = nix_store_path.hello.output_path
+}
+`, flake),
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("data.nix_closure.hello", "path_count", "1"),
+				resource.TestCheckResourceAttrPair("data.nix_closure.hello", "paths.0.path", "nix_store_path.hello", "output_path"),
+				resource.TestCheckResourceAttrPair("data.nix_closure.hello", "paths.0.nar_hash", "data.nix_path_info.hello", "nar_hash"),
+				resource.TestCheckResourceAttrPair("data.nix_closure.hello", "closure_size", "data.nix_path_info.hello", "closure_size"),
+			),
+		}},
+	})
+}
+
+func TestAcc_dataSourceFlakeMetadata(t *testing.T) {
+	flake, _ := testAccFlake(t, "1")
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProviderFactories(),
+		Steps: []resource.TestStep{{
+			Config: testAccProviderConfig("") + fmt.Sprintf(`
+data "nix_flake_metadata" "test" {
+  flake = "%s"
+}
+`, flake),
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("data.nix_flake_metadata.test", "original_url", flake),
+				resource.TestMatchResourceAttr("data.nix_flake_metadata.test", "locked_url", regexp.MustCompile(`narHash=sha256-`)),
+				resource.TestMatchResourceAttr("data.nix_flake_metadata.test", "nar_hash", regexp.MustCompile(`^sha256-`)),
+				resource.TestCheckNoResourceAttr("data.nix_flake_metadata.test", "revision"),
+				resource.TestCheckResourceAttr("data.nix_flake_metadata.test", "inputs.%", "0"),
+				testAccCheckStorePathValid("", "data.nix_flake_metadata.test", "path", true),
+			),
+		}},
+	})
+}
+
+func TestAcc_resourceFlakeLock(t *testing.T) {
+	flake, dir := testAccFlake(t, "1")
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProviderFactories(),
+		Steps: []resource.TestStep{{
+			Config: testAccProviderConfig("") + fmt.Sprintf(`
+resource "nix_flake_lock" "test" {
+  flake = "%s"
+}
+`, flake),
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestMatchResourceAttr("nix_flake_lock.test", "lock_hash", regexp.MustCompile(`^[0-9a-f]{64}$`)),
+				resource.TestCheckResourceAttr("nix_flake_lock.test", "input_revisions.%", "0"),
+				func(*terraform.State) error {
+					_, err := os.Stat(filepath.Join(dir, "flake.lock"))
+					return err
+				},
+			),
+		}},
+	})
+}
+
+func TestAcc_resourceFlakeLock_inputs(t *testing.T) {
+	// flakes with local inputs, to lock them offline
+	dir, inputDir := t.TempDir(), t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(inputDir, "flake.nix"), []byte("{ outputs = _: { }; }\n"), 0o600))
+
+	writeFlake := func(inputs ...string) {
+		var content strings.Builder
+		content.WriteString("{\n  inputs = {\n")
+		for _, input := range inputs {
+			fmt.Fprintf(&content, "    %s.url = \"path:%s\";\n", input, inputDir)
+		}
+		content.WriteString("  };\n  outputs = _: { };\n}\n")
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, "flake.nix"), []byte(content.String()), 0o600))
+	}
+	writeFlake("first")
+
+	config := func(updateInputs string) string {
+		return testAccProviderConfig("") + fmt.Sprintf(`
+resource "nix_flake_lock" "test" {
+  flake         = "path:%s"
+  update_inputs = %s
+}
+`, dir, updateInputs)
+	}
+
+	checkLockFile := func(inputs ...string) resource.TestCheckFunc {
+		return func(s *terraform.State) error {
+			raw, err := os.ReadFile(filepath.Join(dir, "flake.lock"))
+			if err != nil {
+				return err
+			}
+			for _, input := range inputs {
+				if !strings.Contains(string(raw), fmt.Sprintf("%q", input)) {
+					return fmt.Errorf("input %s is not locked in the lock file: %s", input, raw)
+				}
+			}
+			return resource.TestMatchResourceAttr("nix_flake_lock.test", "lock_file", regexp.MustCompile(`"`+inputs[len(inputs)-1]+`"`))(s)
+		}
+	}
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProviderFactories(),
+		Steps: []resource.TestStep{{
+			Config: config("null"),
+			Check:  checkLockFile("first"),
+		}, {
+			// inputs added to the flake are missing from the lock file, the flake is locked again
+			PreConfig: func() { writeFlake("first", "second") },
+			Config:    config("null"),
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{plancheck.ExpectResourceAction("nix_flake_lock.test", plancheck.ResourceActionCreate)},
+			},
+			Check: checkLockFile("first", "second"),
+		}, {
+			Config: config(`["second"]`),
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{plancheck.ExpectResourceAction("nix_flake_lock.test", plancheck.ResourceActionUpdate)},
+			},
+			Check: resource.ComposeAggregateTestCheckFunc(
+				checkLockFile("first", "second"),
+				resource.TestCheckResourceAttr("nix_flake_lock.test", "update_inputs.0", "second"),
+			),
+		}},
+	})
+}
+
+func TestAcc_dataSourceFlakeOutputs(t *testing.T) {
+	flake, _ := testAccFlake(t, "1")
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProviderFactories(),
+		Steps: []resource.TestStep{{
+			Config: testAccProviderConfig("") + fmt.Sprintf(`
+data "nix_flake_outputs" "test" {
+  flake       = "%s"
+  all_systems = true
+}
+`, flake),
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("data.nix_flake_outputs.test", "outputs.packages.aarch64-darwin.hello.type", "derivation"),
+				resource.TestCheckResourceAttr("data.nix_flake_outputs.test", "outputs.packages.x86_64-linux.hello.derivation_name", "hello-1"),
+				resource.TestCheckResourceAttr("data.nix_flake_outputs.test", "outputs.packages.x86_64-linux.multi.system", "x86_64-linux"),
+				resource.TestCheckResourceAttr("data.nix_flake_outputs.test", "outputs.packages.x86_64-linux.multi.installable", flake+"#packages.x86_64-linux.multi"),
+				resource.TestCheckResourceAttr("data.nix_flake_outputs.test", "nixos_configurations.#", "0"),
+			),
+		}},
+	})
+}
+
+func TestAcc_resourceStorePath_expr(t *testing.T) {
+	config := func(message string) string {
+		return testAccProviderConfig("") + fmt.Sprintf(`
+data "nix_eval" "system" {
+  expr   = "builtins.currentSystem"
+  impure = true
+}
+
+resource "nix_store_path" "greeting" {
+  expr = <<-EOT
+    { system, greeting }: builtins.derivation {
+      inherit system;
+      name = "greeting";
+      builder = "/bin/sh";
+      args = ["-c" "echo $${greeting.message} $${toString greeting.times} > $out"];
+    }
+  EOT
+  args = {
+    greeting = { message = %q, times = 2 }
+  }
+  argstrs = {
+    system = data.nix_eval.system.value
+  }
+}
+`, message)
+	}
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:                 func() { testAccPreCheck(t) },
+		ProtoV6ProviderFactories: testAccProviderFactories(),
+		Steps: []resource.TestStep{{
+			Config: config("hello nix"),
+			Check:  testAccCheckFileContent("nix_store_path.greeting", "output_path", "hello nix 2"),
+		}, {
+			Config: config("bye"),
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{plancheck.ExpectResourceAction("nix_store_path.greeting", plancheck.ResourceActionUpdate)},
+			},
+			Check: testAccCheckFileContent("nix_store_path.greeting", "output_path", "bye 2"),
+		}},
+	})
+}
@@ -0,0 +1,104 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+// builderModel describes a remote builder, in the builders attribute of the provider and of nix_store_path build options.
+type builderModel struct {
+	URI               types.String `tfsdk:"uri"`
+	Systems           types.List   `tfsdk:"systems"`
+	SSHKey            types.String `tfsdk:"ssh_key"`
+	MaxJobs           types.Int64  `tfsdk:"max_jobs"`
+	SpeedFactor       types.Int64  `tfsdk:"speed_factor"`
+	SupportedFeatures types.List   `tfsdk:"supported_features"`
+	MandatoryFeatures types.List   `tfsdk:"mandatory_features"`
+	PublicHostKey     types.String `tfsdk:"public_host_key"`
+}
+
+// known returns whether every attribute of the builder is known.
+func (m builderModel) known() bool {
+	return !m.URI.IsUnknown() && !m.Systems.IsUnknown() && !m.SSHKey.IsUnknown() && !m.MaxJobs.IsUnknown() && !m.SpeedFactor.IsUnknown() &&
+		!m.SupportedFeatures.IsUnknown() && !m.MandatoryFeatures.IsUnknown() && !m.PublicHostKey.IsUnknown()
+}
+
+// nixBuilders returns the builders of the builders attribute at attrPath, nil if it is null, or not known yet.
+// An empty list returns an empty, non-nil, slice as it disables remote builders.
+func nixBuilders(ctx context.Context, attrPath path.Path, list types.List, diags *diag.Diagnostics) []nix.Builder {
+	if list.IsNull() || list.IsUnknown() {
+		return nil
+	}
+
+	var models []builderModel
+	if diags.Append(list.ElementsAs(ctx, &models, false)...); diags.HasError() {
+		return nil
+	}
+
+	builders := make([]nix.Builder, 0, len(models))
+	for i, model := range models {
+		if !model.known() {
+			return nil
+		}
+
+		builder := nix.Builder{
+			URI:           model.URI.ValueString(),
+			SSHKey:        model.SSHKey.ValueString(),
+			MaxJobs:       model.MaxJobs.ValueInt64(),
+			SpeedFactor:   model.SpeedFactor.ValueInt64(),
+			PublicHostKey: model.PublicHostKey.ValueString(),
+		}
+		diags.Append(model.Systems.ElementsAs(ctx, &builder.Systems, false)...)
+		diags.Append(model.SupportedFeatures.ElementsAs(ctx, &builder.SupportedFeatures, false)...)
+		diags.Append(model.MandatoryFeatures.ElementsAs(ctx, &builder.MandatoryFeatures, false)...)
+		if diags.HasError() {
+			return nil
+		}
+
+		validateBuilder(attrPath.AtListIndex(i), builder, diags)
+		builders = append(builders, builder)
+	}
+
+	return builders
+}
+
+// validateBuilder checks the builder can be written as a nix machine specification:
+// fields are separated by spaces, list elements by commas, and machines by semicolons.
+func validateBuilder(attrPath path.Path, builder nix.Builder, diags *diag.Diagnostics) {
+	fields := []struct {
+		name   string
+		values []string
+	}{
+		{"uri", []string{builder.URI}},
+		{"systems", builder.Systems},
+		{"ssh_key", []string{builder.SSHKey}},
+		{"supported_features", builder.SupportedFeatures},
+		{"mandatory_features", builder.MandatoryFeatures},
+		{"public_host_key", []string{builder.PublicHostKey}},
+	}
+	for _, field := range fields {
+		for _, value := range field.values {
+			if strings.ContainsAny(value, " \t\n,;") {
+				diags.AddAttributeError(
+					attrPath.AtName(field.name),
+					"Invalid builder",
+					fmt.Sprintf("%s cannot contain spaces, commas, nor semicolons, got %q.", field.name, value),
+				)
+			}
+		}
+	}
+
+	if builder.URI == "" {
+		diags.AddAttributeError(attrPath.AtName("uri"), "Invalid builder", "uri cannot be empty.")
+	}
+	if builder.MaxJobs < 0 || builder.SpeedFactor < 0 {
+		diags.AddAttributeError(attrPath, "Invalid builder", "max_jobs and speed_factor must be positive.")
+	}
+}
@@ -0,0 +1,218 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+type (
+	dataSourceBuildPlan struct {
+		nix        nix.Nix
+		evaluation nix.EvaluationOptions
+	}
+
+	dataSourceBuildPlanModel struct {
+		Installable       types.String  `tfsdk:"installable"`
+		Expr              types.String  `tfsdk:"expr"`
+		Args              types.Dynamic `tfsdk:"args"`
+		ArgStrs           types.Map     `tfsdk:"argstrs"`
+		Impure            types.Bool    `tfsdk:"impure"`
+		PureEval          types.Bool    `tfsdk:"pure_eval"`
+		AllowedURIs       types.List    `tfsdk:"allowed_uris"`
+		EvalEnv           types.Map     `tfsdk:"eval_env"`
+		InheritEnv        types.List    `tfsdk:"inherit_env"`
+		OverrideInputs    types.Map     `tfsdk:"override_inputs"`
+		InputsFrom        types.String  `tfsdk:"inputs_from"`
+		LockFileMode      types.String  `tfsdk:"lock_file_mode"`
+		ReferenceLockFile types.String  `tfsdk:"reference_lock_file"`
+		OutputNames       types.List    `tfsdk:"output_names"`
+		Derivations       types.List    `tfsdk:"derivations"`
+		Fetched           types.List    `tfsdk:"fetched"`
+		DownloadSize      types.Int64   `tfsdk:"download_size"`
+		UnpackedSize      types.Int64   `tfsdk:"unpacked_size"`
+		UpToDate          types.Bool    `tfsdk:"up_to_date"`
+	}
+)
+
+func newDataSourceBuildPlan() datasource.DataSource { return new(dataSourceBuildPlan) }
+
+func (*dataSourceBuildPlan) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_build_plan"
+}
+
+func (*dataSourceBuildPlan) Schema(_ context.Context, _ datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Tell what building an installable would do, without building it: the derivations to build, and the store paths to fetch from binary caches.",
+		Attributes: map[string]schema.Attribute{
+			"installable": schema.StringAttribute{
+				MarkdownDescription: "Nix installable (store path, nix packages, flake attribute, nix expressions, ...). When `expr` is provided, attribute path of the expression result to plan the build of, the whole result if not provided.",
+				Optional:            true,
+			},
+			"expr": schema.StringAttribute{
+				MarkdownDescription: "Nix expression to evaluate instead of a flake (like `import ./images.nix`). Nix evaluates expressions in pure mode: set `impure` to read files (like importing them) or the environment (like `builtins.currentSystem`).",
+				Optional:            true,
+			},
+			"args": schema.DynamicAttribute{
+				MarkdownDescription: "Arguments given by name to the evaluated expression if it is a function. Values are converted to nix values: objects and maps to attribute sets, lists, sets and tuples to lists.",
+				Optional:            true,
+			},
+			"argstrs": schema.MapAttribute{
+				MarkdownDescription: "String arguments given by name to the evaluated expression if it is a function.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"impure": schema.BoolAttribute{
+				MarkdownDescription: "Allow the evaluation to access the environment, like environment variables or files outside of the flake. Defaults to the provider `impure` attribute.",
+				Optional:            true,
+				Computed:            true,
+			},
+			"pure_eval": schema.BoolAttribute{
+				MarkdownDescription: "Override the `pure-eval` nix setting, defaults to the provider `pure_eval` attribute.",
+				Optional:            true,
+			},
+			"allowed_uris": schema.ListAttribute{
+				MarkdownDescription: "URI prefixes the evaluation is allowed to fetch (`allowed-uris` nix setting), defaults to the provider `allowed_uris` attribute.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"eval_env": schema.MapAttribute{
+				MarkdownDescription: "Environment variables set during the evaluation, readable with `builtins.getEnv` by impure evaluations. Merged with the provider `eval_env` attribute.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"inherit_env": schema.ListAttribute{
+				MarkdownDescription: "Restrict the environment variables the evaluation inherits from the provider process to the listed ones, along with `PATH`, `HOME` and `NIX_*` variables that nix needs, defaults to the provider `inherit_env` attribute. An empty list starts from a clean environment, `eval_env` variables are always set.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"override_inputs": schema.MapAttribute{
+				MarkdownDescription: "Flake inputs to override, by input path (like `nixpkgs` or `home-manager/nixpkgs`), with the flake reference to use instead (like `github:me/nixpkgs/my-branch`). The lock file is not updated.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"inputs_from": schema.StringAttribute{
+				MarkdownDescription: "Flake reference whose inputs are used to resolve flake references of the installable (like `nixpkgs` resolving to the nixpkgs input of this flake instead of the registry).",
+				Optional:            true,
+			},
+			"lock_file_mode": schema.StringAttribute{
+				MarkdownDescription: "How the lock file of the flake is handled, defaults to the provider `lock_file_mode` attribute. One of `strict` (the lock file must be up to date), `readonly` (missing inputs are locked without writing the lock file), `allow-write` (missing inputs are locked and the lock file is written), or `recreate` (every input is locked again, without writing the lock file).",
+				Optional:            true,
+			},
+			"reference_lock_file": schema.StringAttribute{
+				MarkdownDescription: "Path of a lock file to use instead of the lock file of the flake, defaults to the provider `reference_lock_file` attribute.",
+				Optional:            true,
+			},
+			"output_names": schema.ListAttribute{
+				MarkdownDescription: "Names of the derivation outputs to build (like `out` or `dev`), outputs nix builds by default are planned if not provided.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"derivations": schema.ListAttribute{
+				MarkdownDescription: "Paths of the derivations that would be built, sorted.",
+				ElementType:         types.StringType,
+				Computed:            true,
+			},
+			"fetched": schema.ListAttribute{
+				MarkdownDescription: "Store paths that would be fetched from binary caches, sorted.",
+				ElementType:         types.StringType,
+				Computed:            true,
+			},
+			"download_size": schema.Int64Attribute{
+				MarkdownDescription: "Estimated size in bytes of the downloads of the fetched store paths, as precise as the size printed by nix (rounded to two decimals, like 0.21 MiB).",
+				Computed:            true,
+			},
+			"unpacked_size": schema.Int64Attribute{
+				MarkdownDescription: "Estimated size in bytes of the fetched store paths, once unpacked in the store, as precise as the size printed by nix (rounded to two decimals, like 0.21 MiB).",
+				Computed:            true,
+			},
+			"up_to_date": schema.BoolAttribute{
+				MarkdownDescription: "Whether the outputs are already in the store: nothing would be built nor fetched.",
+				Computed:            true,
+			},
+		},
+	}
+}
+
+func (d *dataSourceBuildPlan) Configure(_ context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	data, ok := req.ProviderData.(*providerData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected configure data type",
+			fmt.Sprintf("Expected provider data, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.nix, d.evaluation = data.Nix, data.evaluation
+}
+
+func (*dataSourceBuildPlan) ValidateConfig(ctx context.Context, req datasource.ValidateConfigRequest, resp *datasource.ValidateConfigResponse) {
+	var model dataSourceBuildPlanModel
+	if resp.Diagnostics.Append(req.Config.Get(ctx, &model)...); resp.Diagnostics.HasError() {
+		return
+	}
+
+	validateEvaluationAttributes(model.Installable, model.evaluationAttributes(), &resp.Diagnostics)
+}
+
+func (m dataSourceBuildPlanModel) evaluationAttributes() evaluationAttributes {
+	return evaluationAttributes{
+		Expr:        m.Expr,
+		Args:        m.Args,
+		ArgStrs:     m.ArgStrs,
+		Impure:      m.Impure,
+		PureEval:    m.PureEval,
+		AllowedURIs: m.AllowedURIs,
+		EvalEnv:     m.EvalEnv,
+		InheritEnv:  m.InheritEnv,
+
+		OverrideInputs: m.OverrideInputs,
+		InputsFrom:     m.InputsFrom,
+
+		LockFileMode:      m.LockFileMode,
+		ReferenceLockFile: m.ReferenceLockFile,
+	}
+}
+
+func (d *dataSourceBuildPlan) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var model dataSourceBuildPlanModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &model)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var outputNames []string
+	if resp.Diagnostics.Append(model.OutputNames.ElementsAs(ctx, &outputNames, false)...); resp.Diagnostics.HasError() {
+		return
+	}
+
+	options, _ := evaluationOptions(ctx, d.evaluation, model.evaluationAttributes(), &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	plan, err := d.nix.PlanBuild(ctx, installableWithOutputs(model.Installable.ValueString(), outputNames), options)
+	if err != nil {
+		addNixErrorDiagnostic(&resp.Diagnostics, "Unable to plan build", err, evaluatedPath(options), path.Empty())
+		return
+	}
+
+	model.Impure = types.BoolValue(options.Impure)
+	model.Derivations = stringsValue(plan.Derivations)
+	model.Fetched = stringsValue(plan.Fetched)
+	model.DownloadSize = types.Int64Value(plan.DownloadSize)
+	model.UnpackedSize = types.Int64Value(plan.UnpackedSize)
+	model.UpToDate = types.BoolValue(len(plan.Derivations) == 0 && len(plan.Fetched) == 0)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &model)...)
+}
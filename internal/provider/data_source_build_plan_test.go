@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+	"github.com/krostar/terraform-provider-nix/internal/nix/fake"
+)
+
+func Test_dataSourceBuildPlan(t *testing.T) {
+	n := fake.New()
+	hello, glibc := testDerivation("hello"), testStorePath("glibc-2.39")
+	n.AddDerivation("nixpkgs#hello", hello)
+	n.AddBuildPlan("nixpkgs#hello", nix.EvaluationOptions{}, nix.BuildPlan{
+		Derivations:  []string{hello.Path.Derivation},
+		Fetched:      []string{glibc},
+		DownloadSize: 7_340_032,
+		UnpackedSize: 30_408_704,
+	})
+
+	built := testDerivation("built")
+	n.AddDerivation(".#built", built)
+	n.AddStorePath("", built.Path.Output)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: `
+data "nix_build_plan" "hello" {
+  installable  = "nixpkgs#hello"
+  output_names = ["out"]
+}
+
+data "nix_build_plan" "built" {
+  installable = ".#built"
+}
+`,
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("data.nix_build_plan.hello", "derivations.#", "1"),
+				resource.TestCheckResourceAttr("data.nix_build_plan.hello", "derivations.0", hello.Path.Derivation),
+				resource.TestCheckResourceAttr("data.nix_build_plan.hello", "fetched.#", "1"),
+				resource.TestCheckResourceAttr("data.nix_build_plan.hello", "fetched.0", glibc),
+				resource.TestCheckResourceAttr("data.nix_build_plan.hello", "download_size", "7340032"),
+				resource.TestCheckResourceAttr("data.nix_build_plan.hello", "unpacked_size", "30408704"),
+				resource.TestCheckResourceAttr("data.nix_build_plan.hello", "up_to_date", "false"),
+				resource.TestCheckResourceAttr("data.nix_build_plan.built", "derivations.#", "0"),
+				resource.TestCheckResourceAttr("data.nix_build_plan.built", "fetched.#", "0"),
+				resource.TestCheckResourceAttr("data.nix_build_plan.built", "up_to_date", "true"),
+			),
+		}, {
+			Config: `
+data "nix_build_plan" "this" {
+  installable = "nixpkgs#does-not-exist"
+}
+`,
+			ExpectError: regexp.MustCompile(`Unable to plan build: evaluation failed`),
+		}},
+	})
+}
@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+type (
+	dataSourceClosure struct {
+		nix nix.Nix
+	}
+
+	dataSourceClosureModel struct {
+		Installable types.String                      `tfsdk:"installable"`
+		Store       types.String                      `tfsdk:"store"`
+		SSHOptions  types.List                        `tfsdk:"ssh_options"`
+		Paths       []dataSourceClosureStorePathModel `tfsdk:"paths"`
+		PathCount   types.Int64                       `tfsdk:"path_count"`
+		ClosureSize types.Int64                       `tfsdk:"closure_size"`
+	}
+
+	dataSourceClosureStorePathModel struct {
+		Path       types.String `tfsdk:"path"`
+		NarHash    types.String `tfsdk:"nar_hash"`
+		NarSize    types.Int64  `tfsdk:"nar_size"`
+		References types.List   `tfsdk:"references"`
+	}
+)
+
+func newDataSourceClosure() datasource.DataSource { return new(dataSourceClosure) }
+
+func (*dataSourceClosure) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_closure"
+}
+
+func (*dataSourceClosure) Schema(_ context.Context, _ datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Retrieve the closure of a store path: the store path and all the store paths it references, recursively.",
+		Attributes: map[string]schema.Attribute{
+			"installable": schema.StringAttribute{
+				MarkdownDescription: "Store path whose closure is queried, or nix installable resolving to a store path.",
+				Required:            true,
+			},
+			"store": schema.StringAttribute{
+				MarkdownDescription: "URL of the Nix store to query (see [nix stores](https://nixos.org/manual/nix/stable/command-ref/new-cli/nix3-help-stores) for possible values), defaults to the local store.",
+				Optional:            true,
+			},
+			"ssh_options": schema.ListAttribute{
+				MarkdownDescription: "SSH connection options (like `-o StrictHostKeyChecking=no`, see [man ssh_config](https://linux.die.net/man/5/ssh_config) for possible values).",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"paths": schema.ListNestedAttribute{
+				MarkdownDescription: "Store paths of the closure, sorted by path.",
+				Computed:            true,
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"path": schema.StringAttribute{
+							MarkdownDescription: "Store path.",
+							Computed:            true,
+						},
+						"nar_hash": schema.StringAttribute{
+							MarkdownDescription: "Hash of the store path serialisation (NAR).",
+							Computed:            true,
+						},
+						"nar_size": schema.Int64Attribute{
+							MarkdownDescription: "Size in bytes of the store path serialisation (NAR).",
+							Computed:            true,
+						},
+						"references": schema.ListAttribute{
+							MarkdownDescription: "Store paths directly referenced by the store path.",
+							ElementType:         types.StringType,
+							Computed:            true,
+						},
+					},
+				},
+			},
+			"path_count": schema.Int64Attribute{
+				MarkdownDescription: "Number of store paths in the closure.",
+				Computed:            true,
+			},
+			"closure_size": schema.Int64Attribute{
+				MarkdownDescription: "Size in bytes of the serialisation (NAR) of all the store paths of the closure.",
+				Computed:            true,
+			},
+		},
+	}
+}
+
+func (d *dataSourceClosure) Configure(_ context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	data, ok := req.ProviderData.(*providerData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected configure data type",
+			fmt.Sprintf("Expected provider data, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.nix = data.Nix
+}
+
+func (d *dataSourceClosure) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var model dataSourceClosureModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &model)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var sshOptions []string
+	if resp.Diagnostics.Append(model.SSHOptions.ElementsAs(ctx, &sshOptions, false)...); resp.Diagnostics.HasError() {
+		return
+	}
+
+	closure, err := d.nix.GetClosure(ctx, nix.RemoteStorePathRequest{
+		Installable: model.Installable.ValueString(),
+		Store:       model.Store.ValueString(),
+		SSHOptions:  sshOptions,
+	})
+	if err != nil {
+		addNixErrorDiagnostic(&resp.Diagnostics, "Unable to get store path closure", err, path.Root("installable"), path.Root("store"))
+		return
+	}
+
+	var closureSize int64
+	model.Paths = make([]dataSourceClosureStorePathModel, 0, len(closure))
+	for _, storePath := range closure {
+		model.Paths = append(model.Paths, dataSourceClosureStorePathModel{
+			Path:       types.StringValue(storePath.Path),
+			NarHash:    types.StringValue(storePath.NarHash),
+			NarSize:    types.Int64Value(storePath.NarSize),
+			References: stringsValue(storePath.References),
+		})
+		closureSize += storePath.NarSize
+	}
+
+	model.PathCount = types.Int64Value(int64(len(closure)))
+	model.ClosureSize = types.Int64Value(closureSize)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &model)...)
+}
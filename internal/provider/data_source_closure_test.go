@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+	"github.com/krostar/terraform-provider-nix/internal/nix/fake"
+)
+
+func Test_dataSourceClosure(t *testing.T) {
+	hello, glibc, libidn := testStorePath("hello"), testStorePath("glibc"), testStorePath("libidn")
+
+	n := fake.New()
+	n.AddStorePath("", hello, glibc, libidn)
+	n.AddStorePath("https://cache.example.com", hello)
+	n.SetPathInfo(nix.PathInfo{Path: hello, NarHash: "sha256-hello", NarSize: 1024, References: []string{glibc}})
+	n.SetPathInfo(nix.PathInfo{Path: glibc, NarHash: "sha256-glibc", NarSize: 2048, References: []string{glibc, libidn}})
+	n.SetPathInfo(nix.PathInfo{Path: libidn, NarHash: "sha256-libidn", NarSize: 512})
+
+	expected := map[string]struct {
+		narHash, narSize string
+		references       []string
+	}{
+		hello:  {"sha256-hello", "1024", []string{glibc}},
+		glibc:  {"sha256-glibc", "2048", []string{glibc, libidn}},
+		libidn: {"sha256-libidn", "512", nil},
+	}
+
+	checks := []resource.TestCheckFunc{
+		resource.TestCheckResourceAttr("data.nix_closure.this", "path_count", "3"),
+		resource.TestCheckResourceAttr("data.nix_closure.this", "closure_size", "3584"),
+		resource.TestCheckResourceAttr("data.nix_closure.this", "paths.#", "3"),
+	}
+	for _, storePath := range []string{hello, glibc, libidn} {
+		values := map[string]string{
+			"path":         storePath,
+			"nar_hash":     expected[storePath].narHash,
+			"nar_size":     expected[storePath].narSize,
+			"references.#": strconv.Itoa(len(expected[storePath].references)),
+		}
+		for i, reference := range expected[storePath].references {
+			values["references."+strconv.Itoa(i)] = reference
+		}
+		checks = append(checks, resource.TestCheckTypeSetElemNestedAttrs("data.nix_closure.this", "paths.*", values))
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: `
+data "nix_closure" "this" {
+  installable = "` + hello + `"
+}
+`,
+			Check: resource.ComposeAggregateTestCheckFunc(checks...),
+		}, {
+			Config: `
+data "nix_closure" "this" {
+  installable = "` + hello + `"
+  store       = "https://cache.example.com"
+}
+`,
+			ExpectError: regexp.MustCompile(`Unable to get store path closure: store path .+-glibc is missing`),
+		}},
+	})
+}
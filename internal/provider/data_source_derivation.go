@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/hashicorp/terraform-plugin-framework/attr"
 	"github.com/hashicorp/terraform-plugin-framework/datasource"
 	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 
 	"github.com/krostar/terraform-provider-nix/internal/nix"
@@ -13,14 +15,48 @@ import (
 
 type (
 	dataSourceDerivation struct {
-		nix nix.Nix
+		nix        nix.Nix
+		evaluation nix.EvaluationOptions
 	}
 
 	dataSourceDerivationModel struct {
-		Installable    types.String `tfsdk:"installable"`
-		OutputPath     types.String `tfsdk:"output_path"`
-		DerivationPath types.String `tfsdk:"drv_path"`
-		System         types.String `tfsdk:"system"`
+		Installable       types.String  `tfsdk:"installable"`
+		Expr              types.String  `tfsdk:"expr"`
+		Args              types.Dynamic `tfsdk:"args"`
+		ArgStrs           types.Map     `tfsdk:"argstrs"`
+		Impure            types.Bool    `tfsdk:"impure"`
+		PureEval          types.Bool    `tfsdk:"pure_eval"`
+		AllowedURIs       types.List    `tfsdk:"allowed_uris"`
+		EvalEnv           types.Map     `tfsdk:"eval_env"`
+		InheritEnv        types.List    `tfsdk:"inherit_env"`
+		OverrideInputs    types.Map     `tfsdk:"override_inputs"`
+		OverrideRevisions types.Map     `tfsdk:"override_revisions"`
+		InputsFrom        types.String  `tfsdk:"inputs_from"`
+		LockFileMode      types.String  `tfsdk:"lock_file_mode"`
+		ReferenceLockFile types.String  `tfsdk:"reference_lock_file"`
+		OutputNames       types.List    `tfsdk:"output_names"`
+		OutputPath        types.String  `tfsdk:"output_path"`
+		Outputs           types.Map     `tfsdk:"outputs"`
+		DerivationPath    types.String  `tfsdk:"drv_path"`
+		System            types.String  `tfsdk:"system"`
+		SensitiveEnv      types.Bool    `tfsdk:"sensitive_env"`
+		Builder           types.String  `tfsdk:"builder"`
+		BuilderArgs       types.List    `tfsdk:"builder_args"`
+		Env               types.Map     `tfsdk:"env"`
+		EnvSensitive      types.Map     `tfsdk:"env_sensitive"`
+		InputDerivations  types.Map     `tfsdk:"input_derivations"`
+		InputSources      types.List    `tfsdk:"input_sources"`
+		FixedOutput       types.Bool    `tfsdk:"fixed_output"`
+		ContentAddressed  types.Bool    `tfsdk:"content_addressed"`
+		ImpureDerivation  types.Bool    `tfsdk:"impure_derivation"`
+
+		DerivationOutputs map[string]dataSourceDerivationOutputModel `tfsdk:"derivation_outputs"`
+	}
+
+	dataSourceDerivationOutputModel struct {
+		Path          types.String `tfsdk:"path"`
+		HashAlgorithm types.String `tfsdk:"hash_algorithm"`
+		Hash          types.String `tfsdk:"hash"`
 	}
 )
 
@@ -35,11 +71,80 @@ func (*dataSourceDerivation) Schema(_ context.Context, _ datasource.SchemaReques
 		Description: "Retrieve data about a nix derivation.",
 		Attributes: map[string]schema.Attribute{
 			"installable": schema.StringAttribute{
-				MarkdownDescription: "Nix installable (store path, nix packages, flake attribute, nix expressions, ...).",
-				Required:            true,
+				MarkdownDescription: "Nix installable (store path, nix packages, flake attribute, nix expressions, ...). When `expr` is provided, attribute path of the expression result to describe, the whole result if not provided.",
+				Optional:            true,
+			},
+			"expr": schema.StringAttribute{
+				MarkdownDescription: "Nix expression to evaluate instead of a flake (like `import ./images.nix`). Nix evaluates expressions in pure mode: set `impure` to read files (like importing them) or the environment (like `builtins.currentSystem`).",
+				Optional:            true,
+			},
+			"args": schema.DynamicAttribute{
+				MarkdownDescription: "Arguments given by name to the evaluated expression if it is a function. Values are converted to nix values: objects and maps to attribute sets, lists, sets and tuples to lists.",
+				Optional:            true,
+			},
+			"argstrs": schema.MapAttribute{
+				MarkdownDescription: "String arguments given by name to the evaluated expression if it is a function.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"impure": schema.BoolAttribute{
+				MarkdownDescription: "Allow the evaluation to access the environment, like environment variables or files outside of the flake. Defaults to the provider `impure` attribute.",
+				Optional:            true,
+				Computed:            true,
+			},
+			"pure_eval": schema.BoolAttribute{
+				MarkdownDescription: "Override the `pure-eval` nix setting, defaults to the provider `pure_eval` attribute.",
+				Optional:            true,
+			},
+			"allowed_uris": schema.ListAttribute{
+				MarkdownDescription: "URI prefixes the evaluation is allowed to fetch (`allowed-uris` nix setting), defaults to the provider `allowed_uris` attribute.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"eval_env": schema.MapAttribute{
+				MarkdownDescription: "Environment variables set during the evaluation, readable with `builtins.getEnv` by impure evaluations. Merged with the provider `eval_env` attribute.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"inherit_env": schema.ListAttribute{
+				MarkdownDescription: "Restrict the environment variables the evaluation inherits from the provider process to the listed ones, along with `PATH`, `HOME` and `NIX_*` variables that nix needs, defaults to the provider `inherit_env` attribute. An empty list starts from a clean environment, `eval_env` variables are always set.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"override_inputs": schema.MapAttribute{
+				MarkdownDescription: "Flake inputs to override, by input path (like `nixpkgs` or `home-manager/nixpkgs`), with the flake reference to use instead (like `github:me/nixpkgs/my-branch`). The lock file is not updated, the revisions the overridden inputs are locked to are in `override_revisions`.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"override_revisions": schema.MapAttribute{
+				MarkdownDescription: "Revision each input of `override_inputs` is locked to (like the commit `github:me/nixpkgs/my-branch` points to), by input path. Inputs without revision (like `path:` inputs) have their NAR hash instead.",
+				ElementType:         types.StringType,
+				Computed:            true,
+			},
+			"inputs_from": schema.StringAttribute{
+				MarkdownDescription: "Flake reference whose inputs are used to resolve flake references of the installable (like `nixpkgs` resolving to the nixpkgs input of this flake instead of the registry).",
+				Optional:            true,
+			},
+			"lock_file_mode": schema.StringAttribute{
+				MarkdownDescription: "How the lock file of the flake is handled, defaults to the provider `lock_file_mode` attribute. One of `strict` (the lock file must be up to date), `readonly` (missing inputs are locked without writing the lock file), `allow-write` (missing inputs are locked and the lock file is written), or `recreate` (every input is locked again, without writing the lock file).",
+				Optional:            true,
+			},
+			"reference_lock_file": schema.StringAttribute{
+				MarkdownDescription: "Path of a lock file to use instead of the lock file of the flake, defaults to the provider `reference_lock_file` attribute.",
+				Optional:            true,
+			},
+			"output_names": schema.ListAttribute{
+				MarkdownDescription: "Names of the derivation outputs to select (like `out` or `dev`), all outputs are selected if not provided.",
+				ElementType:         types.StringType,
+				Optional:            true,
 			},
 			"output_path": schema.StringAttribute{
-				MarkdownDescription: "Path to the derivation build output.",
+				MarkdownDescription: "Path to the derivation build output: the first of `output_names` if provided, `out` if it exists, or the first output by name.",
+				Computed:            true,
+			},
+			"outputs": schema.MapAttribute{
+				MarkdownDescription: "Path of each selected derivation build output, by output name.",
+				ElementType:         types.StringType,
 				Computed:            true,
 			},
 			"drv_path": schema.StringAttribute{
@@ -50,6 +155,72 @@ func (*dataSourceDerivation) Schema(_ context.Context, _ datasource.SchemaReques
 				MarkdownDescription: "System for which the derivation is built.",
 				Computed:            true,
 			},
+			"sensitive_env": schema.BoolAttribute{
+				MarkdownDescription: "Whether the environment of the builder may contain secrets, in which case it is exposed by the sensitive `env_sensitive` attribute instead of `env`. Defaults to false.",
+				Optional:            true,
+			},
+			"builder": schema.StringAttribute{
+				MarkdownDescription: "Program run to build the derivation (like `/nix/store/...-bash-5.2/bin/bash`).",
+				Computed:            true,
+			},
+			"builder_args": schema.ListAttribute{
+				MarkdownDescription: "Arguments given to the builder.",
+				ElementType:         types.StringType,
+				Computed:            true,
+			},
+			"env": schema.MapAttribute{
+				MarkdownDescription: "Environment of the builder, null if `sensitive_env` is set.",
+				ElementType:         types.StringType,
+				Computed:            true,
+			},
+			"env_sensitive": schema.MapAttribute{
+				MarkdownDescription: "Environment of the builder if `sensitive_env` is set, null otherwise.",
+				ElementType:         types.StringType,
+				Computed:            true,
+				Sensitive:           true,
+			},
+			"input_derivations": schema.MapAttribute{
+				MarkdownDescription: "Names of the outputs the build uses, by path of the derivation they belong to.",
+				ElementType:         types.ListType{ElemType: types.StringType},
+				Computed:            true,
+			},
+			"input_sources": schema.ListAttribute{
+				MarkdownDescription: "Store paths the build uses that are not built by derivations, like sources added to the store.",
+				ElementType:         types.StringType,
+				Computed:            true,
+			},
+			"derivation_outputs": schema.MapNestedAttribute{
+				MarkdownDescription: "Every output of the derivation, selected or not, by output name.",
+				Computed:            true,
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"path": schema.StringAttribute{
+							MarkdownDescription: "Path of the output, null for content addressed outputs which are only known once built.",
+							Computed:            true,
+						},
+						"hash_algorithm": schema.StringAttribute{
+							MarkdownDescription: "Hash algorithm of fixed output and content addressed outputs (like `sha256`, or `r:sha256` when the whole directory is hashed), null otherwise.",
+							Computed:            true,
+						},
+						"hash": schema.StringAttribute{
+							MarkdownDescription: "Expected hash of fixed output outputs, null otherwise.",
+							Computed:            true,
+						},
+					},
+				},
+			},
+			"fixed_output": schema.BoolAttribute{
+				MarkdownDescription: "Whether the derivation is a fixed output derivation: its output hash is known before building it, and its build can access the network.",
+				Computed:            true,
+			},
+			"content_addressed": schema.BoolAttribute{
+				MarkdownDescription: "Whether the derivation has content addressed outputs, whose paths are only known once built.",
+				Computed:            true,
+			},
+			"impure_derivation": schema.BoolAttribute{
+				MarkdownDescription: "Whether the derivation is impure: its build can access the network, and it is built again each time.",
+				Computed:            true,
+			},
 		},
 	}
 }
@@ -59,16 +230,44 @@ func (d *dataSourceDerivation) Configure(_ context.Context, req datasource.Confi
 		return
 	}
 
-	n, ok := req.ProviderData.(nix.Nix)
+	data, ok := req.ProviderData.(*providerData)
 	if !ok {
 		resp.Diagnostics.AddError(
 			"Unexpected configure data type",
-			fmt.Sprintf("Expected nix implementation, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+			fmt.Sprintf("Expected provider data, got: %T. Please report this issue to the provider developers.", req.ProviderData),
 		)
 		return
 	}
 
-	d.nix = n
+	d.nix, d.evaluation = data.Nix, data.evaluation
+}
+
+func (*dataSourceDerivation) ValidateConfig(ctx context.Context, req datasource.ValidateConfigRequest, resp *datasource.ValidateConfigResponse) {
+	var model dataSourceDerivationModel
+	if resp.Diagnostics.Append(req.Config.Get(ctx, &model)...); resp.Diagnostics.HasError() {
+		return
+	}
+
+	validateEvaluationAttributes(model.Installable, model.evaluationAttributes(), &resp.Diagnostics)
+}
+
+func (m dataSourceDerivationModel) evaluationAttributes() evaluationAttributes {
+	return evaluationAttributes{
+		Expr:        m.Expr,
+		Args:        m.Args,
+		ArgStrs:     m.ArgStrs,
+		Impure:      m.Impure,
+		PureEval:    m.PureEval,
+		AllowedURIs: m.AllowedURIs,
+		EvalEnv:     m.EvalEnv,
+		InheritEnv:  m.InheritEnv,
+
+		OverrideInputs: m.OverrideInputs,
+		InputsFrom:     m.InputsFrom,
+
+		LockFileMode:      m.LockFileMode,
+		ReferenceLockFile: m.ReferenceLockFile,
+	}
 }
 
 func (d *dataSourceDerivation) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
@@ -78,14 +277,63 @@ func (d *dataSourceDerivation) Read(ctx context.Context, req datasource.ReadRequ
 		return
 	}
 
-	derivation, err := d.nix.DescribeDerivation(ctx, model.Installable.ValueString())
+	var outputNames []string
+	if resp.Diagnostics.Append(model.OutputNames.ElementsAs(ctx, &outputNames, false)...); resp.Diagnostics.HasError() {
+		return
+	}
+
+	options, _ := evaluationOptions(ctx, d.evaluation, model.evaluationAttributes(), &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	derivation, err := d.nix.DescribeDerivation(ctx, model.Installable.ValueString(), options)
 	if err != nil {
-		resp.Diagnostics.AddError("Unable to describe derivation", err.Error())
+		addNixErrorDiagnostic(&resp.Diagnostics, "Unable to describe derivation", err, evaluatedPath(options), path.Empty())
+		return
+	}
+
+	outputs, output := selectOutputs(derivation.Path, outputNames, path.Root("output_names"), &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if model.OverrideRevisions = overrideRevisions(ctx, d.nix, model.Installable.ValueString(), options, &resp.Diagnostics); resp.Diagnostics.HasError() {
 		return
 	}
 
+	model.Impure = types.BoolValue(options.Impure)
 	model.DerivationPath = types.StringValue(derivation.Path.Derivation)
-	model.OutputPath = types.StringValue(derivation.Path.Output)
+	model.OutputPath = types.StringValue(output)
+	model.Outputs = stringMapValue(outputs)
 	model.System = types.StringValue(derivation.System)
+	model.Builder = types.StringValue(derivation.Builder)
+	model.BuilderArgs = stringsValue(derivation.Args)
+	model.InputSources = stringsValue(derivation.InputSources)
+	model.FixedOutput = types.BoolValue(derivation.FixedOutput())
+	model.ContentAddressed = types.BoolValue(derivation.ContentAddressed())
+	model.ImpureDerivation = types.BoolValue(derivation.Impure())
+
+	if model.SensitiveEnv.ValueBool() {
+		model.Env, model.EnvSensitive = types.MapNull(types.StringType), stringMapValue(derivation.Env)
+	} else {
+		model.Env, model.EnvSensitive = stringMapValue(derivation.Env), types.MapNull(types.StringType)
+	}
+
+	inputDerivations := make(map[string]attr.Value, len(derivation.InputDerivations))
+	for drvPath, outputNames := range derivation.InputDerivations {
+		inputDerivations[drvPath] = stringsValue(outputNames)
+	}
+	model.InputDerivations = types.MapValueMust(types.ListType{ElemType: types.StringType}, inputDerivations)
+
+	model.DerivationOutputs = make(map[string]dataSourceDerivationOutputModel, len(derivation.Outputs))
+	for name, output := range derivation.Outputs {
+		model.DerivationOutputs[name] = dataSourceDerivationOutputModel{
+			Path:          optionalStringValue(output.Path),
+			HashAlgorithm: optionalStringValue(output.HashAlgorithm),
+			Hash:          optionalStringValue(output.Hash),
+		}
+	}
+
 	resp.Diagnostics.Append(resp.State.Set(ctx, &model)...)
 }
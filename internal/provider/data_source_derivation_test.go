@@ -0,0 +1,166 @@
+package provider
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+	"github.com/krostar/terraform-provider-nix/internal/nix/fake"
+)
+
+func Test_dataSourceDerivation(t *testing.T) {
+	n := fake.New()
+	openssl := testDerivation("openssl", "bin", "dev", "out")
+	n.AddDerivation("nixpkgs#openssl", openssl)
+	n.AddDerivationWithOptions("openssl", nix.EvaluationOptions{
+		Expression: "import <nixpkgs>",
+		Args:       map[string]string{"config": `{ "allowUnfree" = true; }`},
+	}, openssl)
+	n.AddDerivationWithOptions("nixpkgs#openssl", nix.EvaluationOptions{
+		LockFileMode:      nix.LockFileModeReadOnly,
+		ReferenceLockFile: "./release.lock",
+	}, openssl)
+
+	for input, metadata := range map[string]nix.FlakeMetadata{
+		"nixpkgs": {Inputs: map[string]nix.FlakeInput{"nixpkgs": {NarHash: "sha256-nixpkgs"}}},
+		"nixpgks": {Inputs: map[string]nix.FlakeInput{"nixpkgs": {Revision: "0123abcd"}}},
+	} {
+		options := nix.EvaluationOptions{OverrideInputs: map[string]string{input: "path:/src/nixpkgs"}}
+		n.AddDerivationWithOptions(".#openssl", options, openssl)
+		n.AddFlakeWithOptions(".", options, metadata)
+	}
+
+	source := testDerivation("hello-2.12.1.tar.gz")
+	source.Builder = "builtin:fetchurl"
+	source.Env = map[string]string{"url": "mirror://gnu/hello/hello-2.12.1.tar.gz", "out": source.Path.Output}
+	source.Outputs = map[string]nix.DerivationOutput{"out": {
+		Path:          source.Path.Output,
+		HashAlgorithm: "sha256",
+		Hash:          "8d99142afd92576f30b0cd7cb42a8dc6809998bc5d607d88761f512e26c7db20",
+	}}
+	n.AddDerivation("nixpkgs#hello.src", source)
+
+	hello := testDerivation("hello-2.12.1")
+	hello.Builder = "/nix/store/xyz-bash-5.2/bin/bash"
+	hello.Args = []string{"-e", "/nix/store/xyz-default-builder.sh"}
+	hello.Env = map[string]string{"name": "hello-2.12.1", "secret": "hunter2"}
+	hello.InputDerivations = map[string][]string{source.Path.Derivation: {"out"}}
+	hello.InputSources = []string{"/nix/store/xyz-default-builder.sh"}
+	hello.Outputs = map[string]nix.DerivationOutput{"out": {HashAlgorithm: "r:sha256"}}
+	n.AddDerivation("nixpkgs#hello", hello)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: `
+data "nix_derivation" "source" {
+  installable = "nixpkgs#hello.src"
+}
+
+data "nix_derivation" "hello" {
+  installable   = "nixpkgs#hello"
+  sensitive_env = true
+}
+`,
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("data.nix_derivation.source", "builder", "builtin:fetchurl"),
+				resource.TestCheckResourceAttr("data.nix_derivation.source", "builder_args.#", "0"),
+				resource.TestCheckResourceAttr("data.nix_derivation.source", "env.url", "mirror://gnu/hello/hello-2.12.1.tar.gz"),
+				resource.TestCheckNoResourceAttr("data.nix_derivation.source", "env_sensitive"),
+				resource.TestCheckResourceAttr("data.nix_derivation.source", "input_derivations.%", "0"),
+				resource.TestCheckResourceAttr("data.nix_derivation.source", "derivation_outputs.out.path", source.Path.Output),
+				resource.TestCheckResourceAttr("data.nix_derivation.source", "derivation_outputs.out.hash_algorithm", "sha256"),
+				resource.TestCheckResourceAttr("data.nix_derivation.source", "derivation_outputs.out.hash", source.Outputs["out"].Hash),
+				resource.TestCheckResourceAttr("data.nix_derivation.source", "fixed_output", "true"),
+				resource.TestCheckResourceAttr("data.nix_derivation.source", "content_addressed", "false"),
+				resource.TestCheckResourceAttr("data.nix_derivation.source", "impure_derivation", "false"),
+				resource.TestCheckResourceAttr("data.nix_derivation.hello", "builder_args.1", "/nix/store/xyz-default-builder.sh"),
+				resource.TestCheckNoResourceAttr("data.nix_derivation.hello", "env"),
+				resource.TestCheckResourceAttr("data.nix_derivation.hello", "env_sensitive.secret", "hunter2"),
+				resource.TestCheckResourceAttr("data.nix_derivation.hello", "input_derivations."+source.Path.Derivation+".0", "out"),
+				resource.TestCheckResourceAttr("data.nix_derivation.hello", "input_sources.0", "/nix/store/xyz-default-builder.sh"),
+				resource.TestCheckNoResourceAttr("data.nix_derivation.hello", "derivation_outputs.out.path"),
+				resource.TestCheckNoResourceAttr("data.nix_derivation.hello", "derivation_outputs.out.hash"),
+				resource.TestCheckResourceAttr("data.nix_derivation.hello", "fixed_output", "false"),
+				resource.TestCheckResourceAttr("data.nix_derivation.hello", "content_addressed", "true"),
+			),
+		}, {
+			Config: `
+data "nix_derivation" "all" {
+  installable = "nixpkgs#openssl"
+}
+
+data "nix_derivation" "dev" {
+  installable  = "nixpkgs#openssl"
+  output_names = ["dev"]
+}
+
+data "nix_derivation" "expr" {
+  expr        = "import <nixpkgs>"
+  installable = "openssl"
+  args = {
+    config = { allowUnfree = true }
+  }
+}
+
+data "nix_derivation" "release" {
+  installable         = "nixpkgs#openssl"
+  lock_file_mode      = "readonly"
+  reference_lock_file = "./release.lock"
+}
+
+data "nix_derivation" "fork" {
+  installable     = ".#openssl"
+  override_inputs = { nixpkgs = "path:/src/nixpkgs" }
+}
+`,
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("data.nix_derivation.all", "drv_path", openssl.Path.Derivation),
+				resource.TestCheckResourceAttr("data.nix_derivation.all", "output_path", openssl.Path.Output),
+				resource.TestCheckResourceAttr("data.nix_derivation.all", "outputs.%", "3"),
+				resource.TestCheckResourceAttr("data.nix_derivation.all", "outputs.bin", openssl.Path.Outputs["bin"]),
+				resource.TestCheckResourceAttr("data.nix_derivation.all", "system", "x86_64-linux"),
+				resource.TestCheckResourceAttr("data.nix_derivation.dev", "output_path", openssl.Path.Outputs["dev"]),
+				resource.TestCheckResourceAttr("data.nix_derivation.dev", "outputs.%", "1"),
+				resource.TestCheckResourceAttr("data.nix_derivation.dev", "outputs.dev", openssl.Path.Outputs["dev"]),
+				resource.TestCheckResourceAttr("data.nix_derivation.expr", "drv_path", openssl.Path.Derivation),
+				resource.TestCheckResourceAttr("data.nix_derivation.release", "drv_path", openssl.Path.Derivation),
+				resource.TestCheckNoResourceAttr("data.nix_derivation.release", "override_revisions"),
+				resource.TestCheckResourceAttr("data.nix_derivation.fork", "override_revisions.nixpkgs", "sha256-nixpkgs"),
+			),
+		}, {
+			Config: `
+data "nix_derivation" "this" {
+  installable    = "nixpkgs#openssl"
+  lock_file_mode = "update"
+}
+`,
+			ExpectError: regexp.MustCompile(`Lock file mode "update" is not supported`),
+		}, {
+			Config: `
+data "nix_derivation" "this" {
+  installable  = "nixpkgs#openssl"
+  output_names = ["doc"]
+}
+`,
+			ExpectError: regexp.MustCompile(`Unknown derivation output`),
+		}, {
+			Config: `
+data "nix_derivation" "this" {
+  installable     = ".#openssl"
+  override_inputs = { nixpgks = "path:/src/nixpkgs" }
+}
+`,
+			ExpectError: regexp.MustCompile(`Flake . has no input nixpgks to override`),
+		}, {
+			Config: `
+data "nix_derivation" "this" {
+  installable = "nixpkgs#does-not-exist"
+}
+`,
+			ExpectError: regexp.MustCompile(`Unable to describe derivation: evaluation failed`),
+		}},
+	})
+}
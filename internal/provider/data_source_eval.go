@@ -6,17 +6,35 @@ import (
 
 	"github.com/hashicorp/terraform-plugin-framework/datasource"
 	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 
 	"github.com/krostar/terraform-provider-nix/internal/nix"
 )
 
 type (
-	dataSourceEval      struct{ nix nix.Nix }
+	dataSourceEval struct {
+		nix        nix.Nix
+		evaluation nix.EvaluationOptions
+	}
 	dataSourceEvalModel struct {
-		Installable types.String `tfsdk:"installable"`
-		Apply       types.String `tfsdk:"apply"`
-		Output      types.String `tfsdk:"output"`
+		Installable       types.String  `tfsdk:"installable"`
+		Expr              types.String  `tfsdk:"expr"`
+		Args              types.Dynamic `tfsdk:"args"`
+		ArgStrs           types.Map     `tfsdk:"argstrs"`
+		Impure            types.Bool    `tfsdk:"impure"`
+		PureEval          types.Bool    `tfsdk:"pure_eval"`
+		AllowedURIs       types.List    `tfsdk:"allowed_uris"`
+		EvalEnv           types.Map     `tfsdk:"eval_env"`
+		InheritEnv        types.List    `tfsdk:"inherit_env"`
+		OverrideInputs    types.Map     `tfsdk:"override_inputs"`
+		OverrideRevisions types.Map     `tfsdk:"override_revisions"`
+		InputsFrom        types.String  `tfsdk:"inputs_from"`
+		LockFileMode      types.String  `tfsdk:"lock_file_mode"`
+		ReferenceLockFile types.String  `tfsdk:"reference_lock_file"`
+		Apply             types.String  `tfsdk:"apply"`
+		Output            types.String  `tfsdk:"output"`
+		Value             types.Dynamic `tfsdk:"value"`
 	}
 )
 
@@ -31,8 +49,67 @@ func (*dataSourceEval) Schema(_ context.Context, _ datasource.SchemaRequest, res
 		Description: "Evaluate nix expressions.",
 		Attributes: map[string]schema.Attribute{
 			"installable": schema.StringAttribute{
-				MarkdownDescription: "Nix installable (store path, nix packages, flake attribute, nix expressions, ...).",
-				Required:            true,
+				MarkdownDescription: "Nix installable (store path, nix packages, flake attribute, nix expressions, ...). When `expr` is provided, attribute path of the expression result to evaluate, the whole result if not provided.",
+				Optional:            true,
+			},
+			"expr": schema.StringAttribute{
+				MarkdownDescription: "Nix expression to evaluate instead of a flake (like `import ./images.nix`). Nix evaluates expressions in pure mode: set `impure` to read files (like importing them) or the environment (like `builtins.currentSystem`).",
+				Optional:            true,
+			},
+			"args": schema.DynamicAttribute{
+				MarkdownDescription: "Arguments given by name to the evaluated expression if it is a function. Values are converted to nix values: objects and maps to attribute sets, lists, sets and tuples to lists.",
+				Optional:            true,
+			},
+			"argstrs": schema.MapAttribute{
+				MarkdownDescription: "String arguments given by name to the evaluated expression if it is a function.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"impure": schema.BoolAttribute{
+				MarkdownDescription: "Allow the evaluation to access the environment, like environment variables or files outside of the flake. Defaults to the provider `impure` attribute.",
+				Optional:            true,
+				Computed:            true,
+			},
+			"pure_eval": schema.BoolAttribute{
+				MarkdownDescription: "Override the `pure-eval` nix setting, defaults to the provider `pure_eval` attribute.",
+				Optional:            true,
+			},
+			"allowed_uris": schema.ListAttribute{
+				MarkdownDescription: "URI prefixes the evaluation is allowed to fetch (`allowed-uris` nix setting), defaults to the provider `allowed_uris` attribute.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"eval_env": schema.MapAttribute{
+				MarkdownDescription: "Environment variables set during the evaluation, readable with `builtins.getEnv` by impure evaluations. Merged with the provider `eval_env` attribute.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"inherit_env": schema.ListAttribute{
+				MarkdownDescription: "Restrict the environment variables the evaluation inherits from the provider process to the listed ones, along with `PATH`, `HOME` and `NIX_*` variables that nix needs, defaults to the provider `inherit_env` attribute. An empty list starts from a clean environment, `eval_env` variables are always set.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"override_inputs": schema.MapAttribute{
+				MarkdownDescription: "Flake inputs to override, by input path (like `nixpkgs` or `home-manager/nixpkgs`), with the flake reference to use instead (like `github:me/nixpkgs/my-branch`). The lock file is not updated, the revisions the overridden inputs are locked to are in `override_revisions`.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"override_revisions": schema.MapAttribute{
+				MarkdownDescription: "Revision each input of `override_inputs` is locked to (like the commit `github:me/nixpkgs/my-branch` points to), by input path. Inputs without revision (like `path:` inputs) have their NAR hash instead.",
+				ElementType:         types.StringType,
+				Computed:            true,
+			},
+			"inputs_from": schema.StringAttribute{
+				MarkdownDescription: "Flake reference whose inputs are used to resolve flake references of the installable (like `nixpkgs` resolving to the nixpkgs input of this flake instead of the registry).",
+				Optional:            true,
+			},
+			"lock_file_mode": schema.StringAttribute{
+				MarkdownDescription: "How the lock file of the flake is handled, defaults to the provider `lock_file_mode` attribute. One of `strict` (the lock file must be up to date), `readonly` (missing inputs are locked without writing the lock file), `allow-write` (missing inputs are locked and the lock file is written), or `recreate` (every input is locked again, without writing the lock file).",
+				Optional:            true,
+			},
+			"reference_lock_file": schema.StringAttribute{
+				MarkdownDescription: "Path of a lock file to use instead of the lock file of the flake, defaults to the provider `reference_lock_file` attribute.",
+				Optional:            true,
 			},
 			"apply": schema.StringAttribute{
 				MarkdownDescription: "Nix function to apply on expression result.",
@@ -42,6 +119,10 @@ func (*dataSourceEval) Schema(_ context.Context, _ datasource.SchemaRequest, res
 				MarkdownDescription: "Expression result json encoded",
 				Computed:            true,
 			},
+			"value": schema.DynamicAttribute{
+				MarkdownDescription: "Expression result as a terraform value: attribute sets are objects, lists are tuples.",
+				Computed:            true,
+			},
 		},
 	}
 }
@@ -51,16 +132,44 @@ func (d *dataSourceEval) Configure(_ context.Context, req datasource.ConfigureRe
 		return
 	}
 
-	n, ok := req.ProviderData.(nix.Nix)
+	data, ok := req.ProviderData.(*providerData)
 	if !ok {
 		resp.Diagnostics.AddError(
 			"Unexpected DataSource configure data type",
-			fmt.Sprintf("Expected nix implementation, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+			fmt.Sprintf("Expected provider data, got: %T. Please report this issue to the provider developers.", req.ProviderData),
 		)
 		return
 	}
 
-	d.nix = n
+	d.nix, d.evaluation = data.Nix, data.evaluation
+}
+
+func (*dataSourceEval) ValidateConfig(ctx context.Context, req datasource.ValidateConfigRequest, resp *datasource.ValidateConfigResponse) {
+	var model dataSourceEvalModel
+	if resp.Diagnostics.Append(req.Config.Get(ctx, &model)...); resp.Diagnostics.HasError() {
+		return
+	}
+
+	validateEvaluationAttributes(model.Installable, model.evaluationAttributes(), &resp.Diagnostics)
+}
+
+func (m dataSourceEvalModel) evaluationAttributes() evaluationAttributes {
+	return evaluationAttributes{
+		Expr:        m.Expr,
+		Args:        m.Args,
+		ArgStrs:     m.ArgStrs,
+		Impure:      m.Impure,
+		PureEval:    m.PureEval,
+		AllowedURIs: m.AllowedURIs,
+		EvalEnv:     m.EvalEnv,
+		InheritEnv:  m.InheritEnv,
+
+		OverrideInputs: m.OverrideInputs,
+		InputsFrom:     m.InputsFrom,
+
+		LockFileMode:      m.LockFileMode,
+		ReferenceLockFile: m.ReferenceLockFile,
+	}
 }
 
 func (d *dataSourceEval) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
@@ -70,15 +179,33 @@ func (d *dataSourceEval) Read(ctx context.Context, req datasource.ReadRequest, r
 		return
 	}
 
+	options, _ := evaluationOptions(ctx, d.evaluation, model.evaluationAttributes(), &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
 	raw, err := d.nix.EvaluateExpression(ctx, nix.EvaluateRequest{
-		Installable: model.Installable.ValueString(),
-		Apply:       model.Apply.ValueStringPointer(),
+		EvaluationOptions: options,
+		Installable:       model.Installable.ValueString(),
+		Apply:             model.Apply.ValueStringPointer(),
 	})
 	if err != nil {
-		resp.Diagnostics.AddError("Unable to evaluate expression", err.Error())
+		addNixErrorDiagnostic(&resp.Diagnostics, "Unable to evaluate expression", err, evaluatedPath(options), path.Empty())
+		return
+	}
+
+	value, err := jsonDynamicValue(raw)
+	if err != nil {
+		resp.Diagnostics.AddError("Unable to convert expression result", err.Error())
+		return
+	}
+
+	if model.OverrideRevisions = overrideRevisions(ctx, d.nix, model.Installable.ValueString(), options, &resp.Diagnostics); resp.Diagnostics.HasError() {
 		return
 	}
 
+	model.Impure = types.BoolValue(options.Impure)
 	model.Output = types.StringValue(string(raw))
+	model.Value = value
 	resp.Diagnostics.Append(resp.State.Set(ctx, &model)...)
 }
@@ -0,0 +1,164 @@
+package provider
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"gotest.tools/v3/assert"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+	"github.com/krostar/terraform-provider-nix/internal/nix/fake"
+)
+
+func Test_dataSourceEval(t *testing.T) {
+	n := fake.New()
+	apply := "builtins.attrNames"
+	assert.NilError(t, n.AddEvaluation(nix.EvaluateRequest{Installable: "nixpkgs#hello.meta.license"}, map[string]any{"free": true, "spdxId": "GPL-3.0-or-later"}))
+	assert.NilError(t, n.AddEvaluation(nix.EvaluateRequest{Installable: "nixpkgs#hello.meta.license", Apply: &apply}, []string{"free", "spdxId"}))
+	assert.NilError(t, n.AddEvaluation(nix.EvaluateRequest{Installable: ".#nixosConfigurations.web.config.networking"}, map[string]any{
+		"hostName":    "web",
+		"firewall":    map[string]any{"enable": true, "allowedTCPPorts": []int{22, 443}},
+		"nameservers": []any{},
+		"domain":      nil,
+		"mixed":       []any{"a", 1.5, false},
+		"bigNumber":   json.Number("18446744073709551617"),
+	}))
+	assert.NilError(t, n.AddEvaluation(nix.EvaluateRequest{Installable: ".#null"}, nil))
+	assert.NilError(t, n.AddEvaluation(nix.EvaluateRequest{
+		EvaluationOptions: nix.EvaluationOptions{
+			Expression: "import ./image.nix",
+			Args: map[string]string{
+				"network": `{ "ip" = "10.0.0.1"; "ports" = [ 22 443 ]; }`,
+				"size":    "3",
+				"debug":   "false",
+			},
+			ArgStrs: map[string]string{"hostname": "web"},
+		},
+		Installable: "config.networking.hostName",
+	}, "web"))
+	overridden := nix.EvaluationOptions{
+		OverrideInputs: map[string]string{"nixpkgs": "github:me/nixpkgs/fix-hello"},
+		InputsFrom:     ".",
+	}
+	assert.NilError(t, n.AddEvaluation(nix.EvaluateRequest{EvaluationOptions: overridden, Installable: "nixpkgs#hello.version"}, "2.12.2"))
+	n.AddFlakeWithOptions("nixpkgs", overridden, nix.FlakeMetadata{Inputs: map[string]nix.FlakeInput{"nixpkgs": {Revision: "0123abcd"}}})
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: `
+data "nix_eval" "this" {
+  installable = "nixpkgs#hello.meta.license"
+}
+
+data "nix_eval" "apply" {
+  installable = "nixpkgs#hello.meta.license"
+  apply       = "builtins.attrNames"
+}
+
+data "nix_eval" "networking" {
+  installable = ".#nixosConfigurations.web.config.networking"
+}
+
+data "nix_eval" "null" {
+  installable = ".#null"
+}
+
+output "host_name" {
+  value = data.nix_eval.networking.value.hostName
+}
+
+output "https_allowed" {
+  value = contains(data.nix_eval.networking.value.firewall.allowedTCPPorts, 443)
+}
+
+output "ports_sum" {
+  value = sum(data.nix_eval.networking.value.firewall.allowedTCPPorts)
+}
+
+output "big_number" {
+  value = data.nix_eval.networking.value.bigNumber
+}
+`,
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("data.nix_eval.this", "output", `{"free":true,"spdxId":"GPL-3.0-or-later"}`),
+				resource.TestCheckResourceAttr("data.nix_eval.this", "value.free", "true"),
+				resource.TestCheckResourceAttr("data.nix_eval.this", "value.spdxId", "GPL-3.0-or-later"),
+				resource.TestCheckResourceAttr("data.nix_eval.apply", "output", `["free","spdxId"]`),
+				resource.TestCheckResourceAttr("data.nix_eval.apply", "value.#", "2"),
+				resource.TestCheckResourceAttr("data.nix_eval.apply", "value.1", "spdxId"),
+				resource.TestCheckResourceAttr("data.nix_eval.networking", "value.firewall.enable", "true"),
+				resource.TestCheckResourceAttr("data.nix_eval.networking", "value.nameservers.#", "0"),
+				resource.TestCheckNoResourceAttr("data.nix_eval.networking", "value.domain"),
+				resource.TestCheckResourceAttr("data.nix_eval.networking", "value.mixed.#", "3"),
+				resource.TestCheckResourceAttr("data.nix_eval.networking", "value.mixed.1", "1.5"),
+				resource.TestCheckResourceAttr("data.nix_eval.null", "output", "null"),
+				resource.TestCheckNoResourceAttr("data.nix_eval.null", "value"),
+				resource.TestCheckOutput("host_name", "web"),
+				resource.TestCheckOutput("https_allowed", "true"),
+				resource.TestCheckOutput("ports_sum", "465"),
+				resource.TestCheckOutput("big_number", "18446744073709551617"),
+			),
+		}, {
+			Config: `
+data "nix_eval" "expr" {
+  expr        = "import ./image.nix"
+  installable = "config.networking.hostName"
+  args = {
+    network = { ip = "10.0.0.1", ports = [22, 443] }
+    size    = 3
+    debug   = false
+  }
+  argstrs = {
+    hostname = "web"
+  }
+}
+`,
+			Check: resource.TestCheckResourceAttr("data.nix_eval.expr", "value", "web"),
+		}, {
+			Config: `
+data "nix_eval" "overridden" {
+  installable     = "nixpkgs#hello.version"
+  override_inputs = { nixpkgs = "github:me/nixpkgs/fix-hello" }
+  inputs_from     = "."
+}
+`,
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("data.nix_eval.overridden", "value", "2.12.2"),
+				resource.TestCheckResourceAttr("data.nix_eval.overridden", "override_revisions.nixpkgs", "0123abcd"),
+			),
+		}, {
+			Config: `
+data "nix_eval" "this" {
+  apply = "builtins.attrNames"
+}
+`,
+			ExpectError: regexp.MustCompile(`One of installable or expr must be provided`),
+		}, {
+			Config: `
+data "nix_eval" "this" {
+  expr = "{ ports }: ports"
+  args = ["22"]
+}
+`,
+			ExpectError: regexp.MustCompile(`Args must be an object or a map`),
+		}, {
+			Config: `
+data "nix_eval" "this" {
+  expr            = "import ./image.nix"
+  override_inputs = { nixpkgs = "github:me/nixpkgs/fix-hello" }
+}
+`,
+			ExpectError: regexp.MustCompile(`override_inputs only applies to flake installables`),
+		}, {
+			Config: `
+data "nix_eval" "this" {
+  installable = "nixpkgs#does-not-exist"
+}
+`,
+			ExpectError: regexp.MustCompile(`Unable to evaluate expression: evaluation failed`),
+		}},
+	})
+}
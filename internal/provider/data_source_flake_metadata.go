@@ -0,0 +1,220 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+type (
+	dataSourceFlakeMetadata struct {
+		nix nix.Nix
+	}
+
+	dataSourceFlakeMetadataModel struct {
+		Flake        types.String                                 `tfsdk:"flake"`
+		Description  types.String                                 `tfsdk:"description"`
+		OriginalURL  types.String                                 `tfsdk:"original_url"`
+		ResolvedURL  types.String                                 `tfsdk:"resolved_url"`
+		LockedURL    types.String                                 `tfsdk:"locked_url"`
+		Revision     types.String                                 `tfsdk:"revision"`
+		RevCount     types.Int64                                  `tfsdk:"rev_count"`
+		LastModified types.String                                 `tfsdk:"last_modified"`
+		NarHash      types.String                                 `tfsdk:"nar_hash"`
+		Path         types.String                                 `tfsdk:"path"`
+		Inputs       map[string]dataSourceFlakeMetadataInputModel `tfsdk:"inputs"`
+		LockFile     types.String                                 `tfsdk:"lock_file"`
+	}
+
+	dataSourceFlakeMetadataInputModel struct {
+		Follows      types.String `tfsdk:"follows"`
+		Type         types.String `tfsdk:"type"`
+		Revision     types.String `tfsdk:"revision"`
+		LastModified types.String `tfsdk:"last_modified"`
+		NarHash      types.String `tfsdk:"nar_hash"`
+		Flake        types.Bool   `tfsdk:"flake"`
+		Locked       types.Map    `tfsdk:"locked"`
+		Original     types.Map    `tfsdk:"original"`
+	}
+)
+
+func newDataSourceFlakeMetadata() datasource.DataSource { return new(dataSourceFlakeMetadata) }
+
+func (*dataSourceFlakeMetadata) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_flake_metadata"
+}
+
+func (*dataSourceFlakeMetadata) Schema(_ context.Context, _ datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Retrieve the metadata of a flake, like its locked revision and the inputs of its lock file.",
+		Attributes: map[string]schema.Attribute{
+			"flake": schema.StringAttribute{
+				MarkdownDescription: "Flake reference (like `.`, `github:NixOS/nixpkgs/nixos-unstable`, or `path:/some/dir`). The lock file is not updated, it has to be up to date.",
+				Required:            true,
+			},
+			"description": schema.StringAttribute{
+				MarkdownDescription: "Description of the flake, null if the flake has none.",
+				Computed:            true,
+			},
+			"original_url": schema.StringAttribute{
+				MarkdownDescription: "Flake reference as provided.",
+				Computed:            true,
+			},
+			"resolved_url": schema.StringAttribute{
+				MarkdownDescription: "Flake reference after resolution through the flake registry.",
+				Computed:            true,
+			},
+			"locked_url": schema.StringAttribute{
+				MarkdownDescription: "Flake reference pinned to the fetched content of the flake.",
+				Computed:            true,
+			},
+			"revision": schema.StringAttribute{
+				MarkdownDescription: "Commit hash of the flake, null if the flake is not in a repository or has uncommitted changes.",
+				Computed:            true,
+			},
+			"rev_count": schema.Int64Attribute{
+				MarkdownDescription: "Number of commits in the history of the flake revision, null if unknown.",
+				Computed:            true,
+			},
+			"last_modified": schema.StringAttribute{
+				MarkdownDescription: "Time of the last modification of the flake (like its commit time), in RFC3339 format.",
+				Computed:            true,
+			},
+			"nar_hash": schema.StringAttribute{
+				MarkdownDescription: "Hash of the serialisation (NAR) of the flake source.",
+				Computed:            true,
+			},
+			"path": schema.StringAttribute{
+				MarkdownDescription: "Store path of the flake source.",
+				Computed:            true,
+			},
+			"inputs": schema.MapNestedAttribute{
+				MarkdownDescription: "Every input of the lock file, including the inputs of the inputs, indexed by their path (like `nixpkgs` or `home-manager/nixpkgs`).",
+				Computed:            true,
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"follows": schema.StringAttribute{
+							MarkdownDescription: "Path of the followed input for inputs following another input, other attributes are null in that case.",
+							Computed:            true,
+						},
+						"type": schema.StringAttribute{
+							MarkdownDescription: "Type of the input reference (like `github`, `git`, or `path`).",
+							Computed:            true,
+						},
+						"revision": schema.StringAttribute{
+							MarkdownDescription: "Locked commit hash of the input, null for inputs without revision.",
+							Computed:            true,
+						},
+						"last_modified": schema.StringAttribute{
+							MarkdownDescription: "Time of the last modification of the input, in RFC3339 format.",
+							Computed:            true,
+						},
+						"nar_hash": schema.StringAttribute{
+							MarkdownDescription: "Hash of the serialisation (NAR) of the input source.",
+							Computed:            true,
+						},
+						"flake": schema.BoolAttribute{
+							MarkdownDescription: "Whether the input is a flake.",
+							Computed:            true,
+						},
+						"locked": schema.MapAttribute{
+							MarkdownDescription: "Attributes of the locked input reference (like `owner`, `repo`, or `rev`).",
+							ElementType:         types.StringType,
+							Computed:            true,
+						},
+						"original": schema.MapAttribute{
+							MarkdownDescription: "Attributes of the input reference, as written in the flake.",
+							ElementType:         types.StringType,
+							Computed:            true,
+						},
+					},
+				},
+			},
+			"lock_file": schema.StringAttribute{
+				MarkdownDescription: "Lock file of the flake, json encoded.",
+				Computed:            true,
+			},
+		},
+	}
+}
+
+func (d *dataSourceFlakeMetadata) Configure(_ context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	data, ok := req.ProviderData.(*providerData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected configure data type",
+			fmt.Sprintf("Expected provider data, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.nix = data.Nix
+}
+
+func (d *dataSourceFlakeMetadata) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var model dataSourceFlakeMetadataModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &model)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	metadata, err := d.nix.GetFlakeMetadata(ctx, nix.FlakeMetadataRequest{Flake: model.Flake.ValueString()})
+	if err != nil {
+		addNixErrorDiagnostic(&resp.Diagnostics, "Unable to get flake metadata", err, path.Root("flake"), path.Empty())
+		return
+	}
+
+	model.Description = optionalStringValue(metadata.Description)
+	model.OriginalURL = types.StringValue(metadata.OriginalURL)
+	model.ResolvedURL = types.StringValue(metadata.ResolvedURL)
+	model.LockedURL = types.StringValue(metadata.LockedURL)
+	model.Revision = optionalStringValue(metadata.Revision)
+	model.RevCount = types.Int64Null()
+	if metadata.RevCount > 0 {
+		model.RevCount = types.Int64Value(metadata.RevCount)
+	}
+	model.LastModified = timestampValue(metadata.LastModified)
+	model.NarHash = optionalStringValue(metadata.NarHash)
+	model.Path = types.StringValue(metadata.Path)
+	model.LockFile = types.StringValue(string(metadata.LockFile))
+
+	model.Inputs = make(map[string]dataSourceFlakeMetadataInputModel, len(metadata.Inputs))
+	for name, input := range metadata.Inputs {
+		inputModel := dataSourceFlakeMetadataInputModel{
+			Follows:      types.StringNull(),
+			Type:         types.StringNull(),
+			Revision:     types.StringNull(),
+			LastModified: types.StringNull(),
+			NarHash:      types.StringNull(),
+			Flake:        types.BoolNull(),
+			Locked:       types.MapNull(types.StringType),
+			Original:     types.MapNull(types.StringType),
+		}
+
+		if input.Follows != "" || input.Locked == nil {
+			inputModel.Follows = types.StringValue(input.Follows)
+		} else {
+			inputModel.Type = types.StringValue(input.Type)
+			inputModel.Revision = optionalStringValue(input.Revision)
+			inputModel.LastModified = timestampValue(input.LastModified)
+			inputModel.NarHash = optionalStringValue(input.NarHash)
+			inputModel.Flake = types.BoolValue(input.Flake)
+			inputModel.Locked = stringMapValue(input.Locked)
+			inputModel.Original = stringMapValue(input.Original)
+		}
+
+		model.Inputs[name] = inputModel
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &model)...)
+}
@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+	"github.com/krostar/terraform-provider-nix/internal/nix/fake"
+)
+
+func Test_dataSourceFlakeMetadata(t *testing.T) {
+	n := fake.New()
+	n.AddFlake("github:krostar/infra", nix.FlakeMetadata{
+		Description:  "infrastructure",
+		OriginalURL:  "github:krostar/infra",
+		ResolvedURL:  "github:krostar/infra",
+		LockedURL:    "github:krostar/infra/0123456789abcdef0123456789abcdef01234567?narHash=sha256-AAAA",
+		Revision:     "0123456789abcdef0123456789abcdef01234567",
+		LastModified: 1700000000,
+		NarHash:      "sha256-AAAA",
+		Path:         testStorePath("source"),
+		Inputs: map[string]nix.FlakeInput{
+			"nixpkgs": {
+				Locked:       map[string]string{"type": "github", "owner": "NixOS", "repo": "nixpkgs", "rev": "fedcba9876543210fedcba9876543210fedcba98", "lastModified": "1699000000"},
+				Original:     map[string]string{"type": "github", "owner": "NixOS", "repo": "nixpkgs", "ref": "nixos-unstable"},
+				Type:         "github",
+				Revision:     "fedcba9876543210fedcba9876543210fedcba98",
+				LastModified: 1699000000,
+				NarHash:      "sha256-BBBB",
+				Flake:        true,
+			},
+			"home-manager/nixpkgs": {Follows: "nixpkgs"},
+		},
+		LockFile: []byte(`{"nodes":{},"root":"root","version":7}`),
+	})
+	n.AddFlake("path:/src", nix.FlakeMetadata{
+		OriginalURL: "path:/src",
+		ResolvedURL: "path:/src",
+		LockedURL:   "path:/src?narHash=sha256-CCCC",
+		NarHash:     "sha256-CCCC",
+		Path:        testStorePath("source"),
+		LockFile:    []byte(`{"nodes":{"root":{}},"root":"root","version":7}`),
+	})
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{
+			{
+				Config: `
+data "nix_flake_metadata" "infra" {
+  flake = "github:krostar/infra"
+}
+
+data "nix_flake_metadata" "src" {
+  flake = "path:/src"
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.nix_flake_metadata.infra", "description", "infrastructure"),
+					resource.TestCheckResourceAttr("data.nix_flake_metadata.infra", "locked_url", "github:krostar/infra/0123456789abcdef0123456789abcdef01234567?narHash=sha256-AAAA"),
+					resource.TestCheckResourceAttr("data.nix_flake_metadata.infra", "revision", "0123456789abcdef0123456789abcdef01234567"),
+					resource.TestCheckResourceAttr("data.nix_flake_metadata.infra", "last_modified", "2023-11-14T22:13:20Z"),
+					resource.TestCheckResourceAttr("data.nix_flake_metadata.infra", "nar_hash", "sha256-AAAA"),
+					resource.TestCheckResourceAttr("data.nix_flake_metadata.infra", "inputs.%", "2"),
+					resource.TestCheckResourceAttr("data.nix_flake_metadata.infra", "inputs.nixpkgs.type", "github"),
+					resource.TestCheckResourceAttr("data.nix_flake_metadata.infra", "inputs.nixpkgs.revision", "fedcba9876543210fedcba9876543210fedcba98"),
+					resource.TestCheckResourceAttr("data.nix_flake_metadata.infra", "inputs.nixpkgs.last_modified", "2023-11-03T08:26:40Z"),
+					resource.TestCheckResourceAttr("data.nix_flake_metadata.infra", "inputs.nixpkgs.flake", "true"),
+					resource.TestCheckResourceAttr("data.nix_flake_metadata.infra", "inputs.nixpkgs.locked.owner", "NixOS"),
+					resource.TestCheckResourceAttr("data.nix_flake_metadata.infra", "inputs.nixpkgs.original.ref", "nixos-unstable"),
+					resource.TestCheckNoResourceAttr("data.nix_flake_metadata.infra", "inputs.nixpkgs.follows"),
+					resource.TestCheckResourceAttr("data.nix_flake_metadata.infra", "inputs.home-manager/nixpkgs.follows", "nixpkgs"),
+					resource.TestCheckNoResourceAttr("data.nix_flake_metadata.infra", "inputs.home-manager/nixpkgs.type"),
+					resource.TestCheckResourceAttr("data.nix_flake_metadata.infra", "lock_file", `{"nodes":{},"root":"root","version":7}`),
+
+					resource.TestCheckNoResourceAttr("data.nix_flake_metadata.src", "description"),
+					resource.TestCheckNoResourceAttr("data.nix_flake_metadata.src", "revision"),
+					resource.TestCheckNoResourceAttr("data.nix_flake_metadata.src", "rev_count"),
+					resource.TestCheckNoResourceAttr("data.nix_flake_metadata.src", "last_modified"),
+					resource.TestCheckResourceAttr("data.nix_flake_metadata.src", "path", testStorePath("source")),
+					resource.TestCheckResourceAttr("data.nix_flake_metadata.src", "inputs.%", "0"),
+				),
+			},
+			{
+				Config: `
+data "nix_flake_metadata" "missing" {
+  flake = "github:krostar/missing"
+}
+`,
+				ExpectError: regexp.MustCompile(`Unable to get flake metadata`),
+			},
+		},
+	})
+}
@@ -0,0 +1,183 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+type (
+	dataSourceFlakeOutputs struct {
+		nix nix.Nix
+	}
+
+	dataSourceFlakeOutputsModel struct {
+		Flake               types.String                                 `tfsdk:"flake"`
+		AllSystems          types.Bool                                   `tfsdk:"all_systems"`
+		Outputs             map[string]dataSourceFlakeOutputsOutputModel `tfsdk:"outputs"`
+		NixosConfigurations types.List                                   `tfsdk:"nixos_configurations"`
+	}
+
+	dataSourceFlakeOutputsOutputModel struct {
+		AttributePath  types.List   `tfsdk:"attribute_path"`
+		Category       types.String `tfsdk:"category"`
+		System         types.String `tfsdk:"system"`
+		Name           types.String `tfsdk:"name"`
+		Type           types.String `tfsdk:"type"`
+		DerivationName types.String `tfsdk:"derivation_name"`
+		Description    types.String `tfsdk:"description"`
+		Installable    types.String `tfsdk:"installable"`
+	}
+)
+
+func newDataSourceFlakeOutputs() datasource.DataSource { return new(dataSourceFlakeOutputs) }
+
+func (*dataSourceFlakeOutputs) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_flake_outputs"
+}
+
+func (*dataSourceFlakeOutputs) Schema(_ context.Context, _ datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "List the outputs of a flake, like packages, apps, checks, or nixos configurations.",
+		Attributes: map[string]schema.Attribute{
+			"flake": schema.StringAttribute{
+				MarkdownDescription: "Flake reference (like `.`, `github:NixOS/nixpkgs/nixos-unstable`, or `path:/some/dir`).",
+				Required:            true,
+			},
+			"all_systems": schema.BoolAttribute{
+				MarkdownDescription: "List per system outputs (like packages or apps) of every system, instead of only the ones of the current system. Defaults to false.",
+				Optional:            true,
+			},
+			"outputs": schema.MapNestedAttribute{
+				MarkdownDescription: "Outputs of the flake, indexed by their attribute path (like `packages.x86_64-linux.hello` or `nixosConfigurations.awesomeHost`).",
+				Computed:            true,
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"attribute_path": schema.ListAttribute{
+							MarkdownDescription: "Attribute path of the output, as a list of attribute names.",
+							ElementType:         types.StringType,
+							Computed:            true,
+						},
+						"category": schema.StringAttribute{
+							MarkdownDescription: "Top level flake output the output belongs to (like `packages` or `nixosConfigurations`).",
+							Computed:            true,
+						},
+						"system": schema.StringAttribute{
+							MarkdownDescription: "System of per system outputs (like packages, apps, or checks), null for other outputs.",
+							Computed:            true,
+						},
+						"name": schema.StringAttribute{
+							MarkdownDescription: "Name of the output, the last attribute of its attribute path.",
+							Computed:            true,
+						},
+						"type": schema.StringAttribute{
+							MarkdownDescription: "Type of the output (like `derivation`, `app`, `nixos-configuration`, `nixos-module`, or `unknown`).",
+							Computed:            true,
+						},
+						"derivation_name": schema.StringAttribute{
+							MarkdownDescription: "Name of the derivation, null for outputs that are not derivations.",
+							Computed:            true,
+						},
+						"description": schema.StringAttribute{
+							MarkdownDescription: "Description of the output, null if it has none.",
+							Computed:            true,
+						},
+						"installable": schema.StringAttribute{
+							MarkdownDescription: "Nix installable referencing the output (like `.#packages.x86_64-linux.hello`).",
+							Computed:            true,
+						},
+					},
+				},
+			},
+			"nixos_configurations": schema.ListAttribute{
+				MarkdownDescription: "Names of the nixos configurations of the flake, sorted.",
+				ElementType:         types.StringType,
+				Computed:            true,
+			},
+		},
+	}
+}
+
+func (d *dataSourceFlakeOutputs) Configure(_ context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	data, ok := req.ProviderData.(*providerData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected configure data type",
+			fmt.Sprintf("Expected provider data, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.nix = data.Nix
+}
+
+func (d *dataSourceFlakeOutputs) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var model dataSourceFlakeOutputsModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &model)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	outputs, err := d.nix.GetFlakeOutputs(ctx, nix.FlakeOutputsRequest{
+		Flake:      model.Flake.ValueString(),
+		AllSystems: model.AllSystems.ValueBool(),
+	})
+	if err != nil {
+		addNixErrorDiagnostic(&resp.Diagnostics, "Unable to get flake outputs", err, path.Root("flake"), path.Empty())
+		return
+	}
+
+	var nixosConfigurations []string
+	model.Outputs = make(map[string]dataSourceFlakeOutputsOutputModel, len(outputs))
+	for _, output := range outputs {
+		if len(output.AttributePath) == 0 {
+			continue
+		}
+
+		attrPath := nixAttributePath(output.AttributePath)
+		model.Outputs[attrPath] = dataSourceFlakeOutputsOutputModel{
+			AttributePath:  stringsValue(output.AttributePath),
+			Category:       types.StringValue(output.AttributePath[0]),
+			System:         optionalStringValue(output.System),
+			Name:           types.StringValue(output.AttributePath[len(output.AttributePath)-1]),
+			Type:           types.StringValue(output.Type),
+			DerivationName: optionalStringValue(output.DerivationName),
+			Description:    optionalStringValue(output.Description),
+			Installable:    types.StringValue(model.Flake.ValueString() + "#" + attrPath),
+		}
+
+		if len(output.AttributePath) == 2 && output.AttributePath[0] == "nixosConfigurations" {
+			nixosConfigurations = append(nixosConfigurations, output.AttributePath[1])
+		}
+	}
+
+	model.NixosConfigurations = stringsValue(nixosConfigurations)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &model)...)
+}
+
+var nixIdentifier = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_'-]*$`)
+
+// nixAttributePath joins attribute names with dots, names that are not nix identifiers are quoted.
+func nixAttributePath(attrPath []string) string {
+	names := make([]string, 0, len(attrPath))
+	for _, name := range attrPath {
+		if !nixIdentifier.MatchString(name) {
+			name = strings.ReplaceAll(strconv.Quote(name), "${", `\${`)
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ".")
+}
@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+	"github.com/krostar/terraform-provider-nix/internal/nix/fake"
+)
+
+func Test_dataSourceFlakeOutputs(t *testing.T) {
+	n := fake.New()
+	n.AddFlakeOutputs(nix.FlakeOutputsRequest{Flake: "github:krostar/infra"},
+		nix.FlakeOutput{AttributePath: []string{"packages", "x86_64-linux", "hello"}, System: "x86_64-linux", Type: "derivation", DerivationName: "hello-2.12", Description: "Hello"},
+		nix.FlakeOutput{AttributePath: []string{"nixosConfigurations", "web"}, Type: "nixos-configuration"},
+		nix.FlakeOutput{AttributePath: []string{"nixosConfigurations", "db.internal"}, Type: "nixos-configuration"},
+		nix.FlakeOutput{AttributePath: []string{"formatter", "x86_64-linux"}, System: "x86_64-linux", Type: "derivation", DerivationName: "alejandra-3.0.0"},
+	)
+	n.AddFlakeOutputs(nix.FlakeOutputsRequest{Flake: "github:krostar/infra", AllSystems: true},
+		nix.FlakeOutput{AttributePath: []string{"packages", "x86_64-linux", "hello"}, System: "x86_64-linux", Type: "derivation", DerivationName: "hello-2.12"},
+		nix.FlakeOutput{AttributePath: []string{"packages", "aarch64-darwin", "hello"}, System: "aarch64-darwin", Type: "derivation", DerivationName: "hello-2.12"},
+	)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{
+			{
+				Config: `
+data "nix_flake_outputs" "infra" {
+  flake = "github:krostar/infra"
+}
+
+data "nix_flake_outputs" "all" {
+  flake       = "github:krostar/infra"
+  all_systems = true
+}
+`,
+				Check: resource.ComposeAggregateTestCheckFunc(
+					resource.TestCheckResourceAttr("data.nix_flake_outputs.infra", "outputs.%", "4"),
+					resource.TestCheckResourceAttr("data.nix_flake_outputs.infra", "outputs.packages.x86_64-linux.hello.category", "packages"),
+					resource.TestCheckResourceAttr("data.nix_flake_outputs.infra", "outputs.packages.x86_64-linux.hello.system", "x86_64-linux"),
+					resource.TestCheckResourceAttr("data.nix_flake_outputs.infra", "outputs.packages.x86_64-linux.hello.name", "hello"),
+					resource.TestCheckResourceAttr("data.nix_flake_outputs.infra", "outputs.packages.x86_64-linux.hello.type", "derivation"),
+					resource.TestCheckResourceAttr("data.nix_flake_outputs.infra", "outputs.packages.x86_64-linux.hello.derivation_name", "hello-2.12"),
+					resource.TestCheckResourceAttr("data.nix_flake_outputs.infra", "outputs.packages.x86_64-linux.hello.description", "Hello"),
+					resource.TestCheckResourceAttr("data.nix_flake_outputs.infra", "outputs.packages.x86_64-linux.hello.installable", "github:krostar/infra#packages.x86_64-linux.hello"),
+					resource.TestCheckResourceAttr("data.nix_flake_outputs.infra", "outputs.packages.x86_64-linux.hello.attribute_path.#", "3"),
+					resource.TestCheckResourceAttr("data.nix_flake_outputs.infra", "outputs.nixosConfigurations.web.type", "nixos-configuration"),
+					resource.TestCheckNoResourceAttr("data.nix_flake_outputs.infra", "outputs.nixosConfigurations.web.system"),
+					resource.TestCheckNoResourceAttr("data.nix_flake_outputs.infra", "outputs.nixosConfigurations.web.derivation_name"),
+					resource.TestCheckResourceAttr("data.nix_flake_outputs.infra", `outputs.nixosConfigurations."db.internal".installable`, `github:krostar/infra#nixosConfigurations."db.internal"`),
+					resource.TestCheckResourceAttr("data.nix_flake_outputs.infra", "outputs.formatter.x86_64-linux.name", "x86_64-linux"),
+					resource.TestCheckResourceAttr("data.nix_flake_outputs.infra", "nixos_configurations.#", "2"),
+					resource.TestCheckResourceAttr("data.nix_flake_outputs.infra", "nixos_configurations.0", "db.internal"),
+					resource.TestCheckResourceAttr("data.nix_flake_outputs.infra", "nixos_configurations.1", "web"),
+
+					resource.TestCheckResourceAttr("data.nix_flake_outputs.all", "outputs.%", "2"),
+					resource.TestCheckResourceAttr("data.nix_flake_outputs.all", "outputs.packages.aarch64-darwin.hello.system", "aarch64-darwin"),
+					resource.TestCheckResourceAttr("data.nix_flake_outputs.all", "nixos_configurations.#", "0"),
+				),
+			},
+			{
+				Config: `
+data "nix_flake_outputs" "missing" {
+  flake = "github:krostar/missing"
+}
+`,
+				ExpectError: regexp.MustCompile(`Unable to get flake outputs`),
+			},
+		},
+	})
+}
@@ -0,0 +1,180 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+type (
+	dataSourcePathInfo struct {
+		nix nix.Nix
+	}
+
+	dataSourcePathInfoModel struct {
+		Installable      types.String `tfsdk:"installable"`
+		Store            types.String `tfsdk:"store"`
+		SSHOptions       types.List   `tfsdk:"ssh_options"`
+		Path             types.String `tfsdk:"path"`
+		Valid            types.Bool   `tfsdk:"valid"`
+		NarHash          types.String `tfsdk:"nar_hash"`
+		NarSize          types.Int64  `tfsdk:"nar_size"`
+		ClosureComplete  types.Bool   `tfsdk:"closure_complete"`
+		ClosureSize      types.Int64  `tfsdk:"closure_size"`
+		References       types.List   `tfsdk:"references"`
+		Signatures       types.List   `tfsdk:"signatures"`
+		ContentAddress   types.String `tfsdk:"ca"`
+		Deriver          types.String `tfsdk:"deriver"`
+		RegistrationTime types.String `tfsdk:"registration_time"`
+	}
+)
+
+func newDataSourcePathInfo() datasource.DataSource { return new(dataSourcePathInfo) }
+
+func (*dataSourcePathInfo) Metadata(_ context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_path_info"
+}
+
+func (*dataSourcePathInfo) Schema(_ context.Context, _ datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Retrieve metadata about a store path in a Nix store.",
+		Attributes: map[string]schema.Attribute{
+			"installable": schema.StringAttribute{
+				MarkdownDescription: "Store path to query, or nix installable resolving to a store path.",
+				Required:            true,
+			},
+			"store": schema.StringAttribute{
+				MarkdownDescription: "URL of the Nix store to query (see [nix stores](https://nixos.org/manual/nix/stable/command-ref/new-cli/nix3-help-stores) for possible values), defaults to the local store.",
+				Optional:            true,
+			},
+			"ssh_options": schema.ListAttribute{
+				MarkdownDescription: "SSH connection options (like `-o StrictHostKeyChecking=no`, see [man ssh_config](https://linux.die.net/man/5/ssh_config) for possible values).",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"path": schema.StringAttribute{
+				MarkdownDescription: "Queried store path.",
+				Computed:            true,
+			},
+			"valid": schema.BoolAttribute{
+				MarkdownDescription: "Whether the store path exists in the store, other attributes are null if it does not.",
+				Computed:            true,
+			},
+			"nar_hash": schema.StringAttribute{
+				MarkdownDescription: "Hash of the store path serialisation (NAR).",
+				Computed:            true,
+			},
+			"nar_size": schema.Int64Attribute{
+				MarkdownDescription: "Size in bytes of the store path serialisation (NAR).",
+				Computed:            true,
+			},
+			"closure_complete": schema.BoolAttribute{
+				MarkdownDescription: "Whether all the store paths referenced by the store path, recursively, exist in the store.",
+				Computed:            true,
+			},
+			"closure_size": schema.Int64Attribute{
+				MarkdownDescription: "Size in bytes of the store path serialisation and of all the store paths it references, recursively. Null if the closure is not complete.",
+				Computed:            true,
+			},
+			"references": schema.ListAttribute{
+				MarkdownDescription: "Store paths directly referenced by the store path.",
+				ElementType:         types.StringType,
+				Computed:            true,
+			},
+			"signatures": schema.ListAttribute{
+				MarkdownDescription: "Signatures of the store path.",
+				ElementType:         types.StringType,
+				Computed:            true,
+			},
+			"ca": schema.StringAttribute{
+				MarkdownDescription: "Content address of the store path (like `fixed:r:sha256:...`), null if the store path is not content addressed.",
+				Computed:            true,
+			},
+			"deriver": schema.StringAttribute{
+				MarkdownDescription: "Path of the derivation that produced the store path, null if unknown.",
+				Computed:            true,
+			},
+			"registration_time": schema.StringAttribute{
+				MarkdownDescription: "Time at which the store path was registered in the store, in RFC3339 format.",
+				Computed:            true,
+			},
+		},
+	}
+}
+
+func (d *dataSourcePathInfo) Configure(_ context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	data, ok := req.ProviderData.(*providerData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected configure data type",
+			fmt.Sprintf("Expected provider data, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.nix = data.Nix
+}
+
+func (d *dataSourcePathInfo) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var model dataSourcePathInfoModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &model)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var sshOptions []string
+	if resp.Diagnostics.Append(model.SSHOptions.ElementsAs(ctx, &sshOptions, false)...); resp.Diagnostics.HasError() {
+		return
+	}
+
+	pathInfo, err := d.nix.GetRemoteStorePath(ctx, nix.RemoteStorePathRequest{
+		Installable: model.Installable.ValueString(),
+		Store:       model.Store.ValueString(),
+		SSHOptions:  sshOptions,
+	})
+	if err != nil {
+		addNixErrorDiagnostic(&resp.Diagnostics, "Unable to get store path info", err, path.Root("installable"), path.Root("store"))
+		return
+	}
+
+	model.Path = types.StringValue(pathInfo.Path)
+	model.Valid = types.BoolValue(pathInfo.Valid)
+	model.NarHash = types.StringNull()
+	model.NarSize = types.Int64Null()
+	model.ClosureComplete = types.BoolValue(pathInfo.ClosureComplete)
+	model.ClosureSize = types.Int64Null()
+	model.References = types.ListNull(types.StringType)
+	model.Signatures = types.ListNull(types.StringType)
+	model.ContentAddress = types.StringNull()
+	model.Deriver = types.StringNull()
+	model.RegistrationTime = types.StringNull()
+
+	if pathInfo.Valid {
+		model.NarHash = types.StringValue(pathInfo.NarHash)
+		model.NarSize = types.Int64Value(pathInfo.NarSize)
+		model.References = stringsValue(pathInfo.References)
+		model.Signatures = stringsValue(pathInfo.Signatures)
+		if pathInfo.ClosureComplete {
+			model.ClosureSize = types.Int64Value(pathInfo.ClosureSize)
+		}
+		if pathInfo.ContentAddress != "" {
+			model.ContentAddress = types.StringValue(pathInfo.ContentAddress)
+		}
+		if pathInfo.Deriver != "" {
+			model.Deriver = types.StringValue(pathInfo.Deriver)
+		}
+		model.RegistrationTime = timestampValue(pathInfo.RegistrationTime)
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &model)...)
+}
@@ -0,0 +1,92 @@
+package provider
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+	"github.com/krostar/terraform-provider-nix/internal/nix/fake"
+)
+
+func Test_dataSourcePathInfo(t *testing.T) {
+	hello, glibc := testStorePath("hello"), testStorePath("glibc")
+
+	n := fake.New()
+	n.AddStorePath("", hello, glibc)
+	n.AddStorePath("https://cache.example.com", hello)
+	n.SetPathInfo(nix.PathInfo{
+		Path:             hello,
+		NarHash:          "sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+		NarSize:          1024,
+		References:       []string{glibc, hello},
+		Signatures:       []string{"cache.nixos.org-1:sig"},
+		Deriver:          testStorePath("hello.drv"),
+		RegistrationTime: 1700000000,
+	})
+	n.SetPathInfo(nix.PathInfo{
+		Path:           glibc,
+		NarSize:        2048,
+		ContentAddress: "fixed:r:sha256:1b8m03r63zqhnjf7l5wnldhh7c134ap5vpj0850ymkq1iyzicy5s",
+	})
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: `
+data "nix_path_info" "local" {
+  installable = "` + hello + `"
+}
+
+data "nix_path_info" "glibc" {
+  installable = "` + glibc + `"
+}
+
+data "nix_path_info" "cache" {
+  installable = "` + hello + `"
+  store       = "https://cache.example.com"
+}
+
+data "nix_path_info" "missing" {
+  installable = "` + testStorePath("missing") + `"
+}
+`,
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("data.nix_path_info.local", "path", hello),
+				resource.TestCheckResourceAttr("data.nix_path_info.local", "valid", "true"),
+				resource.TestCheckResourceAttr("data.nix_path_info.local", "nar_hash", "sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="),
+				resource.TestCheckResourceAttr("data.nix_path_info.local", "nar_size", "1024"),
+				resource.TestCheckResourceAttr("data.nix_path_info.local", "closure_complete", "true"),
+				resource.TestCheckResourceAttr("data.nix_path_info.local", "closure_size", "3072"),
+				resource.TestCheckResourceAttr("data.nix_path_info.local", "references.#", "2"),
+				resource.TestCheckResourceAttr("data.nix_path_info.local", "references.0", glibc),
+				resource.TestCheckResourceAttr("data.nix_path_info.local", "signatures.0", "cache.nixos.org-1:sig"),
+				resource.TestCheckResourceAttr("data.nix_path_info.local", "deriver", testStorePath("hello.drv")),
+				resource.TestCheckResourceAttr("data.nix_path_info.local", "registration_time", "2023-11-14T22:13:20Z"),
+				resource.TestCheckNoResourceAttr("data.nix_path_info.local", "ca"),
+
+				resource.TestCheckResourceAttr("data.nix_path_info.glibc", "ca", "fixed:r:sha256:1b8m03r63zqhnjf7l5wnldhh7c134ap5vpj0850ymkq1iyzicy5s"),
+				resource.TestCheckResourceAttr("data.nix_path_info.glibc", "references.#", "0"),
+				resource.TestCheckNoResourceAttr("data.nix_path_info.glibc", "deriver"),
+
+				resource.TestCheckResourceAttr("data.nix_path_info.cache", "valid", "true"),
+				resource.TestCheckResourceAttr("data.nix_path_info.cache", "closure_complete", "false"),
+				resource.TestCheckNoResourceAttr("data.nix_path_info.cache", "closure_size"),
+
+				resource.TestCheckResourceAttr("data.nix_path_info.missing", "valid", "false"),
+				resource.TestCheckResourceAttr("data.nix_path_info.missing", "closure_complete", "false"),
+				resource.TestCheckNoResourceAttr("data.nix_path_info.missing", "nar_hash"),
+				resource.TestCheckNoResourceAttr("data.nix_path_info.missing", "references"),
+			),
+		}, {
+			Config: `
+data "nix_path_info" "this" {
+  installable = "` + hello + `"
+  store       = "ssh://unreachable"
+}
+`,
+			ExpectError: regexp.MustCompile(`Unable to get store path info: unable to connect to store`),
+		}},
+	})
+}
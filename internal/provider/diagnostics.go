@@ -0,0 +1,69 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+// addNixErrorDiagnostic adds an error diagnostic describing err, an error returned by nix.
+// The diagnostic targets installablePath, unless the error is related to a store in which case storePath is used if not empty.
+func addNixErrorDiagnostic(diags *diag.Diagnostics, summary string, err error, installablePath, storePath path.Path) {
+	if storePath.Equal(path.Empty()) {
+		storePath = installablePath
+	}
+
+	var (
+		evalErr       *nix.EvaluationError
+		buildErr      *nix.BuildError
+		missingErr    *nix.MissingStorePathError
+		connectionErr *nix.ConnectionError
+		signatureErr  *nix.SignatureError
+	)
+
+	switch {
+	case errors.As(err, &evalErr):
+		detail := evalErr.Message
+		if evalErr.Position != nil {
+			detail += "\n\nat " + evalErr.Position.String()
+		}
+		if len(evalErr.Trace) > 0 {
+			detail += "\n\ntrace:"
+			for _, trace := range evalErr.Trace {
+				detail += "\n- " + trace.Message
+				if trace.Position != nil {
+					detail += " (at " + trace.Position.String() + ")"
+				}
+			}
+		}
+		diags.AddAttributeError(installablePath, summary+": evaluation failed", detail)
+
+	case errors.As(err, &buildErr):
+		detail := buildErr.Message
+		if len(buildErr.LogTail) > 0 {
+			detail += "\n\nlast log lines:\n" + strings.Join(buildErr.LogTail, "\n")
+		}
+		diags.AddAttributeError(installablePath, fmt.Sprintf("%s: build of %s failed", summary, buildErr.Derivation), detail)
+
+	case errors.As(err, &missingErr):
+		diags.AddAttributeError(installablePath, fmt.Sprintf("%s: store path %s is missing", summary, missingErr.Path), missingErr.Message)
+
+	case errors.As(err, &connectionErr):
+		diags.AddAttributeError(storePath, summary+": unable to connect to store", connectionErr.Message)
+
+	case errors.As(err, &signatureErr):
+		diags.AddAttributeError(
+			storePath,
+			fmt.Sprintf("%s: signature of %s rejected", summary, signatureErr.Path),
+			signatureErr.Message+"\n\nStore paths have to be signed by a key trusted by the destination store, or signature checks have to be disabled.",
+		)
+
+	default:
+		diags.AddAttributeError(installablePath, summary, err.Error())
+	}
+}
@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// jsonDynamicValue converts a json document, like the result of a nix evaluation, to a terraform dynamic value.
+// Objects are converted to objects, arrays to tuples, so their elements can be of different types.
+func jsonDynamicValue(raw json.RawMessage) (types.Dynamic, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return types.DynamicNull(), fmt.Errorf("unable to decode json: %v", err)
+	}
+
+	if document == nil {
+		return types.DynamicNull(), nil
+	}
+
+	value, err := jsonValue(document)
+	if err != nil {
+		return types.DynamicNull(), err
+	}
+
+	return types.DynamicValue(value), nil
+}
+
+func jsonValue(document any) (attr.Value, error) {
+	switch document := document.(type) {
+	case nil:
+		return types.DynamicNull(), nil
+	case bool:
+		return types.BoolValue(document), nil
+	case string:
+		return types.StringValue(document), nil
+	case json.Number:
+		number, _, err := big.ParseFloat(document.String(), 10, 512, big.ToNearestEven)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse number %s: %v", document, err)
+		}
+		return types.NumberValue(number), nil
+	case []any:
+		elementTypes := make([]attr.Type, 0, len(document))
+		elements := make([]attr.Value, 0, len(document))
+		for _, element := range document {
+			value, err := jsonValue(element)
+			if err != nil {
+				return nil, err
+			}
+			elementTypes = append(elementTypes, value.Type(nil))
+			elements = append(elements, value)
+		}
+		tuple, diags := types.TupleValue(elementTypes, elements)
+		if diags.HasError() {
+			return nil, fmt.Errorf("unable to create tuple: %v", diags)
+		}
+		return tuple, nil
+	case map[string]any:
+		attributeTypes := make(map[string]attr.Type, len(document))
+		attributes := make(map[string]attr.Value, len(document))
+		for key, attribute := range document {
+			value, err := jsonValue(attribute)
+			if err != nil {
+				return nil, err
+			}
+			attributeTypes[key] = value.Type(nil)
+			attributes[key] = value
+		}
+		object, diags := types.ObjectValue(attributeTypes, attributes)
+		if diags.HasError() {
+			return nil, fmt.Errorf("unable to create object: %v", diags)
+		}
+		return object, nil
+	default:
+		return nil, fmt.Errorf("unhandled json type %T", document)
+	}
+}
@@ -0,0 +1,319 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
+	"golang.org/x/exp/maps"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+// validateEvaluationAttributes checks that something to evaluate is configured: an installable, or an expression,
+// and that flake inputs are only changed when evaluating flakes.
+func validateEvaluationAttributes(installable types.String, attributes evaluationAttributes, diags *diag.Diagnostics) {
+	validateLockFileMode(attributes.LockFileMode, diags)
+
+	if installable.IsNull() && attributes.Expr.IsNull() {
+		diags.AddAttributeError(
+			path.Root("installable"),
+			"Missing installable",
+			"One of installable or expr must be provided.",
+		)
+	}
+
+	if attributes.Expr.IsNull() {
+		return
+	}
+
+	flakeOnly := []struct {
+		name  string
+		value attr.Value
+	}{
+		{"override_inputs", attributes.OverrideInputs},
+		{"inputs_from", attributes.InputsFrom},
+		{"lock_file_mode", attributes.LockFileMode},
+		{"reference_lock_file", attributes.ReferenceLockFile},
+	}
+	for _, attribute := range flakeOnly {
+		if !attribute.value.IsNull() {
+			diags.AddAttributeError(
+				path.Root(attribute.name),
+				"Invalid flake inputs",
+				fmt.Sprintf("%s only applies to flake installables, it cannot be used with expr.", attribute.name),
+			)
+		}
+	}
+}
+
+// validateLockFileMode checks the lock_file_mode attribute is one of the supported lock file modes.
+func validateLockFileMode(mode types.String, diags *diag.Diagnostics) {
+	if mode.IsNull() || mode.IsUnknown() || slices.Contains(nix.LockFileModes, nix.LockFileMode(mode.ValueString())) {
+		return
+	}
+
+	modes := make([]string, 0, len(nix.LockFileModes))
+	for _, mode := range nix.LockFileModes {
+		modes = append(modes, string(mode))
+	}
+
+	diags.AddAttributeError(
+		path.Root("lock_file_mode"),
+		"Unknown lock file mode",
+		fmt.Sprintf("Lock file mode %q is not supported, use one of: %s.", mode.ValueString(), strings.Join(modes, ", ")),
+	)
+}
+
+// evaluatedPath returns the path of the attribute defining what is evaluated, to target evaluation errors.
+func evaluatedPath(options nix.EvaluationOptions) path.Path {
+	if options.Expression != "" {
+		return path.Root("expr")
+	}
+	return path.Root("installable")
+}
+
+// evaluationAttributes are the attributes of resources and data sources configuring how installables are evaluated.
+type evaluationAttributes struct {
+	Expr        types.String
+	Args        types.Dynamic
+	ArgStrs     types.Map
+	Impure      types.Bool
+	PureEval    types.Bool
+	AllowedURIs types.List
+	EvalEnv     types.Map
+	InheritEnv  types.List
+	// flake installables only
+	OverrideInputs    types.Map
+	InputsFrom        types.String
+	LockFileMode      types.String
+	ReferenceLockFile types.String
+}
+
+// evaluationOptions returns the options to evaluate the installable with, from the evaluation attributes
+// and the defaults set at the provider level. It returns false if the options are not known yet.
+func evaluationOptions(ctx context.Context, defaults nix.EvaluationOptions, attributes evaluationAttributes, diags *diag.Diagnostics) (nix.EvaluationOptions, bool) {
+	options := nix.EvaluationOptions{
+		Impure:      defaults.Impure,
+		PureEval:    defaults.PureEval,
+		AllowedURIs: defaults.AllowedURIs,
+		InheritEnv:  defaults.InheritEnv,
+	}
+
+	if attributes.Args.IsUnknown() || attributes.Args.IsUnderlyingValueUnknown() || !fullyKnown(ctx,
+		attributes.Expr, attributes.ArgStrs, attributes.Impure, attributes.PureEval, attributes.AllowedURIs, attributes.EvalEnv, attributes.InheritEnv,
+		attributes.OverrideInputs, attributes.InputsFrom, attributes.LockFileMode, attributes.ReferenceLockFile,
+	) {
+		return options, false
+	}
+
+	options.Expression = attributes.Expr.ValueString()
+	options.InputsFrom = attributes.InputsFrom.ValueString()
+	options.LockFileMode = nix.LockFileMode(attributes.LockFileMode.ValueString())
+	options.ReferenceLockFile = attributes.ReferenceLockFile.ValueString()
+
+	if !attributes.Impure.IsNull() {
+		options.Impure = attributes.Impure.ValueBool()
+	}
+	if !attributes.PureEval.IsNull() {
+		options.PureEval = attributes.PureEval.ValueBoolPointer()
+	}
+	if !attributes.AllowedURIs.IsNull() {
+		options.AllowedURIs = optionalStrings(ctx, attributes.AllowedURIs, diags)
+	}
+	if !attributes.InheritEnv.IsNull() {
+		options.InheritEnv = optionalStrings(ctx, attributes.InheritEnv, diags)
+	}
+
+	var env map[string]string
+	diags.Append(attributes.EvalEnv.ElementsAs(ctx, &env, false)...)
+	diags.Append(attributes.ArgStrs.ElementsAs(ctx, &options.ArgStrs, false)...)
+	diags.Append(attributes.OverrideInputs.ElementsAs(ctx, &options.OverrideInputs, false)...)
+	if diags.HasError() {
+		return options, false
+	}
+
+	if len(defaults.Env)+len(env) > 0 {
+		options.Env = make(map[string]string, len(defaults.Env)+len(env))
+		maps.Copy(options.Env, defaults.Env)
+		maps.Copy(options.Env, env)
+	}
+
+	if attributes.Args.IsNull() || attributes.Args.IsUnderlyingValueNull() {
+		return options, true
+	}
+
+	var elements map[string]attr.Value
+	switch value := attributes.Args.UnderlyingValue().(type) {
+	case types.Object:
+		elements = value.Attributes()
+	case types.Map:
+		elements = value.Elements()
+	default:
+		diags.AddAttributeError(path.Root("args"), "Invalid args", fmt.Sprintf("Args must be an object or a map, got %s.", value.Type(ctx)))
+		return options, false
+	}
+
+	options.Args = make(map[string]string, len(elements))
+	for name, element := range elements {
+		value, known, err := nixValue(element)
+		if err != nil {
+			diags.AddAttributeError(path.Root("args"), "Invalid args", fmt.Sprintf("Unable to convert argument %s to a nix value: %v.", name, err))
+			return options, false
+		}
+		if !known {
+			return options, false
+		}
+		options.Args[name] = value
+	}
+
+	return options, true
+}
+
+// overrideRevisions returns the revision each overridden input of the flake installable is locked to (the nar hash of inputs without revision),
+// by input path. It returns a null map if no input is overridden.
+func overrideRevisions(ctx context.Context, n nix.Nix, installable string, options nix.EvaluationOptions, diags *diag.Diagnostics) types.Map {
+	if len(options.OverrideInputs) == 0 {
+		return types.MapNull(types.StringType)
+	}
+
+	flake, _, _ := strings.Cut(installable, "#")
+	metadata, err := n.GetFlakeMetadata(ctx, nix.FlakeMetadataRequest{EvaluationOptions: options, Flake: flake})
+	if err != nil {
+		addNixErrorDiagnostic(diags, "Unable to lock overridden inputs", err, path.Root("override_inputs"), path.Empty())
+		return types.MapNull(types.StringType)
+	}
+
+	revisions := make(map[string]string, len(options.OverrideInputs))
+	for name := range options.OverrideInputs {
+		input, exists := metadata.Inputs[name]
+		if !exists {
+			diags.AddAttributeError(
+				path.Root("override_inputs"),
+				"Unknown flake input",
+				fmt.Sprintf("Flake %s has no input %s to override.", flake, name),
+			)
+			return types.MapNull(types.StringType)
+		}
+
+		revisions[name] = input.Revision
+		if input.Revision == "" {
+			revisions[name] = input.NarHash
+		}
+	}
+
+	return stringMapValue(revisions)
+}
+
+// fullyKnown returns whether the values, and all their elements, are known.
+func fullyKnown(ctx context.Context, values ...attr.Value) bool {
+	for _, value := range values {
+		if terraformValue, err := value.ToTerraformValue(ctx); err != nil || !terraformValue.IsFullyKnown() {
+			return false
+		}
+	}
+	return true
+}
+
+// optionalStrings returns the strings of the list, nil if it is null.
+// An empty list returns an empty, non-nil, slice as it has a meaning of its own (like allowed_uris forbidding to fetch any URI, or inherit_env inheriting no variable).
+func optionalStrings(ctx context.Context, list types.List, diags *diag.Diagnostics) []string {
+	if list.IsNull() || list.IsUnknown() {
+		return nil
+	}
+
+	values := make([]string, 0, len(list.Elements()))
+	diags.Append(list.ElementsAs(ctx, &values, false)...)
+	return values
+}
+
+// nixValue converts a terraform value to a nix expression evaluating to the same value.
+// Objects and maps are converted to attribute sets, lists, sets and tuples to lists.
+// It returns false if the value, or one of its elements, is not known yet.
+func nixValue(value attr.Value) (string, bool, error) {
+	if value.IsUnknown() {
+		return "", false, nil
+	}
+	if value.IsNull() {
+		return "null", true, nil
+	}
+
+	switch value := value.(type) {
+	case basetypes.DynamicValue:
+		if value.IsUnderlyingValueUnknown() {
+			return "", false, nil
+		}
+		if value.IsUnderlyingValueNull() {
+			return "null", true, nil
+		}
+		return nixValue(value.UnderlyingValue())
+	case basetypes.StringValue:
+		return nixString(value.ValueString()), true, nil
+	case basetypes.BoolValue:
+		return fmt.Sprint(value.ValueBool()), true, nil
+	case basetypes.NumberValue:
+		number := value.ValueBigFloat()
+		s := number.Text('f', -1)
+		if number.Sign() < 0 {
+			s = "(" + s + ")"
+		}
+		return s, true, nil
+	case basetypes.ListValue:
+		return nixList(value.Elements())
+	case basetypes.SetValue:
+		return nixList(value.Elements())
+	case basetypes.TupleValue:
+		return nixList(value.Elements())
+	case basetypes.MapValue:
+		return nixAttrSet(value.Elements())
+	case basetypes.ObjectValue:
+		return nixAttrSet(value.Attributes())
+	default:
+		return "", false, fmt.Errorf("unhandled value type %T", value)
+	}
+}
+
+func nixList(elements []attr.Value) (string, bool, error) {
+	values := make([]string, 0, len(elements))
+	for _, element := range elements {
+		value, known, err := nixValue(element)
+		if err != nil || !known {
+			return "", known, err
+		}
+		values = append(values, value)
+	}
+	return "[ " + strings.Join(append(values, "]"), " "), true, nil
+}
+
+func nixAttrSet(elements map[string]attr.Value) (string, bool, error) {
+	names := maps.Keys(elements)
+	slices.Sort(names)
+
+	attributes := make([]string, 0, len(names))
+	for _, name := range names {
+		value, known, err := nixValue(elements[name])
+		if err != nil || !known {
+			return "", known, err
+		}
+		attributes = append(attributes, nixString(name)+" = "+value+";")
+	}
+	return "{ " + strings.Join(append(attributes, "}"), " "), true, nil
+}
+
+// nixString returns s as a nix string literal, escaping characters that have a meaning in nix strings.
+func nixString(s string) string {
+	return `"` + strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"${", `\${`,
+		"\n", `\n`,
+		"\r", `\r`,
+		"\t", `\t`,
+	).Replace(s) + `"`
+}
@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+func Test_nixValue(t *testing.T) {
+	for name, test := range map[string]struct {
+		value         attr.Value
+		expected      string
+		expectedKnown bool
+	}{
+		"string": {
+			value:         types.StringValue("say \"${hello}\"\n\\"),
+			expected:      `"say \"\${hello}\"\n\\"`,
+			expectedKnown: true,
+		},
+		"numbers": {
+			value: types.TupleValueMust(
+				[]attr.Type{types.NumberType, types.NumberType, types.NumberType},
+				[]attr.Value{types.NumberValue(big.NewFloat(42)), types.NumberValue(big.NewFloat(0.5)), types.NumberValue(big.NewFloat(-3))},
+			),
+			expected:      "[ 42 0.5 (-3) ]",
+			expectedKnown: true,
+		},
+		"object": {
+			value: types.ObjectValueMust(
+				map[string]attr.Type{"enable": types.BoolType, "names": types.ListType{ElemType: types.StringType}, "my.domain": types.StringType},
+				map[string]attr.Value{
+					"enable":    types.BoolValue(true),
+					"names":     types.ListValueMust(types.StringType, []attr.Value{types.StringValue("a")}),
+					"my.domain": types.StringNull(),
+				},
+			),
+			expected:      `{ "enable" = true; "my.domain" = null; "names" = [ "a" ]; }`,
+			expectedKnown: true,
+		},
+		"dynamic": {
+			value:         types.DynamicValue(types.MapValueMust(types.Int64Type, map[string]attr.Value{})),
+			expected:      "{ }",
+			expectedKnown: true,
+		},
+		"nested unknown": {
+			value:         types.ListValueMust(types.StringType, []attr.Value{types.StringUnknown()}),
+			expectedKnown: false,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			value, known, err := nixValue(test.value)
+			assert.NilError(t, err)
+			assert.Check(t, is.Equal(known, test.expectedKnown))
+			assert.Check(t, is.Equal(value, test.expected))
+		})
+	}
+}
+
+func Test_evaluationOptions(t *testing.T) {
+	attributes := func(argStrs types.Map, inheritEnv types.List) evaluationAttributes {
+		return evaluationAttributes{
+			Expr:              types.StringValue("{ ip }: ip"),
+			Args:              types.DynamicNull(),
+			ArgStrs:           argStrs,
+			Impure:            types.BoolNull(),
+			PureEval:          types.BoolNull(),
+			AllowedURIs:       types.ListNull(types.StringType),
+			EvalEnv:           types.MapNull(types.StringType),
+			InheritEnv:        inheritEnv,
+			OverrideInputs:    types.MapNull(types.StringType),
+			InputsFrom:        types.StringNull(),
+			LockFileMode:      types.StringNull(),
+			ReferenceLockFile: types.StringNull(),
+		}
+	}
+
+	for name, test := range map[string]struct {
+		attributes    evaluationAttributes
+		expectedKnown bool
+	}{
+		"known": {
+			attributes:    attributes(types.MapValueMust(types.StringType, map[string]attr.Value{"ip": types.StringValue("127.0.0.1")}), types.ListNull(types.StringType)),
+			expectedKnown: true,
+		},
+		"unknown map": {
+			attributes:    attributes(types.MapUnknown(types.StringType), types.ListNull(types.StringType)),
+			expectedKnown: false,
+		},
+		"unknown map element": {
+			attributes:    attributes(types.MapValueMust(types.StringType, map[string]attr.Value{"ip": types.StringUnknown()}), types.ListNull(types.StringType)),
+			expectedKnown: false,
+		},
+		"unknown list element": {
+			attributes:    attributes(types.MapNull(types.StringType), types.ListValueMust(types.StringType, []attr.Value{types.StringUnknown()})),
+			expectedKnown: false,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var diags diag.Diagnostics
+			_, known := evaluationOptions(context.Background(), nix.EvaluationOptions{}, test.attributes, &diags)
+			assert.Check(t, !diags.HasError(), "%v", diags)
+			assert.Check(t, is.Equal(known, test.expectedKnown))
+		})
+	}
+}
@@ -61,7 +61,7 @@ func (*flakeNixosConfigurationFunction) Run(ctx context.Context, req function.Ru
 	resp.Error = function.ConcatFuncErrors(resp.Error, req.Arguments.Get(ctx, &flake, &configuration, &attribute))
 
 	output := flakeNixosConfigurationFunctionModel{
-		Installable:   types.StringValue(fmt.Sprintf("%s#'nixosConfigurations.%q.config.%s'", flake, configuration, attribute)),
+		Installable:   types.StringValue(fmt.Sprintf("%s#nixosConfigurations.%q.config.%s", flake, configuration, attribute)),
 		Flake:         types.StringValue(flake),
 		Configuration: types.StringValue(configuration),
 		Attribute:     types.StringValue(attribute),
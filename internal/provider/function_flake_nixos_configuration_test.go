@@ -0,0 +1,35 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/tfversion"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix/fake"
+)
+
+func Test_flakeNixosConfigurationFunction(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks:   []tfversion.TerraformVersionCheck{tfversion.SkipBelow(tfversion.Version1_8_0)},
+		ProtoV6ProviderFactories: testProviderFactories(fake.New(), nil),
+		Steps: []resource.TestStep{{
+			Config: `
+locals {
+  this = provider::nix::flake_nixos_configuration(".", "host.example", "system.build.toplevel")
+}
+
+output "installable" { value = local.this.installable }
+output "flake" { value = local.this.flake }
+output "configuration" { value = local.this.configuration }
+output "attribute" { value = local.this.attribute }
+`,
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckOutput("installable", `.#nixosConfigurations."host.example".config.system.build.toplevel`),
+				resource.TestCheckOutput("flake", "."),
+				resource.TestCheckOutput("configuration", "host.example"),
+				resource.TestCheckOutput("attribute", "system.build.toplevel"),
+			),
+		}},
+	})
+}
@@ -0,0 +1,45 @@
+package provider
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/tfversion"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix/fake"
+)
+
+func Test_systemToAMIArchitectureFunction(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		TerraformVersionChecks:   []tfversion.TerraformVersionCheck{tfversion.SkipBelow(tfversion.Version1_8_0)},
+		ProtoV6ProviderFactories: testProviderFactories(fake.New(), nil),
+		Steps: []resource.TestStep{{
+			Config: `
+output "x86_64" {
+  value = provider::nix::system_to_ami_architecture("x86_64-linux")
+}
+
+output "aarch64" {
+  value = provider::nix::system_to_ami_architecture("aarch64-linux")
+}
+
+output "i686" {
+  value = provider::nix::system_to_ami_architecture("i686-linux")
+}
+`,
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckOutput("x86_64", "x86_64"),
+				resource.TestCheckOutput("aarch64", "arm64"),
+				resource.TestCheckOutput("i686", "i386"),
+			),
+		}, {
+			Config: `
+output "this" {
+  value = provider::nix::system_to_ami_architecture("riscv64-linux")
+}
+`,
+			ExpectError: regexp.MustCompile(`Unable\s+to\s+map\s+nix\s+architecture\s+riscv64\s+to\s+an\s+AMI\s+architecture`),
+		}},
+	})
+}
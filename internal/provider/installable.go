@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+// installableWithOutputs returns the installable selecting the provided outputs (like installable^out,dev).
+func installableWithOutputs(installable string, outputNames []string) string {
+	if len(outputNames) == 0 {
+		return installable
+	}
+	return installable + "^" + strings.Join(outputNames, ",")
+}
+
+// selectOutputs returns the outputs of the store path that are selected by outputNames, and the main selected output path.
+// All outputs are selected when no output names are provided.
+func selectOutputs(storePath nix.StorePath, outputNames []string, outputNamesPath path.Path, diags *diag.Diagnostics) (map[string]string, string) {
+	if len(outputNames) == 0 {
+		return storePath.Outputs, storePath.Output
+	}
+
+	outputs := make(map[string]string, len(outputNames))
+	for _, name := range outputNames {
+		output, exists := storePath.Outputs[name]
+		if !exists {
+			available := make([]string, 0, len(storePath.Outputs))
+			for availableName := range storePath.Outputs {
+				available = append(available, availableName)
+			}
+			slices.Sort(available)
+
+			diags.AddAttributeError(
+				outputNamesPath,
+				"Unknown derivation output",
+				fmt.Sprintf("Derivation %s has no output named %q, available outputs are: %s.", storePath.Derivation, name, strings.Join(available, ", ")),
+			)
+			return nil, ""
+		}
+		outputs[name] = output
+	}
+
+	return outputs, outputs[outputNames[0]]
+}
@@ -2,24 +2,64 @@ package provider
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/hashicorp/terraform-plugin-framework/attr"
 	"github.com/hashicorp/terraform-plugin-framework/datasource"
 	"github.com/hashicorp/terraform-plugin-framework/function"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/provider"
 	"github.com/hashicorp/terraform-plugin-framework/provider/schema"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/types"
 
+	"github.com/krostar/terraform-provider-nix/internal/nix"
 	nixcli "github.com/krostar/terraform-provider-nix/internal/nix/cli"
+	nixdaemon "github.com/krostar/terraform-provider-nix/internal/nix/daemon"
 )
 
 // New creates a new provider.
 func New(version string) func() provider.Provider {
-	return func() provider.Provider { return &nixProvider{version: version} }
+	return func() provider.Provider {
+		return &nixProvider{version: version, newNix: nixcli.New, newDaemon: nixdaemon.New}
+	}
 }
 
 type (
-	nixProvider      struct{ version string }
-	nixProviderModel struct{}
+	nixProvider struct {
+		version   string
+		newNix    func(nixcli.Config) nix.Nix
+		newDaemon func(nixdaemon.Config, nix.Nix) nix.Nix
+	}
+	nixProviderModel struct {
+		Binary               types.String `tfsdk:"nix_binary"`
+		ExtraOptions         types.Map    `tfsdk:"extra_options"`
+		ExperimentalFeatures types.List   `tfsdk:"experimental_features"`
+		ExtraEnv             types.Map    `tfsdk:"extra_env"`
+		WorkingDirectory     types.String `tfsdk:"working_directory"`
+		GCRootDir            types.String `tfsdk:"gc_root_dir"`
+		Backend              types.String `tfsdk:"backend"`
+		DaemonSocket         types.String `tfsdk:"daemon_socket"`
+		Impure               types.Bool   `tfsdk:"impure"`
+		PureEval             types.Bool   `tfsdk:"pure_eval"`
+		AllowedURIs          types.List   `tfsdk:"allowed_uris"`
+		EvalEnv              types.Map    `tfsdk:"eval_env"`
+		InheritEnv           types.List   `tfsdk:"inherit_env"`
+		LockFileMode         types.String `tfsdk:"lock_file_mode"`
+		ReferenceLockFile    types.String `tfsdk:"reference_lock_file"`
+		System               types.String `tfsdk:"system"`
+		ExtraPlatforms       types.List   `tfsdk:"extra_platforms"`
+		Builders             types.List   `tfsdk:"builders"`
+	}
+
+	// providerData is given to resources and data sources, it is the nix implementation to use
+	// along with the evaluation options set at the provider level, used by default on every evaluation,
+	// and the directory garbage collector roots are created in, if any.
+	providerData struct {
+		nix.Nix
+		evaluation nix.EvaluationOptions
+		gcRootDir  string
+	}
 )
 
 // Metadata implements provider.Provider for terraform plugin framework.
@@ -30,11 +70,139 @@ func (p *nixProvider) Metadata(_ context.Context, _ provider.MetadataRequest, re
 
 // Schema implements provider.Provider for terraform plugin framework.
 func (*nixProvider) Schema(_ context.Context, _ provider.SchemaRequest, resp *provider.SchemaResponse) {
-	resp.Schema = schema.Schema{Description: "Interact with nix."}
+	resp.Schema = schema.Schema{
+		Description: "Interact with nix.",
+		Attributes: map[string]schema.Attribute{
+			"nix_binary": schema.StringAttribute{
+				MarkdownDescription: "Path to the nix binary to use, defaults to `nix` looked up in `PATH`.",
+				Optional:            true,
+			},
+			"extra_options": schema.MapAttribute{
+				MarkdownDescription: "Nix configuration settings provided to every nix command using `--option <name> <value>` (see [nix.conf](https://nixos.org/manual/nix/stable/command-ref/conf-file) for possible values).",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"experimental_features": schema.ListAttribute{
+				MarkdownDescription: "Nix experimental features to enable on every nix command (like `nix-command` or `flakes`).",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"extra_env": schema.MapAttribute{
+				MarkdownDescription: "Environment variables added to the environment of every nix command.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"working_directory": schema.StringAttribute{
+				MarkdownDescription: "Directory from which nix commands are run, defaults to terraform's working directory.",
+				Optional:            true,
+			},
+			"gc_root_dir": schema.StringAttribute{
+				MarkdownDescription: "Directory in which garbage collector roots of `nix_store_path` resources with `gc_root` set are created, relative to `working_directory` if it is a relative path.",
+				Optional:            true,
+			},
+			"backend": schema.StringAttribute{
+				MarkdownDescription: "How the provider talks to nix, either `cli` (the default) to run nix commands for every operation, or `daemon` to query the nix daemon store directly through the daemon socket. " +
+					"The `daemon` backend avoids spawning a nix process for store queries and garbage collector roots, which speeds up plans with many store paths; evaluations and operations on other stores still run nix commands.",
+				Optional: true,
+			},
+			"daemon_socket": schema.StringAttribute{
+				MarkdownDescription: "Path of the nix daemon socket used by the `daemon` backend, defaults to `NIX_DAEMON_SOCKET_PATH` or `" + nixdaemon.DefaultSocket + "`.",
+				Optional:            true,
+			},
+			"impure": schema.BoolAttribute{
+				MarkdownDescription: "Default of the `impure` attribute of resources and data sources evaluating installables, defaults to false.",
+				Optional:            true,
+			},
+			"pure_eval": schema.BoolAttribute{
+				MarkdownDescription: "Default of the `pure_eval` attribute of resources and data sources evaluating installables.",
+				Optional:            true,
+			},
+			"allowed_uris": schema.ListAttribute{
+				MarkdownDescription: "Default of the `allowed_uris` attribute of resources and data sources evaluating installables.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"eval_env": schema.MapAttribute{
+				MarkdownDescription: "Environment variables set while evaluating installables, merged with the `eval_env` attribute of resources and data sources. " +
+					"Unlike `extra_env`, they are not set for nix commands that do not evaluate anything.",
+				ElementType: types.StringType,
+				Optional:    true,
+			},
+			"inherit_env": schema.ListAttribute{
+				MarkdownDescription: "Default of the `inherit_env` attribute of resources and data sources evaluating installables: restrict the environment variables evaluations inherit from the provider process to the listed ones, " +
+					"along with `PATH`, `HOME` and `NIX_*` variables that nix needs. An empty list starts from a clean environment, unset, the whole environment is inherited.",
+				ElementType: types.StringType,
+				Optional:    true,
+			},
+			"lock_file_mode": schema.StringAttribute{
+				MarkdownDescription: "How nix commands evaluating flakes handle their lock file, one of `strict` (the default, the lock file must be up to date and is never written), `readonly` (missing inputs are locked without writing the lock file), " +
+					"`allow-write` (missing inputs are locked and the lock file is written), or `recreate` (every input is locked again, without writing the lock file). Resources and data sources evaluating installables can override it.",
+				Optional: true,
+			},
+			"reference_lock_file": schema.StringAttribute{
+				MarkdownDescription: "Path of a lock file nix commands evaluating flakes use instead of their lock file.",
+				Optional:            true,
+			},
+			"system": schema.StringAttribute{
+				MarkdownDescription: "System installables are evaluated and built for (`system` nix setting, like `aarch64-linux`), defaults to the local system. " +
+					"Derivations for other systems are built by `builders`, or locally for `extra_platforms`.",
+				Optional: true,
+			},
+			"extra_platforms": schema.ListAttribute{
+				MarkdownDescription: "Systems, other than the local one, that can be built locally (`extra-platforms` nix setting, like `i686-linux` on `x86_64-linux`, or `aarch64-linux` with binfmt emulation).",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"builders": schema.ListNestedAttribute{
+				MarkdownDescription: "Remote machines derivations can be built on, instead of the ones of the `builders` nix setting. An empty list only builds locally. " +
+					"With the `daemon` backend, every build then runs through nix commands, for builds to be dispatched to these machines.",
+				Optional: true,
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"uri": schema.StringAttribute{
+							MarkdownDescription: "URI of the machine store (like `ssh-ng://builder@aarch64.example.com`).",
+							Required:            true,
+						},
+						"systems": schema.ListAttribute{
+							MarkdownDescription: "Systems the machine builds for (like `aarch64-linux`), defaults to the local system.",
+							ElementType:         types.StringType,
+							Optional:            true,
+						},
+						"ssh_key": schema.StringAttribute{
+							MarkdownDescription: "Path of the ssh private key used to connect to the machine, ssh defaults are used if not provided.",
+							Optional:            true,
+						},
+						"max_jobs": schema.Int64Attribute{
+							MarkdownDescription: "Maximum number of builds run in parallel on the machine, defaults to 1.",
+							Optional:            true,
+						},
+						"speed_factor": schema.Int64Attribute{
+							MarkdownDescription: "Relative speed of the machine, faster machines are preferred, defaults to 1.",
+							Optional:            true,
+						},
+						"supported_features": schema.ListAttribute{
+							MarkdownDescription: "System features of the machine (like `kvm` or `big-parallel`).",
+							ElementType:         types.StringType,
+							Optional:            true,
+						},
+						"mandatory_features": schema.ListAttribute{
+							MarkdownDescription: "Features derivations have to require to be built on the machine.",
+							ElementType:         types.StringType,
+							Optional:            true,
+						},
+						"public_host_key": schema.StringAttribute{
+							MarkdownDescription: "Base64 encoded public host key of the machine, ssh known hosts are used if not provided.",
+							Optional:            true,
+						},
+					},
+				},
+			},
+		},
+	}
 }
 
 // Configure implements provider.Provider for terraform plugin framework.
-func (*nixProvider) Configure(ctx context.Context, req provider.ConfigureRequest, resp *provider.ConfigureResponse) {
+func (p *nixProvider) Configure(ctx context.Context, req provider.ConfigureRequest, resp *provider.ConfigureResponse) {
 	var config nixProviderModel
 
 	resp.Diagnostics.Append(req.Config.Get(ctx, &config)...)
@@ -42,15 +210,102 @@ func (*nixProvider) Configure(ctx context.Context, req provider.ConfigureRequest
 		return
 	}
 
-	nixCLI := nixcli.New()
+	// attributes depending on values only known once applied (like resource attributes) cannot configure the provider while planning
+	attributes := []struct {
+		name  string
+		value attr.Value
+	}{
+		{"nix_binary", config.Binary},
+		{"extra_options", config.ExtraOptions},
+		{"experimental_features", config.ExperimentalFeatures},
+		{"extra_env", config.ExtraEnv},
+		{"working_directory", config.WorkingDirectory},
+		{"gc_root_dir", config.GCRootDir},
+		{"backend", config.Backend},
+		{"daemon_socket", config.DaemonSocket},
+		{"impure", config.Impure},
+		{"pure_eval", config.PureEval},
+		{"allowed_uris", config.AllowedURIs},
+		{"eval_env", config.EvalEnv},
+		{"inherit_env", config.InheritEnv},
+		{"lock_file_mode", config.LockFileMode},
+		{"reference_lock_file", config.ReferenceLockFile},
+		{"system", config.System},
+		{"extra_platforms", config.ExtraPlatforms},
+		{"builders", config.Builders},
+	}
+	for _, attribute := range attributes {
+		if value, err := attribute.value.ToTerraformValue(ctx); err == nil && value.IsFullyKnown() {
+			continue
+		}
+		resp.Diagnostics.AddAttributeError(
+			path.Root(attribute.name),
+			"Unknown provider attribute",
+			fmt.Sprintf("The value of %s is not known yet, it must be known while planning to configure the provider. Use a static value, or apply what it depends on first (with -target).", attribute.name),
+		)
+	}
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if validateLockFileMode(config.LockFileMode, &resp.Diagnostics); resp.Diagnostics.HasError() {
+		return
+	}
+
+	cliConfig := nixcli.Config{
+		Binary:            config.Binary.ValueString(),
+		WorkingDirectory:  config.WorkingDirectory.ValueString(),
+		GCRootDir:         config.GCRootDir.ValueString(),
+		LockFileMode:      nix.LockFileMode(config.LockFileMode.ValueString()),
+		ReferenceLockFile: config.ReferenceLockFile.ValueString(),
+		System:            config.System.ValueString(),
+		ExtraPlatforms:    optionalStrings(ctx, config.ExtraPlatforms, &resp.Diagnostics),
+		Builders:          nixBuilders(ctx, path.Root("builders"), config.Builders, &resp.Diagnostics),
+	}
+	resp.Diagnostics.Append(config.ExtraOptions.ElementsAs(ctx, &cliConfig.ExtraOptions, false)...)
+	resp.Diagnostics.Append(config.ExperimentalFeatures.ElementsAs(ctx, &cliConfig.ExperimentalFeatures, false)...)
+	resp.Diagnostics.Append(config.ExtraEnv.ElementsAs(ctx, &cliConfig.ExtraEnv, false)...)
+
+	evaluation := nix.EvaluationOptions{
+		Impure:   config.Impure.ValueBool(),
+		PureEval: config.PureEval.ValueBoolPointer(),
+	}
+	evaluation.AllowedURIs = optionalStrings(ctx, config.AllowedURIs, &resp.Diagnostics)
+	evaluation.InheritEnv = optionalStrings(ctx, config.InheritEnv, &resp.Diagnostics)
+	resp.Diagnostics.Append(config.EvalEnv.ElementsAs(ctx, &evaluation.Env, false)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	n := p.newNix(cliConfig)
+
+	switch backend := config.Backend.ValueString(); backend {
+	case "", "cli":
+	case "daemon":
+		n = p.newDaemon(nixdaemon.Config{
+			Socket:    config.DaemonSocket.ValueString(),
+			GCRootDir: cliConfig.ResolvedGCRootDir(),
+			// the daemon builds with its own configuration, ignoring the build machines of the provider
+			FallbackBuilds: cliConfig.System != "" || cliConfig.ExtraPlatforms != nil || cliConfig.Builders != nil,
+		}, n)
+	default:
+		resp.Diagnostics.AddAttributeError(
+			path.Root("backend"),
+			"Unknown backend",
+			fmt.Sprintf("Backend %q is not supported, use one of: cli, daemon.", backend),
+		)
+		return
+	}
 
-	resp.DataSourceData = nixCLI
-	resp.ResourceData = nixCLI
+	data := &providerData{Nix: n, evaluation: evaluation, gcRootDir: cliConfig.GCRootDir}
+	resp.DataSourceData = data
+	resp.ResourceData = data
 }
 
 // Resources implements provider.Provider for terraform plugin framework.
 func (*nixProvider) Resources(context.Context) []func() resource.Resource {
 	return []func() resource.Resource{
+		newResourceFlakeLock,
 		newResourceStorePath,
 		newResourceStorePathCopy,
 	}
@@ -59,8 +314,13 @@ func (*nixProvider) Resources(context.Context) []func() resource.Resource {
 // DataSources implements provider.Provider for terraform plugin framework.
 func (*nixProvider) DataSources(context.Context) []func() datasource.DataSource {
 	return []func() datasource.DataSource{
+		newDataSourceBuildPlan,
+		newDataSourceClosure,
 		newDataSourceDerivation,
 		newDataSourceEval,
+		newDataSourceFlakeMetadata,
+		newDataSourceFlakeOutputs,
+		newDataSourcePathInfo,
 	}
 }
 
@@ -0,0 +1,360 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
+	"gotest.tools/v3/assert"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+	nixcli "github.com/krostar/terraform-provider-nix/internal/nix/cli"
+	nixdaemon "github.com/krostar/terraform-provider-nix/internal/nix/daemon"
+	"github.com/krostar/terraform-provider-nix/internal/nix/fake"
+)
+
+// testProviderFactories returns provider factories for tests, the provider uses n as nix implementation.
+// Every configuration the provider is configured with is sent to configs if not nil.
+func testProviderFactories(n nix.Nix, configs chan<- nixcli.Config) map[string]func() (tfprotov6.ProviderServer, error) {
+	return map[string]func() (tfprotov6.ProviderServer, error){
+		"nix": providerserver.NewProtocol6WithError(&nixProvider{
+			version: "test",
+			newNix: func(config nixcli.Config) nix.Nix {
+				if configs != nil {
+					configs <- config
+				}
+				return n
+			},
+			newDaemon: func(_ nixdaemon.Config, fallback nix.Nix) nix.Nix { return fallback },
+		}),
+	}
+}
+
+// testStorePath returns a fake but realistic store path.
+func testStorePath(name string) string {
+	hash := sha256.Sum256([]byte(name))
+	return "/nix/store/" + hex.EncodeToString(hash[:])[:32] + "-" + name
+}
+
+// testDerivation returns a derivation with the provided outputs, or with an out output if none is provided.
+func testDerivation(name string, outputNames ...string) nix.Derivation {
+	if len(outputNames) == 0 {
+		outputNames = []string{"out"}
+	}
+
+	derivation := nix.Derivation{
+		Name:   name,
+		System: "x86_64-linux",
+		Path: nix.StorePath{
+			Derivation: testStorePath(name + ".drv"),
+			Outputs:    make(map[string]string),
+		},
+	}
+
+	for _, output := range outputNames {
+		p := testStorePath(name)
+		if output != "out" {
+			p += "-" + output
+		}
+		derivation.Path.Outputs[output] = p
+	}
+
+	if out, exists := derivation.Path.Outputs["out"]; exists {
+		derivation.Path.Output = out
+	} else {
+		derivation.Path.Output = derivation.Path.Outputs[outputNames[0]]
+	}
+
+	return derivation
+}
+
+func Test_nixProvider_Configure(t *testing.T) {
+	n := fake.New()
+	assert.NilError(t, n.AddEvaluation(nix.EvaluateRequest{Installable: "nixpkgs#hello.name"}, "hello-2.12.1"))
+
+	configs := make(chan nixcli.Config, 10)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, configs),
+		Steps: []resource.TestStep{{
+			Config: `
+provider "nix" {
+  nix_binary            = "/bin/nix"
+  experimental_features = ["nix-command", "flakes"]
+  extra_options         = { "max-jobs" = "4" }
+  extra_env             = { FOO = "bar" }
+  working_directory     = "/tmp"
+  gc_root_dir           = "/tmp/gcroots"
+  lock_file_mode        = "readonly"
+  reference_lock_file   = "/tmp/flake.lock"
+}
+
+data "nix_eval" "this" {
+  installable = "nixpkgs#hello.name"
+}
+`,
+			Check: resource.TestCheckResourceAttr("data.nix_eval.this", "output", `"hello-2.12.1"`),
+		}},
+	})
+
+	close(configs)
+	assert.Assert(t, len(configs) > 0)
+	for config := range configs {
+		assert.DeepEqual(t, config, nixcli.Config{
+			Binary:               "/bin/nix",
+			ExtraOptions:         map[string]string{"max-jobs": "4"},
+			ExperimentalFeatures: []string{"nix-command", "flakes"},
+			ExtraEnv:             map[string]string{"FOO": "bar"},
+			WorkingDirectory:     "/tmp",
+			GCRootDir:            "/tmp/gcroots",
+			LockFileMode:         nix.LockFileModeReadOnly,
+			ReferenceLockFile:    "/tmp/flake.lock",
+		})
+	}
+}
+
+func Test_nixProvider_Configure_unknown(t *testing.T) {
+	n := fake.New()
+	assert.NilError(t, n.AddEvaluation(nix.EvaluateRequest{Installable: "nixpkgs#hello.name"}, "hello-2.12.1"))
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: `
+resource "terraform_data" "env" {
+  input = "bar"
+}
+
+provider "nix" {
+  eval_env = { FOO = terraform_data.env.output }
+}
+
+data "nix_eval" "this" {
+  installable = "nixpkgs#hello.name"
+}
+`,
+			ExpectError: regexp.MustCompile(`The value of eval_env is not known yet`),
+		}},
+	})
+}
+
+func Test_nixProvider_Configure_evaluation(t *testing.T) {
+	n := fake.New()
+	pureEval := false
+	assert.NilError(t, n.AddEvaluation(nix.EvaluateRequest{
+		EvaluationOptions: nix.EvaluationOptions{
+			Impure:      true,
+			PureEval:    &pureEval,
+			AllowedURIs: []string{"github:NixOS/"},
+			Env:         map[string]string{"USER": "alice", "HOST": "server"},
+			InheritEnv:  []string{"LANG"},
+		},
+		Installable: ".#greeting",
+	}, "hello alice"))
+	assert.NilError(t, n.AddEvaluation(nix.EvaluateRequest{
+		EvaluationOptions: nix.EvaluationOptions{
+			PureEval:    &pureEval,
+			AllowedURIs: []string{},
+			Env:         map[string]string{"USER": "bob", "HOST": "server"},
+			InheritEnv:  []string{},
+		},
+		Installable: ".#greeting",
+	}, "hello bob"))
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: `
+provider "nix" {
+  lock_file_mode = "update"
+}
+
+data "nix_eval" "this" {
+  installable = ".#greeting"
+}
+`,
+			ExpectError: regexp.MustCompile(`Lock file mode "update" is not supported`),
+		}, {
+			Config: `
+provider "nix" {
+  impure       = true
+  pure_eval    = false
+  allowed_uris = ["github:NixOS/"]
+  eval_env     = { USER = "alice", HOST = "server" }
+  inherit_env  = ["LANG"]
+}
+
+data "nix_eval" "defaults" {
+  installable = ".#greeting"
+}
+
+data "nix_eval" "overridden" {
+  installable  = ".#greeting"
+  impure       = false
+  allowed_uris = []
+  eval_env     = { USER = "bob" }
+  inherit_env  = []
+}
+`,
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("data.nix_eval.defaults", "output", `"hello alice"`),
+				resource.TestCheckResourceAttr("data.nix_eval.defaults", "impure", "true"),
+				resource.TestCheckResourceAttr("data.nix_eval.overridden", "output", `"hello bob"`),
+				resource.TestCheckResourceAttr("data.nix_eval.overridden", "impure", "false"),
+			),
+		}},
+	})
+}
+
+func Test_nixProvider_Configure_backend(t *testing.T) {
+	n := fake.New()
+	assert.NilError(t, n.AddEvaluation(nix.EvaluateRequest{Installable: "nixpkgs#hello.name"}, "hello-2.12.1"))
+
+	var daemonConfigs []nixdaemon.Config
+	factories := map[string]func() (tfprotov6.ProviderServer, error){
+		"nix": providerserver.NewProtocol6WithError(&nixProvider{
+			version: "test",
+			newNix:  func(nixcli.Config) nix.Nix { return n },
+			newDaemon: func(config nixdaemon.Config, fallback nix.Nix) nix.Nix {
+				daemonConfigs = append(daemonConfigs, config)
+				return fallback
+			},
+		}),
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: factories,
+		Steps: []resource.TestStep{{
+			Config: `
+provider "nix" {
+  backend = "grpc"
+}
+
+data "nix_eval" "this" {
+  installable = "nixpkgs#hello.name"
+}
+`,
+			ExpectError: regexp.MustCompile(`Backend "grpc" is not supported`),
+		}, {
+			Config: `
+provider "nix" {
+  backend       = "daemon"
+  daemon_socket = "/run/nix/socket"
+  gc_root_dir   = "/tmp/gcroots"
+}
+
+data "nix_eval" "this" {
+  installable = "nixpkgs#hello.name"
+}
+`,
+			Check: resource.TestCheckResourceAttr("data.nix_eval.this", "output", `"hello-2.12.1"`),
+		}},
+	})
+
+	assert.Assert(t, len(daemonConfigs) > 0)
+	for _, config := range daemonConfigs {
+		assert.DeepEqual(t, config, nixdaemon.Config{Socket: "/run/nix/socket", GCRootDir: "/tmp/gcroots"})
+	}
+}
+
+func Test_nixProvider_Configure_builders(t *testing.T) {
+	n := fake.New()
+	assert.NilError(t, n.AddEvaluation(nix.EvaluateRequest{Installable: "nixpkgs#hello.name"}, "hello-2.12.1"))
+
+	var (
+		cliConfigs    []nixcli.Config
+		daemonConfigs []nixdaemon.Config
+	)
+	factories := map[string]func() (tfprotov6.ProviderServer, error){
+		"nix": providerserver.NewProtocol6WithError(&nixProvider{
+			version: "test",
+			newNix: func(config nixcli.Config) nix.Nix {
+				cliConfigs = append(cliConfigs, config)
+				return n
+			},
+			newDaemon: func(config nixdaemon.Config, fallback nix.Nix) nix.Nix {
+				daemonConfigs = append(daemonConfigs, config)
+				return fallback
+			},
+		}),
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: factories,
+		Steps: []resource.TestStep{{
+			Config: `
+provider "nix" {
+  builders = [{ uri = "ssh://builder; ssh://other" }]
+}
+
+data "nix_eval" "this" {
+  installable = "nixpkgs#hello.name"
+}
+`,
+			ExpectError: regexp.MustCompile(`uri cannot contain spaces, commas, nor semicolons`),
+		}, {
+			Config: `
+provider "nix" {
+  backend         = "daemon"
+  system          = "aarch64-linux"
+  extra_platforms = []
+  builders = [{
+    uri                = "ssh-ng://builder@aarch64.example.com"
+    systems            = ["aarch64-linux"]
+    ssh_key            = "/etc/nix/builder_ed25519"
+    max_jobs           = 8
+    supported_features = ["big-parallel", "kvm"]
+  }]
+}
+
+data "nix_eval" "this" {
+  installable = "nixpkgs#hello.name"
+}
+`,
+			Check: resource.TestCheckResourceAttr("data.nix_eval.this", "output", `"hello-2.12.1"`),
+		}},
+	})
+
+	assert.Assert(t, len(cliConfigs) > 0)
+	for _, config := range cliConfigs {
+		assert.DeepEqual(t, config, nixcli.Config{
+			System:         "aarch64-linux",
+			ExtraPlatforms: []string{},
+			Builders: []nix.Builder{{
+				URI:               "ssh-ng://builder@aarch64.example.com",
+				Systems:           []string{"aarch64-linux"},
+				SSHKey:            "/etc/nix/builder_ed25519",
+				MaxJobs:           8,
+				SupportedFeatures: []string{"big-parallel", "kvm"},
+			}},
+		})
+	}
+
+	assert.Assert(t, len(daemonConfigs) > 0)
+	for _, config := range daemonConfigs {
+		assert.DeepEqual(t, config, nixdaemon.Config{FallbackBuilds: true})
+	}
+}
+
+// testCheckStorePathExists checks the store path stored in the attribute of the resource is valid in the store.
+func testCheckStorePathExists(n *fake.Nix, store, name, key string, exists bool) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, found := s.RootModule().Resources[name]
+		if !found {
+			return fmt.Errorf("resource %s not found", name)
+		}
+
+		storePath := rs.Primary.Attributes[key]
+		if n.StorePathExists(store, storePath) != exists {
+			return fmt.Errorf("expected store path %q existence in store %q to be %t", storePath, store, exists)
+		}
+
+		return nil
+	}
+}
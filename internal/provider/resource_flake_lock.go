@@ -0,0 +1,183 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+)
+
+type (
+	resourceFlakeLock      struct{ nix nix.Nix }
+	resourceFlakeLockModel struct {
+		Flake          types.String `tfsdk:"flake"`
+		UpdateInputs   types.List   `tfsdk:"update_inputs"`
+		Triggers       types.Map    `tfsdk:"triggers"`
+		LockHash       types.String `tfsdk:"lock_hash"`
+		LockFile       types.String `tfsdk:"lock_file"`
+		InputRevisions types.Map    `tfsdk:"input_revisions"`
+	}
+)
+
+func newResourceFlakeLock() resource.Resource { return new(resourceFlakeLock) }
+
+func (*resourceFlakeLock) Metadata(_ context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_flake_lock"
+}
+
+func (*resourceFlakeLock) Schema(_ context.Context, _ resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		Description: "Lock the inputs of a local flake, and update some of them, so input bumps are reviewed as terraform changes.",
+		Attributes: map[string]schema.Attribute{
+			"flake": schema.StringAttribute{
+				MarkdownDescription: "Reference of a local flake (like `.` or `path:/some/dir`), whose lock file is written.",
+				Required:            true,
+				PlanModifiers:       []planmodifier.String{stringplanmodifier.RequiresReplace()},
+			},
+			"update_inputs": schema.ListAttribute{
+				MarkdownDescription: "Inputs updated to their latest revision (like `nixpkgs` or `home-manager/nixpkgs`) when the resource is created, or when `update_inputs` or `triggers` change. Other inputs are only locked if missing.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"triggers": schema.MapAttribute{
+				MarkdownDescription: "Arbitrary values that update the inputs again when they change (like a date to update inputs periodically).",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"lock_hash": schema.StringAttribute{
+				MarkdownDescription: "SHA-256 hash of `lock_file`, hex encoded. When it no longer matches, because the lock file changed outside terraform or inputs were added to the flake, the flake is locked again (and `update_inputs` updated) as if the resource was created.",
+				Computed:            true,
+			},
+			"lock_file": schema.StringAttribute{
+				MarkdownDescription: "Lock file of the flake as encoded by nix (the `locks` of `nix flake metadata --json`), with the inputs missing from `flake.lock` locked. It is not byte for byte the `flake.lock` file.",
+				Computed:            true,
+			},
+			"input_revisions": schema.MapAttribute{
+				MarkdownDescription: "Locked revision of the inputs having one, indexed by their path (like `nixpkgs` or `home-manager/nixpkgs`).",
+				ElementType:         types.StringType,
+				Computed:            true,
+			},
+		},
+	}
+}
+
+func (r *resourceFlakeLock) Configure(_ context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	if req.ProviderData == nil {
+		return
+	}
+
+	data, ok := req.ProviderData.(*providerData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected configure data type",
+			fmt.Sprintf("Expected provider data, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	r.nix = data.Nix
+}
+
+func (r *resourceFlakeLock) lockFlake(ctx context.Context, model *resourceFlakeLockModel, diags *diag.Diagnostics) {
+	if diags.HasError() {
+		return
+	}
+
+	var updateInputs []string
+	if diags.Append(model.UpdateInputs.ElementsAs(ctx, &updateInputs, false)...); diags.HasError() {
+		return
+	}
+
+	metadata, err := r.nix.LockFlake(ctx, nix.FlakeLockRequest{
+		Flake:        model.Flake.ValueString(),
+		UpdateInputs: updateInputs,
+	})
+	if err != nil {
+		addNixErrorDiagnostic(diags, "Unable to lock flake", err, path.Root("flake"), path.Root("update_inputs"))
+		return
+	}
+
+	model.setLock(metadata)
+}
+
+// setLock sets the computed attributes describing the lock file of the flake.
+func (m *resourceFlakeLockModel) setLock(metadata *nix.FlakeMetadata) {
+	hash := sha256.Sum256(metadata.LockFile)
+
+	revisions := make(map[string]string)
+	for name, input := range metadata.Inputs {
+		if input.Revision != "" {
+			revisions[name] = input.Revision
+		}
+	}
+
+	m.LockHash = types.StringValue(hex.EncodeToString(hash[:]))
+	m.LockFile = types.StringValue(string(metadata.LockFile))
+	m.InputRevisions = stringMapValue(revisions)
+}
+
+func (r *resourceFlakeLock) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var plan resourceFlakeLockModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+
+	if r.lockFlake(ctx, &plan, &resp.Diagnostics); resp.Diagnostics.HasError() {
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, plan)...)
+}
+
+func (r *resourceFlakeLock) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var state resourceFlakeLockModel
+	if resp.Diagnostics.Append(req.State.Get(ctx, &state)...); resp.Diagnostics.HasError() {
+		return
+	}
+
+	// inputs missing from the lock file, like inputs added to the flake, are locked without writing the lock file, to detect the drift
+	metadata, err := r.nix.GetFlakeMetadata(ctx, nix.FlakeMetadataRequest{Flake: state.Flake.ValueString(), OwnLockFile: true})
+	if err != nil {
+		addNixErrorDiagnostic(&resp.Diagnostics, "Unable to get flake metadata", err, path.Root("flake"), path.Empty())
+		return
+	}
+
+	// the lock file changed outside terraform: the flake is locked again, as if the resource was created
+	lockHash := state.LockHash
+	if state.setLock(metadata); !lockHash.IsNull() && !lockHash.Equal(state.LockHash) {
+		resp.Diagnostics.AddWarning(
+			"Lock file changed outside terraform",
+			fmt.Sprintf("The lock file of flake %s does not match the one written by terraform, the flake will be locked again.", state.Flake.ValueString()),
+		)
+		resp.State.RemoveResource(ctx)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, state)...)
+}
+
+func (r *resourceFlakeLock) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan resourceFlakeLockModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+
+	if r.lockFlake(ctx, &plan, &resp.Diagnostics); resp.Diagnostics.HasError() {
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, plan)...)
+}
+
+func (*resourceFlakeLock) Delete(_ context.Context, _ resource.DeleteRequest, resp *resource.DeleteResponse) {
+	resp.Diagnostics.AddWarning(
+		"Delete operation is a no-op for the nix provider.",
+		"The lock file of the flake is kept as is.",
+	)
+}
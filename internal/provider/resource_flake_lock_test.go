@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/plancheck"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+	"github.com/krostar/terraform-provider-nix/internal/nix/fake"
+)
+
+func Test_resourceFlakeLock(t *testing.T) {
+	lock := func(revision string) nix.FlakeMetadata {
+		return nix.FlakeMetadata{
+			Path:     testStorePath("source"),
+			Inputs:   map[string]nix.FlakeInput{"nixpkgs": {Type: "github", Revision: revision}, "utils": {Follows: "nixpkgs"}},
+			LockFile: json.RawMessage(`{"nodes":{"nixpkgs":{"locked":{"rev":"` + revision + `"}}},"root":"root","version":7}`),
+		}
+	}
+	lockHash := func(metadata nix.FlakeMetadata) string {
+		hash := sha256.Sum256(metadata.LockFile)
+		return hex.EncodeToString(hash[:])
+	}
+
+	initial, updated, edited := lock("a3a3dda3bacf61e8a39258a0ed9c924eeca8e293"), lock("b2c1e4f5"), lock("c0ffee")
+
+	n := fake.New()
+	n.AddFlakeLock(nix.FlakeLockRequest{Flake: "."}, initial)
+	n.AddFlakeLock(nix.FlakeLockRequest{Flake: ".", UpdateInputs: []string{"nixpkgs"}}, updated)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: `
+resource "nix_flake_lock" "this" {
+  flake = "."
+}
+`,
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("nix_flake_lock.this", "lock_hash", lockHash(initial)),
+				resource.TestCheckResourceAttr("nix_flake_lock.this", "lock_file", string(initial.LockFile)),
+				resource.TestCheckResourceAttr("nix_flake_lock.this", "input_revisions.%", "1"),
+				resource.TestCheckResourceAttr("nix_flake_lock.this", "input_revisions.nixpkgs", "a3a3dda3bacf61e8a39258a0ed9c924eeca8e293"),
+			),
+		}, {
+			Config: `
+resource "nix_flake_lock" "this" {
+  flake = "."
+}
+`,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{plancheck.ExpectEmptyPlan()},
+			},
+		}, {
+			Config: `
+resource "nix_flake_lock" "this" {
+  flake         = "."
+  update_inputs = ["nixpkgs"]
+  triggers      = { week = "42" }
+}
+`,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{plancheck.ExpectResourceAction("nix_flake_lock.this", plancheck.ResourceActionUpdate)},
+			},
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("nix_flake_lock.this", "lock_hash", lockHash(updated)),
+				resource.TestCheckResourceAttr("nix_flake_lock.this", "input_revisions.nixpkgs", "b2c1e4f5"),
+			),
+		}, {
+			PreConfig: func() { n.AddFlake(".", edited) },
+			Config: `
+resource "nix_flake_lock" "this" {
+  flake         = "."
+  update_inputs = ["nixpkgs"]
+  triggers      = { week = "42" }
+}
+`,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{plancheck.ExpectResourceAction("nix_flake_lock.this", plancheck.ResourceActionCreate)},
+			},
+			Check: resource.TestCheckResourceAttr("nix_flake_lock.this", "lock_hash", lockHash(updated)),
+		}, {
+			Config: `
+resource "nix_flake_lock" "this" {
+  flake         = "."
+  update_inputs = ["nixpkgs"]
+  triggers      = { week = "42" }
+}
+`,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{plancheck.ExpectEmptyPlan()},
+			},
+		}},
+	})
+}
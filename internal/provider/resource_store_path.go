@@ -2,24 +2,72 @@ package provider
 
 import (
 	"context"
+	"crypto/rand"
 	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
 	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"golang.org/x/exp/maps"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/krostar/terraform-provider-nix/internal/nix"
 )
 
 type (
-	resourceStorePath      struct{ nix nix.Nix }
+	resourceStorePath struct {
+		nix        nix.Nix
+		evaluation nix.EvaluationOptions
+		gcRootDir  string
+	}
 	resourceStorePathModel struct {
-		Installable types.String `tfsdk:"installable"`
-		Output      types.String `tfsdk:"output_path"`
-		Derivation  types.String `tfsdk:"drv_path"`
-		System      types.String `tfsdk:"system"`
+		Installable       types.String  `tfsdk:"installable"`
+		Expr              types.String  `tfsdk:"expr"`
+		Args              types.Dynamic `tfsdk:"args"`
+		ArgStrs           types.Map     `tfsdk:"argstrs"`
+		Impure            types.Bool    `tfsdk:"impure"`
+		PureEval          types.Bool    `tfsdk:"pure_eval"`
+		AllowedURIs       types.List    `tfsdk:"allowed_uris"`
+		EvalEnv           types.Map     `tfsdk:"eval_env"`
+		InheritEnv        types.List    `tfsdk:"inherit_env"`
+		OverrideInputs    types.Map     `tfsdk:"override_inputs"`
+		OverrideRevisions types.Map     `tfsdk:"override_revisions"`
+		InputsFrom        types.String  `tfsdk:"inputs_from"`
+		LockFileMode      types.String  `tfsdk:"lock_file_mode"`
+		ReferenceLockFile types.String  `tfsdk:"reference_lock_file"`
+		OutputNames       types.List    `tfsdk:"output_names"`
+		DetectDrift       types.Bool    `tfsdk:"detect_drift"`
+		GCRoot            types.Bool    `tfsdk:"gc_root"`
+		GCRoots           types.Map     `tfsdk:"gc_roots"`
+		GCRootsExist      types.Bool    `tfsdk:"gc_roots_exist"`
+		Output            types.String  `tfsdk:"output_path"`
+		Outputs           types.Map     `tfsdk:"outputs"`
+		Derivation        types.String  `tfsdk:"drv_path"`
+		System            types.String  `tfsdk:"system"`
+
+		BuildOptions *resourceStorePathBuildOptionsModel `tfsdk:"build_options"`
+	}
+
+	resourceStorePathBuildOptionsModel struct {
+		MaxJobs        types.Int64  `tfsdk:"max_jobs"`
+		Cores          types.Int64  `tfsdk:"cores"`
+		KeepGoing      types.Bool   `tfsdk:"keep_going"`
+		Fallback       types.Bool   `tfsdk:"fallback"`
+		Timeout        types.Int64  `tfsdk:"timeout"`
+		MaxSilentTime  types.Int64  `tfsdk:"max_silent_time"`
+		Sandbox        types.Bool   `tfsdk:"sandbox"`
+		Substitute     types.Bool   `tfsdk:"substitute"`
+		System         types.String `tfsdk:"system"`
+		ExtraPlatforms types.List   `tfsdk:"extra_platforms"`
+		Builders       types.List   `tfsdk:"builders"`
 	}
 )
 
@@ -34,11 +82,99 @@ func (*resourceStorePath) Schema(_ context.Context, _ resource.SchemaRequest, re
 		Description: "Build any installable and exposes its store paths.",
 		Attributes: map[string]schema.Attribute{
 			"installable": schema.StringAttribute{
-				MarkdownDescription: "Nix installable (store path, nix packages, flake attribute, nix expressions, ...).",
-				Required:            true,
+				MarkdownDescription: "Nix installable (store path, nix packages, flake attribute, nix expressions, ...). When `expr` is provided, attribute path of the expression result to build, the whole result if not provided.",
+				Optional:            true,
+			},
+			"expr": schema.StringAttribute{
+				MarkdownDescription: "Nix expression to evaluate instead of a flake (like `import ./images.nix`). Nix evaluates expressions in pure mode: set `impure` to read files (like importing them) or the environment (like `builtins.currentSystem`).",
+				Optional:            true,
+			},
+			"args": schema.DynamicAttribute{
+				MarkdownDescription: "Arguments given by name to the evaluated expression if it is a function. Values are converted to nix values: objects and maps to attribute sets, lists, sets and tuples to lists.",
+				Optional:            true,
+			},
+			"argstrs": schema.MapAttribute{
+				MarkdownDescription: "String arguments given by name to the evaluated expression if it is a function.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"impure": schema.BoolAttribute{
+				MarkdownDescription: "Allow the evaluation to access the environment, like environment variables or files outside of the flake. Defaults to the provider `impure` attribute, the effective value is recorded so plans show when it changes.",
+				Optional:            true,
+				Computed:            true,
+			},
+			"pure_eval": schema.BoolAttribute{
+				MarkdownDescription: "Override the `pure-eval` nix setting, defaults to the provider `pure_eval` attribute.",
+				Optional:            true,
+			},
+			"allowed_uris": schema.ListAttribute{
+				MarkdownDescription: "URI prefixes the evaluation is allowed to fetch (`allowed-uris` nix setting), defaults to the provider `allowed_uris` attribute.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"eval_env": schema.MapAttribute{
+				MarkdownDescription: "Environment variables available to the evaluation (like `builtins.getEnv` with `impure`), derivation builds run in a clean environment and do not see them. Merged with the provider `eval_env` attribute.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"inherit_env": schema.ListAttribute{
+				MarkdownDescription: "Restrict the environment variables the evaluation inherits from the provider process to the listed ones, along with `PATH`, `HOME` and `NIX_*` variables that nix needs, defaults to the provider `inherit_env` attribute. An empty list starts from a clean environment, `eval_env` variables are always set.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"override_inputs": schema.MapAttribute{
+				MarkdownDescription: "Flake inputs to override, by input path (like `nixpkgs` or `home-manager/nixpkgs`), with the flake reference to use instead (like `github:me/nixpkgs/my-branch`). The lock file is not updated, the revisions the overridden inputs are locked to are in `override_revisions`.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"override_revisions": schema.MapAttribute{
+				MarkdownDescription: "Revision each input of `override_inputs` is locked to (like the commit `github:me/nixpkgs/my-branch` points to), by input path. Inputs without revision (like `path:` inputs) have their NAR hash instead.",
+				ElementType:         types.StringType,
+				Computed:            true,
+			},
+			"inputs_from": schema.StringAttribute{
+				MarkdownDescription: "Flake reference whose inputs are used to resolve flake references of the installable (like `nixpkgs` resolving to the nixpkgs input of this flake instead of the registry).",
+				Optional:            true,
+			},
+			"lock_file_mode": schema.StringAttribute{
+				MarkdownDescription: "How the lock file of the flake is handled, defaults to the provider `lock_file_mode` attribute. One of `strict` (the lock file must be up to date), `readonly` (missing inputs are locked without writing the lock file), `allow-write` (missing inputs are locked and the lock file is written), or `recreate` (every input is locked again, without writing the lock file).",
+				Optional:            true,
+			},
+			"reference_lock_file": schema.StringAttribute{
+				MarkdownDescription: "Path of a lock file to use instead of the lock file of the flake, defaults to the provider `reference_lock_file` attribute.",
+				Optional:            true,
+			},
+			"output_names": schema.ListAttribute{
+				MarkdownDescription: "Names of the derivation outputs to build (like `out` or `dev`), outputs nix builds by default are built if not provided.",
+				ElementType:         types.StringType,
+				Optional:            true,
+			},
+			"detect_drift": schema.BoolAttribute{
+				MarkdownDescription: "Whether to evaluate the installable while planning to detect it now evaluates to a different derivation (a flake input changed for instance), in which case the new derivation is built. When false, the built derivation is kept until the installable or the output names change. Defaults to true.",
+				Optional:            true,
+				Computed:            true,
+				Default:             booldefault.StaticBool(true),
+			},
+			"gc_root": schema.BoolAttribute{
+				MarkdownDescription: "Whether to protect built outputs from garbage collection as long as the resource exists, by registering indirect garbage collector roots in the provider `gc_root_dir`.",
+				Optional:            true,
+			},
+			"gc_roots": schema.MapAttribute{
+				MarkdownDescription: "Path of the garbage collector root of each built output, by output name.",
+				ElementType:         types.StringType,
+				Computed:            true,
+			},
+			"gc_roots_exist": schema.BoolAttribute{
+				MarkdownDescription: "Whether every garbage collector root of `gc_roots` still exists and protects its output, missing roots are created again on the next apply.",
+				Computed:            true,
 			},
 			"output_path": schema.StringAttribute{
-				MarkdownDescription: "Path to the derivation output.",
+				MarkdownDescription: "Path to the derivation output: the first of `output_names` if provided, `out` if it exists, or the first output by name.",
+				Computed:            true,
+			},
+			"outputs": schema.MapAttribute{
+				MarkdownDescription: "Path of each built derivation output, by output name.",
+				ElementType:         types.StringType,
 				Computed:            true,
 			},
 			"drv_path": schema.StringAttribute{
@@ -50,6 +186,98 @@ func (*resourceStorePath) Schema(_ context.Context, _ resource.SchemaRequest, re
 				Computed:            true,
 			},
 		},
+		Blocks: map[string]schema.Block{
+			"build_options": schema.SingleNestedBlock{
+				MarkdownDescription: "Tune how the installable is built, without changing the nix configuration. Options that are not set use the provider and nix configuration. Apart from `system`, changing them does not build the installable again.",
+				Attributes: map[string]schema.Attribute{
+					"max_jobs": schema.Int64Attribute{
+						MarkdownDescription: "Maximum number of builds run in parallel locally (`max-jobs` nix setting), 0 only builds on remote builders.",
+						Optional:            true,
+					},
+					"cores": schema.Int64Attribute{
+						MarkdownDescription: "Number of cores each build can use (`cores` nix setting), 0 uses all of them.",
+						Optional:            true,
+					},
+					"keep_going": schema.BoolAttribute{
+						MarkdownDescription: "Keep building other derivations when a build fails (`keep-going` nix setting).",
+						Optional:            true,
+					},
+					"fallback": schema.BoolAttribute{
+						MarkdownDescription: "Build derivations from source when their outputs cannot be fetched from substituters (`fallback` nix setting).",
+						Optional:            true,
+					},
+					"timeout": schema.Int64Attribute{
+						MarkdownDescription: "Maximum duration of a build in seconds (`timeout` nix setting), 0 means no limit.",
+						Optional:            true,
+					},
+					"max_silent_time": schema.Int64Attribute{
+						MarkdownDescription: "Maximum duration in seconds a build can run without writing logs (`max-silent-time` nix setting), 0 means no limit.",
+						Optional:            true,
+					},
+					"sandbox": schema.BoolAttribute{
+						MarkdownDescription: "Build derivations in a sandbox isolating them from the system (`sandbox` nix setting). Changing it requires to be a trusted user of the nix daemon.",
+						Optional:            true,
+					},
+					"substitute": schema.BoolAttribute{
+						MarkdownDescription: "Fetch outputs from substituters instead of building them when possible (`substitute` nix setting).",
+						Optional:            true,
+					},
+					"system": schema.StringAttribute{
+						MarkdownDescription: "System the installable is evaluated and built for (`system` nix setting, like `aarch64-linux`), defaults to the provider `system` attribute. " +
+							"Unlike other build options, changing it builds the installable again if it evaluates to another derivation.",
+						Optional: true,
+					},
+					"extra_platforms": schema.ListAttribute{
+						MarkdownDescription: "Systems, other than the local one, that can be built locally (`extra-platforms` nix setting), defaults to the provider `extra_platforms` attribute.",
+						ElementType:         types.StringType,
+						Optional:            true,
+					},
+					"builders": schema.ListNestedAttribute{
+						MarkdownDescription: "Remote machines the installable can be built on, defaults to the provider `builders` attribute. An empty list only builds locally.",
+						Optional:            true,
+						NestedObject: schema.NestedAttributeObject{
+							Attributes: map[string]schema.Attribute{
+								"uri": schema.StringAttribute{
+									MarkdownDescription: "URI of the machine store (like `ssh-ng://builder@aarch64.example.com`).",
+									Required:            true,
+								},
+								"systems": schema.ListAttribute{
+									MarkdownDescription: "Systems the machine builds for (like `aarch64-linux`), defaults to the local system.",
+									ElementType:         types.StringType,
+									Optional:            true,
+								},
+								"ssh_key": schema.StringAttribute{
+									MarkdownDescription: "Path of the ssh private key used to connect to the machine, ssh defaults are used if not provided.",
+									Optional:            true,
+								},
+								"max_jobs": schema.Int64Attribute{
+									MarkdownDescription: "Maximum number of builds run in parallel on the machine, defaults to 1.",
+									Optional:            true,
+								},
+								"speed_factor": schema.Int64Attribute{
+									MarkdownDescription: "Relative speed of the machine, faster machines are preferred, defaults to 1.",
+									Optional:            true,
+								},
+								"supported_features": schema.ListAttribute{
+									MarkdownDescription: "System features of the machine (like `kvm` or `big-parallel`).",
+									ElementType:         types.StringType,
+									Optional:            true,
+								},
+								"mandatory_features": schema.ListAttribute{
+									MarkdownDescription: "Features derivations have to require to be built on the machine.",
+									ElementType:         types.StringType,
+									Optional:            true,
+								},
+								"public_host_key": schema.StringAttribute{
+									MarkdownDescription: "Base64 encoded public host key of the machine, ssh known hosts are used if not provided.",
+									Optional:            true,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 }
 
@@ -58,16 +286,35 @@ func (r *resourceStorePath) Configure(_ context.Context, req resource.ConfigureR
 		return
 	}
 
-	n, ok := req.ProviderData.(nix.Nix)
+	data, ok := req.ProviderData.(*providerData)
 	if !ok {
 		resp.Diagnostics.AddError(
 			"Unexpected configure data type",
-			fmt.Sprintf("Expected nix implementation, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+			fmt.Sprintf("Expected provider data, got: %T. Please report this issue to the provider developers.", req.ProviderData),
 		)
 		return
 	}
 
-	r.nix = n
+	r.nix, r.evaluation, r.gcRootDir = data.Nix, data.evaluation, data.gcRootDir
+}
+
+func (m resourceStorePathModel) evaluationAttributes() evaluationAttributes {
+	return evaluationAttributes{
+		Expr:        m.Expr,
+		Args:        m.Args,
+		ArgStrs:     m.ArgStrs,
+		Impure:      m.Impure,
+		PureEval:    m.PureEval,
+		AllowedURIs: m.AllowedURIs,
+		EvalEnv:     m.EvalEnv,
+		InheritEnv:  m.InheritEnv,
+
+		OverrideInputs: m.OverrideInputs,
+		InputsFrom:     m.InputsFrom,
+
+		LockFileMode:      m.LockFileMode,
+		ReferenceLockFile: m.ReferenceLockFile,
+	}
 }
 
 func (r *resourceStorePath) buildInstallable(ctx context.Context, model *resourceStorePathModel, diags *diag.Diagnostics) {
@@ -75,28 +322,382 @@ func (r *resourceStorePath) buildInstallable(ctx context.Context, model *resourc
 		return
 	}
 
-	storePath, err := r.nix.Build(ctx, model.Installable.ValueString())
+	var outputNames []string
+	if diags.Append(model.OutputNames.ElementsAs(ctx, &outputNames, false)...); diags.HasError() {
+		return
+	}
+
+	options, _ := r.evaluationOptions(ctx, *model, diags)
+	buildOptions := model.BuildOptions.buildOptions(ctx, diags)
+	if diags.HasError() {
+		return
+	}
+
+	storePath, err := r.nix.Build(ctx, nix.BuildRequest{
+		EvaluationOptions: options,
+		Installable:       installableWithOutputs(model.Installable.ValueString(), outputNames),
+		Options:           buildOptions,
+	})
 	if err != nil {
-		diags.AddError("Unable to build derivation", err.Error())
+		addNixErrorDiagnostic(diags, "Unable to build derivation", err, evaluatedPath(options), path.Empty())
 		return
 	}
 
-	derivation, err := r.nix.DescribeDerivation(ctx, storePath.Derivation)
+	derivation, err := r.nix.DescribeDerivation(ctx, storePath.Derivation, nix.EvaluationOptions{})
 	if err != nil {
-		diags.AddError("Unable to describe derivation", err.Error())
+		addNixErrorDiagnostic(diags, "Unable to describe derivation", err, evaluatedPath(options), path.Empty())
 		return
 	}
 
+	outputs, output := selectOutputs(*storePath, outputNames, path.Root("output_names"), diags)
+	if diags.HasError() {
+		return
+	}
+
+	// revisions are locked at plan time, unless the plan did not know the evaluation options
+	if model.OverrideRevisions.IsUnknown() {
+		if model.OverrideRevisions = overrideRevisions(ctx, r.nix, model.Installable.ValueString(), options, diags); diags.HasError() {
+			return
+		}
+	}
+
+	model.Impure = types.BoolValue(options.Impure)
 	model.Derivation = types.StringValue(storePath.Derivation)
-	model.Output = types.StringValue(storePath.Output)
+	model.Output = types.StringValue(output)
+	model.Outputs = stringMapValue(outputs)
 	model.System = types.StringValue(derivation.System)
 }
 
+func (*resourceStorePath) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var model resourceStorePathModel
+	if resp.Diagnostics.Append(req.Config.Get(ctx, &model)...); resp.Diagnostics.HasError() {
+		return
+	}
+
+	validateEvaluationAttributes(model.Installable, model.evaluationAttributes(), &resp.Diagnostics)
+
+	if model.BuildOptions == nil {
+		return
+	}
+
+	nixBuilders(ctx, path.Root("build_options").AtName("builders"), model.BuildOptions.Builders, &resp.Diagnostics)
+	for _, option := range []struct {
+		name  string
+		value types.Int64
+	}{
+		{"max_jobs", model.BuildOptions.MaxJobs},
+		{"cores", model.BuildOptions.Cores},
+		{"timeout", model.BuildOptions.Timeout},
+		{"max_silent_time", model.BuildOptions.MaxSilentTime},
+	} {
+		if !option.value.IsNull() && !option.value.IsUnknown() && option.value.ValueInt64() < 0 {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("build_options").AtName(option.name),
+				"Invalid build option",
+				fmt.Sprintf("%s must be positive or 0, got %d.", option.name, option.value.ValueInt64()),
+			)
+		}
+	}
+}
+
+// buildOptions returns the options to build the installable with, the provider and nix configuration is used for options that are not set.
+func (m *resourceStorePathBuildOptionsModel) buildOptions(ctx context.Context, diags *diag.Diagnostics) nix.BuildOptions {
+	if m == nil {
+		return nix.BuildOptions{}
+	}
+
+	return nix.BuildOptions{
+		MaxJobs:        m.MaxJobs.ValueInt64Pointer(),
+		Cores:          m.Cores.ValueInt64Pointer(),
+		KeepGoing:      m.KeepGoing.ValueBoolPointer(),
+		Fallback:       m.Fallback.ValueBoolPointer(),
+		Timeout:        m.Timeout.ValueInt64Pointer(),
+		MaxSilentTime:  m.MaxSilentTime.ValueInt64Pointer(),
+		Sandbox:        m.Sandbox.ValueBoolPointer(),
+		Substitute:     m.Substitute.ValueBoolPointer(),
+		ExtraPlatforms: optionalStrings(ctx, m.ExtraPlatforms, diags),
+		Builders:       nixBuilders(ctx, path.Root("build_options").AtName("builders"), m.Builders, diags),
+	}
+}
+
+// system returns the system the installable is built for, null if the provider default is used.
+func (m *resourceStorePathBuildOptionsModel) system() types.String {
+	if m == nil {
+		return types.StringNull()
+	}
+	return m.System
+}
+
+// evaluationOptions returns the options to evaluate the installable of the model with, evaluating it for the build options system.
+// It returns false if the options are not known yet.
+func (r *resourceStorePath) evaluationOptions(ctx context.Context, model resourceStorePathModel, diags *diag.Diagnostics) (nix.EvaluationOptions, bool) {
+	options, known := evaluationOptions(ctx, r.evaluation, model.evaluationAttributes(), diags)
+
+	system := model.BuildOptions.system()
+	if system.IsUnknown() {
+		return options, false
+	}
+	options.System = system.ValueString()
+
+	return options, known
+}
+
+// ModifyPlan implements resource.ResourceWithModifyPlan for terraform plugin framework.
+// The installable is evaluated (but not built) to know the derivation and output paths at plan time.
+func (r *resourceStorePath) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	if req.Plan.Raw.IsNull() || r.nix == nil { // resource is destroyed, or provider is not configured yet
+		return
+	}
+
+	var plan resourceStorePathModel
+	if resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...); resp.Diagnostics.HasError() {
+		return
+	}
+
+	// without impure set, the provider default is used: it is resolved here, to show changes of the default in plans
+	var impure types.Bool
+	if resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("impure"), &impure)...); resp.Diagnostics.HasError() {
+		return
+	}
+	if impure.IsNull() {
+		plan.Impure = types.BoolValue(r.evaluation.Impure)
+		resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("impure"), plan.Impure)...)
+	}
+
+	if r.planGCRoots(ctx, &plan, req.State, resp); resp.Diagnostics.HasError() {
+		return
+	}
+
+	if plan.Installable.IsUnknown() || plan.OutputNames.IsUnknown() {
+		return
+	}
+
+	options, known := r.evaluationOptions(ctx, plan, &resp.Diagnostics)
+	if !known {
+		return
+	}
+
+	var state *resourceStorePathModel
+	if !req.State.Raw.IsNull() {
+		if resp.Diagnostics.Append(req.State.Get(ctx, &state)...); resp.Diagnostics.HasError() {
+			return
+		}
+
+		unchanged := plan.Installable.Equal(state.Installable) && plan.OutputNames.Equal(state.OutputNames) &&
+			plan.Expr.Equal(state.Expr) && plan.Args.Equal(state.Args) && plan.ArgStrs.Equal(state.ArgStrs) &&
+			plan.Impure.Equal(state.Impure) && plan.PureEval.Equal(state.PureEval) &&
+			plan.AllowedURIs.Equal(state.AllowedURIs) && plan.EvalEnv.Equal(state.EvalEnv) && plan.InheritEnv.Equal(state.InheritEnv) &&
+			plan.OverrideInputs.Equal(state.OverrideInputs) && plan.InputsFrom.Equal(state.InputsFrom) &&
+			plan.LockFileMode.Equal(state.LockFileMode) && plan.ReferenceLockFile.Equal(state.ReferenceLockFile) &&
+			plan.BuildOptions.system().Equal(state.BuildOptions.system())
+		if pinned := plan.DetectDrift.Equal(types.BoolValue(false)); unchanged && pinned {
+			plan.Derivation, plan.Output, plan.Outputs, plan.System = state.Derivation, state.Output, state.Outputs, state.System
+			plan.OverrideRevisions = state.OverrideRevisions
+			resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+			return
+		}
+
+		if !unchanged {
+			state = nil
+		}
+	}
+
+	var outputNames []string
+	if resp.Diagnostics.Append(plan.OutputNames.ElementsAs(ctx, &outputNames, false)...); resp.Diagnostics.HasError() {
+		return
+	}
+
+	derivation, outputs, output := r.describeInstallable(ctx, plan.Installable.ValueString(), options, outputNames, &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// the installable still evaluates to the built derivation, even if overridden inputs are locked to other revisions
+	if state != nil && state.Derivation.Equal(types.StringValue(derivation.Path.Derivation)) {
+		plan.Derivation, plan.Output, plan.Outputs, plan.System = state.Derivation, state.Output, state.Outputs, state.System
+		plan.OverrideRevisions = state.OverrideRevisions
+		resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+		return
+	}
+
+	if state != nil {
+		resp.Diagnostics.AddAttributeWarning(
+			path.Root("drv_path"),
+			"Installable evaluates to a different derivation",
+			fmt.Sprintf(
+				"Installable %s now evaluates to derivation %s instead of %s, the new derivation will be built. Set detect_drift to false to keep the built derivation until the installable changes.",
+				plan.Installable.ValueString(), derivation.Path.Derivation, state.Derivation.ValueString(),
+			),
+		)
+	}
+
+	r.warnBuildPlan(ctx, installableWithOutputs(plan.Installable.ValueString(), outputNames), options, &resp.Diagnostics)
+
+	if plan.OverrideRevisions = overrideRevisions(ctx, r.nix, plan.Installable.ValueString(), options, &resp.Diagnostics); resp.Diagnostics.HasError() {
+		return
+	}
+
+	plan.Derivation = types.StringValue(derivation.Path.Derivation)
+	plan.System = types.StringValue(derivation.System)
+
+	// without output names, nix only builds the outputs it installs by default which are only known once built for multiple outputs derivations,
+	// and content-addressed derivations outputs are only known once built
+	if outputsKnown := (!plan.OutputNames.IsNull() || len(outputs) == 1) && !slices.Contains(maps.Values(outputs), ""); outputsKnown {
+		plan.Output = types.StringValue(output)
+		plan.Outputs = stringMapValue(outputs)
+	} else {
+		plan.Output = types.StringUnknown()
+		plan.Outputs = types.MapUnknown(types.StringType)
+	}
+
+	resp.Diagnostics.Append(resp.Plan.Set(ctx, &plan)...)
+}
+
+// planGCRoots checks garbage collector roots can be created, and plans to create missing ones again.
+func (r *resourceStorePath) planGCRoots(ctx context.Context, plan *resourceStorePathModel, state tfsdk.State, resp *resource.ModifyPlanResponse) {
+	if !plan.GCRoot.ValueBool() {
+		return
+	}
+
+	if r.gcRootDir == "" {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("gc_root"),
+			"Missing garbage collector root directory",
+			"Garbage collector roots are created in the provider gc_root_dir attribute, which must be set to use gc_root.",
+		)
+		return
+	}
+
+	if state.Raw.IsNull() {
+		return
+	}
+
+	var rootsExist types.Bool
+	if resp.Diagnostics.Append(state.GetAttribute(ctx, path.Root("gc_roots_exist"), &rootsExist)...); resp.Diagnostics.HasError() {
+		return
+	}
+	if rootsExist.Equal(types.BoolValue(false)) {
+		plan.GCRoots, plan.GCRootsExist = types.MapUnknown(types.StringType), types.BoolValue(true)
+		resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("gc_roots"), plan.GCRoots)...)
+		resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("gc_roots_exist"), plan.GCRootsExist)...)
+	}
+}
+
+// describeInstallable evaluates the installable and returns its derivation and selected outputs, without building it.
+func (r *resourceStorePath) describeInstallable(ctx context.Context, installable string, options nix.EvaluationOptions, outputNames []string, diags *diag.Diagnostics) (*nix.Derivation, map[string]string, string) {
+	derivation, err := r.nix.DescribeDerivation(ctx, installable, options)
+	if err != nil {
+		addNixErrorDiagnostic(diags, "Unable to describe derivation", err, evaluatedPath(options), path.Empty())
+		return nil, nil, ""
+	}
+
+	outputs, output := selectOutputs(derivation.Path, outputNames, path.Root("output_names"), diags)
+	if diags.HasError() {
+		return nil, nil, ""
+	}
+
+	return derivation, outputs, output
+}
+
+// maxWarnedDerivations is the number of derivations to build listed by the build plan warning.
+const maxWarnedDerivations = 10
+
+// warnBuildPlan warns about what building the installable would do, for long builds to be noticed before applying.
+func (r *resourceStorePath) warnBuildPlan(ctx context.Context, installable string, options nix.EvaluationOptions, diags *diag.Diagnostics) {
+	plan, err := r.nix.PlanBuild(ctx, installable, options)
+	if err != nil {
+		tflog.Warn(ctx, "unable to plan build", map[string]any{"installable": installable, "error": err.Error()})
+		return
+	}
+
+	if len(plan.Derivations) == 0 && len(plan.Fetched) == 0 {
+		return
+	}
+
+	detail := fmt.Sprintf(
+		"Building the installable requires to build %d derivation(s), and to fetch %d store path(s) (%.2f MiB download, %.2f MiB unpacked).",
+		len(plan.Derivations), len(plan.Fetched), mebibytes(plan.DownloadSize), mebibytes(plan.UnpackedSize),
+	)
+	if len(plan.Derivations) > 0 {
+		derivations := plan.Derivations
+		if len(derivations) > maxWarnedDerivations {
+			derivations = append(slices.Clone(derivations[:maxWarnedDerivations]), fmt.Sprintf("and %d more", len(plan.Derivations)-maxWarnedDerivations))
+		}
+		detail += "\n\nDerivations to build:\n  " + strings.Join(derivations, "\n  ")
+	}
+
+	diags.AddAttributeWarning(path.Root("drv_path"), "Installable will be built", detail)
+}
+
+// mebibytes converts a size in bytes to MiB.
+func mebibytes(size int64) float64 {
+	return float64(size) / (1024 * 1024)
+}
+
+// manageGCRoots creates garbage collector roots for the model outputs if required, and removes previous roots that are not needed anymore.
+func (r *resourceStorePath) manageGCRoots(ctx context.Context, model *resourceStorePathModel, previousRoots types.Map, diags *diag.Diagnostics) {
+	if diags.HasError() {
+		return
+	}
+
+	var previous map[string]string
+	if diags.Append(previousRoots.ElementsAs(ctx, &previous, false)...); diags.HasError() {
+		return
+	}
+
+	roots := make(map[string]string)
+	if model.GCRoot.ValueBool() {
+		var outputs map[string]string
+		if diags.Append(model.Outputs.ElementsAs(ctx, &outputs, false)...); diags.HasError() {
+			return
+		}
+
+		for name, output := range outputs {
+			if root, exists := previous[name]; exists {
+				if stillValid, err := r.nix.GCRootExists(ctx, root, output); err == nil && stillValid {
+					roots[name] = root
+					continue
+				}
+			}
+
+			suffix := make([]byte, 4)
+			if _, err := rand.Read(suffix); err != nil {
+				diags.AddError("Unable to generate garbage collector root name", err.Error())
+				return
+			}
+
+			root, err := r.nix.AddGCRoot(ctx, fmt.Sprintf("%s-%x", filepath.Base(output), suffix), output)
+			if err != nil {
+				addNixErrorDiagnostic(diags, "Unable to add garbage collector root", err, path.Root("gc_root"), path.Empty())
+				return
+			}
+			roots[name] = root
+		}
+	}
+
+	for name, root := range previous {
+		if roots[name] == root {
+			continue
+		}
+		if err := r.nix.RemoveGCRoot(ctx, root); err != nil {
+			addNixErrorDiagnostic(diags, "Unable to remove garbage collector root", err, path.Root("gc_roots").AtMapKey(name), path.Empty())
+			return
+		}
+	}
+
+	if model.GCRoot.ValueBool() {
+		model.GCRoots, model.GCRootsExist = stringMapValue(roots), types.BoolValue(true)
+	} else {
+		model.GCRoots, model.GCRootsExist = types.MapNull(types.StringType), types.BoolNull()
+	}
+}
+
 func (r *resourceStorePath) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
 	var plan resourceStorePathModel
 	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
 
-	if r.buildInstallable(ctx, &plan, &resp.Diagnostics); resp.Diagnostics.HasError() {
+	r.buildInstallable(ctx, &plan, &resp.Diagnostics)
+	if r.manageGCRoots(ctx, &plan, types.MapNull(types.StringType), &resp.Diagnostics); resp.Diagnostics.HasError() {
 		return
 	}
 
@@ -107,58 +708,103 @@ func (r *resourceStorePath) Read(ctx context.Context, req resource.ReadRequest,
 	var state resourceStorePathModel
 	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
 
-	derivation, err := r.nix.DescribeDerivation(ctx, state.Installable.ValueString())
-	if err != nil {
-		resp.Diagnostics.AddError("Unable to describe derivation", err.Error())
-		return
+	// paths recorded in the state are checked, drift of the installable is detected while planning
+	paths := []string{state.Derivation.ValueString()}
+	for _, output := range state.Outputs.Elements() {
+		if output, ok := output.(types.String); ok {
+			paths = append(paths, output.ValueString())
+		}
 	}
+	if len(paths) == 1 {
+		paths = append(paths, state.Output.ValueString())
+	}
+	pathsExist := make([]bool, len(paths))
 
-	wp, ctx := errgroup.WithContext(ctx)
-	drvExists, outputExists := false, false
-
-	wp.Go(func() error {
-		var err error
-		drvExists, _, err = r.nix.GetStorePath(ctx, derivation.Path.Derivation)
-		return err
-	})
-
-	wp.Go(func() error {
-		var err error
-		outputExists, _, err = r.nix.GetStorePath(ctx, derivation.Path.Output)
-		return err
-	})
+	wp, wpCtx := errgroup.WithContext(ctx)
+	for i, p := range paths {
+		wp.Go(func() error {
+			var err error
+			pathsExist[i], _, err = r.nix.GetStorePath(wpCtx, p)
+			return err
+		})
+	}
 
 	if err := wp.Wait(); err != nil {
-		resp.Diagnostics.AddError("Unable to get build info", err.Error())
+		addNixErrorDiagnostic(&resp.Diagnostics, "Unable to get build info", err, path.Root("installable"), path.Empty())
 		return
 	}
 
-	if exists := drvExists && outputExists; !exists {
+	if slices.Contains(pathsExist, false) {
 		resp.State.RemoveResource(ctx)
 		return
 	}
 
-	state.Derivation = types.StringValue(derivation.Path.Derivation)
-	state.Output = types.StringValue(derivation.Path.Output)
-	state.System = types.StringValue(derivation.System)
+	if state.DetectDrift.IsNull() {
+		state.DetectDrift = types.BoolValue(true)
+	}
+	if state.Impure.IsNull() {
+		state.Impure = types.BoolValue(r.evaluation.Impure)
+	}
+
+	// missing garbage collector roots are reported by gc_roots_exist, so they are created again on update
+	if state.GCRoot.ValueBool() {
+		state.GCRootsExist = types.BoolValue(true)
+		for name, root := range state.GCRoots.Elements() {
+			root, ok := root.(types.String)
+			output, exists := state.Outputs.Elements()[name]
+			if !ok || !exists {
+				state.GCRootsExist = types.BoolValue(false)
+				break
+			}
+
+			rootExists, err := r.nix.GCRootExists(ctx, root.ValueString(), output.(types.String).ValueString())
+			if err != nil {
+				addNixErrorDiagnostic(&resp.Diagnostics, "Unable to check garbage collector root", err, path.Root("gc_roots").AtMapKey(name), path.Empty())
+				return
+			}
+			if !rootExists {
+				state.GCRootsExist = types.BoolValue(false)
+				break
+			}
+		}
+	}
 
 	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
 }
 
 func (r *resourceStorePath) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
-	var state resourceStorePathModel
+	var state, prior resourceStorePathModel
 	resp.Diagnostics.Append(req.Plan.Get(ctx, &state)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &prior)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// the installable changed but still evaluates to the same, already built, derivation outputs
+	if alreadyBuilt := !state.Outputs.IsUnknown() && state.Derivation.Equal(prior.Derivation) && state.Outputs.Equal(prior.Outputs); !alreadyBuilt {
+		r.buildInstallable(ctx, &state, &resp.Diagnostics)
+	}
 
-	if r.buildInstallable(ctx, &state, &resp.Diagnostics); resp.Diagnostics.HasError() {
+	if r.manageGCRoots(ctx, &state, prior.GCRoots, &resp.Diagnostics); resp.Diagnostics.HasError() {
 		return
 	}
 
 	resp.Diagnostics.Append(resp.State.Set(ctx, &state)...)
 }
 
-func (*resourceStorePath) Delete(_ context.Context, _ resource.DeleteRequest, resp *resource.DeleteResponse) {
-	resp.Diagnostics.AddWarning(
-		"Delete operation is a no-op for the nix provider.",
-		"Delete operation may have consequences out of the scope of this plan. Use nix-collect-garbage if needed.",
-	)
+func (r *resourceStorePath) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var state resourceStorePathModel
+	if resp.Diagnostics.Append(req.State.Get(ctx, &state)...); resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !state.GCRoot.ValueBool() {
+		resp.Diagnostics.AddWarning(
+			"Delete operation is a no-op for the nix provider.",
+			"Delete operation may have consequences out of the scope of this plan. Use nix-collect-garbage if needed.",
+		)
+	}
+
+	state.GCRoot = types.BoolValue(false)
+	r.manageGCRoots(ctx, &state, state.GCRoots, &resp.Diagnostics)
 }
@@ -5,11 +5,13 @@ import (
 	"fmt"
 
 	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 
 	"github.com/krostar/terraform-provider-nix/internal/nix"
 )
@@ -72,16 +74,16 @@ func (r *resourceStorePathCopy) Configure(_ context.Context, req resource.Config
 		return
 	}
 
-	n, ok := req.ProviderData.(nix.Nix)
+	data, ok := req.ProviderData.(*providerData)
 	if !ok {
 		resp.Diagnostics.AddError(
 			"Unexpected configure data type",
-			fmt.Sprintf("Expected nix implementation, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+			fmt.Sprintf("Expected provider data, got: %T. Please report this issue to the provider developers.", req.ProviderData),
 		)
 		return
 	}
 
-	r.nix = n
+	r.nix = data.Nix
 }
 
 func (r *resourceStorePathCopy) copyInstallable(ctx context.Context, model *resourceStorePathCopyModel, diags *diag.Diagnostics) {
@@ -100,7 +102,7 @@ func (r *resourceStorePathCopy) copyInstallable(ctx context.Context, model *reso
 		SubstituteOnDestination: model.SubstituteOnDestination.ValueBoolPointer(),
 		SSHOptions:              sshOptions,
 	}); err != nil {
-		diags.AddError("Unable to copy", err.Error())
+		addNixErrorDiagnostic(diags, "Unable to copy", err, path.Root("store_path"), path.Root("to"))
 		return
 	}
 }
@@ -125,17 +127,22 @@ func (r *resourceStorePathCopy) Read(ctx context.Context, req resource.ReadReque
 	var sshOptions []string
 	resp.Diagnostics.Append(state.SSHOptions.ElementsAs(ctx, &sshOptions, false)...)
 
-	exists, err := r.nix.RemoteStorePathExists(ctx, nix.RemoteStorePathExistsRequest{
+	pathInfo, err := r.nix.GetRemoteStorePath(ctx, nix.RemoteStorePathRequest{
 		Installable: state.StorePath.ValueString(),
 		Store:       state.To.ValueString(),
 		SSHOptions:  sshOptions,
 	})
 	if err != nil {
-		resp.Diagnostics.AddError("Unable to check if remote store path exists", err.Error())
+		addNixErrorDiagnostic(&resp.Diagnostics, "Unable to check if remote store path exists", err, path.Root("store_path"), path.Root("to"))
 		return
 	}
 
-	if !exists {
+	// the copy has to be done again if the store path, or any store path of its closure, is missing
+	if !pathInfo.Valid || !pathInfo.ClosureComplete {
+		tflog.Info(ctx, "store path closure is incomplete on destination store", map[string]any{
+			"store_path": pathInfo.Path,
+			"valid":      pathInfo.Valid,
+		})
 		resp.State.RemoveResource(ctx)
 		return
 	}
@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/plancheck"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix/fake"
+)
+
+func Test_resourceStorePathCopy(t *testing.T) {
+	n := fake.New()
+	hello := testDerivation("hello")
+	n.AddDerivation("nixpkgs#hello", hello)
+	n.AddRemoteStore("ssh://remote")
+
+	config := `
+resource "nix_store_path" "this" {
+  installable = "nixpkgs#hello"
+}
+
+resource "nix_store_path_copy" "this" {
+  store_path  = nix_store_path.this.output_path
+  to          = "ssh://remote"
+  ssh_options = ["-o StrictHostKeyChecking=no"]
+}
+`
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: config,
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("nix_store_path_copy.this", "store_path", hello.Path.Output),
+				testCheckStorePathExists(n, "ssh://remote", "nix_store_path_copy.this", "store_path", true),
+			),
+		}, {
+			Config: config,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{plancheck.ExpectEmptyPlan()},
+			},
+		}, {
+			PreConfig: func() { n.DeleteStorePath("ssh://remote", hello.Path.Output) },
+			Config:    config,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{plancheck.ExpectResourceAction("nix_store_path_copy.this", plancheck.ResourceActionCreate)},
+			},
+			Check: testCheckStorePathExists(n, "ssh://remote", "nix_store_path_copy.this", "store_path", true),
+		}},
+	})
+}
+
+func Test_resourceStorePathCopy_errors(t *testing.T) {
+	n := fake.New()
+	n.AddStorePath("", testStorePath("hello"))
+	n.AddRemoteStore("ssh://remote")
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: `
+resource "nix_store_path_copy" "this" {
+  store_path = "` + testStorePath("hello") + `"
+  to         = "ssh://unreachable"
+}
+`,
+			ExpectError: regexp.MustCompile(`Unable to copy: unable to connect to store`),
+		}, {
+			Config: `
+resource "nix_store_path_copy" "this" {
+  store_path = "` + testStorePath("missing") + `"
+  to         = "ssh://remote"
+}
+`,
+			ExpectError: regexp.MustCompile(`Unable to copy: store path .+-missing is missing`),
+		}},
+	})
+}
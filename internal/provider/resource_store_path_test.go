@@ -0,0 +1,693 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-testing/helper/resource"
+	"github.com/hashicorp/terraform-plugin-testing/knownvalue"
+	"github.com/hashicorp/terraform-plugin-testing/plancheck"
+	"github.com/hashicorp/terraform-plugin-testing/terraform"
+	"github.com/hashicorp/terraform-plugin-testing/tfjsonpath"
+
+	"github.com/krostar/terraform-provider-nix/internal/nix"
+	"github.com/krostar/terraform-provider-nix/internal/nix/fake"
+)
+
+func Test_resourceStorePath(t *testing.T) {
+	n := fake.New()
+	hello := testDerivation("hello")
+	n.AddDerivation("nixpkgs#hello", hello)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: `
+resource "nix_store_path" "this" {
+  installable = "nixpkgs#hello"
+}
+`,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{
+					plancheck.ExpectResourceAction("nix_store_path.this", plancheck.ResourceActionCreate),
+					plancheck.ExpectKnownValue("nix_store_path.this", tfjsonpath.New("drv_path"), knownvalue.StringExact(hello.Path.Derivation)),
+					plancheck.ExpectKnownValue("nix_store_path.this", tfjsonpath.New("output_path"), knownvalue.StringExact(hello.Path.Output)),
+					plancheck.ExpectKnownValue("nix_store_path.this", tfjsonpath.New("system"), knownvalue.StringExact("x86_64-linux")),
+				},
+			},
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("nix_store_path.this", "drv_path", hello.Path.Derivation),
+				resource.TestCheckResourceAttr("nix_store_path.this", "output_path", hello.Path.Output),
+				resource.TestCheckResourceAttr("nix_store_path.this", "outputs.%", "1"),
+				resource.TestCheckResourceAttr("nix_store_path.this", "outputs.out", hello.Path.Output),
+				resource.TestCheckResourceAttr("nix_store_path.this", "system", "x86_64-linux"),
+				resource.TestCheckResourceAttr("nix_store_path.this", "detect_drift", "true"),
+				resource.TestCheckNoResourceAttr("nix_store_path.this", "gc_roots"),
+				testCheckStorePathExists(n, "", "nix_store_path.this", "drv_path", true),
+				testCheckStorePathExists(n, "", "nix_store_path.this", "output_path", true),
+			),
+		}, {
+			Config: `
+resource "nix_store_path" "this" {
+  installable = "${"nixpkgs"}#${"hello"}"
+}
+`,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{plancheck.ExpectEmptyPlan()},
+			},
+		}},
+	})
+}
+
+func Test_resourceStorePath_outputNames(t *testing.T) {
+	n := fake.New()
+	openssl := testDerivation("openssl", "bin", "dev", "out", "man")
+	n.AddDerivation("nixpkgs#openssl", openssl)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: `
+resource "nix_store_path" "this" {
+  installable  = "nixpkgs#openssl"
+  output_names = ["dev", "out"]
+}
+`,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{
+					plancheck.ExpectKnownValue("nix_store_path.this", tfjsonpath.New("output_path"), knownvalue.StringExact(openssl.Path.Outputs["dev"])),
+				},
+			},
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("nix_store_path.this", "output_path", openssl.Path.Outputs["dev"]),
+				resource.TestCheckResourceAttr("nix_store_path.this", "outputs.%", "2"),
+				resource.TestCheckResourceAttr("nix_store_path.this", "outputs.dev", openssl.Path.Outputs["dev"]),
+				resource.TestCheckResourceAttr("nix_store_path.this", "outputs.out", openssl.Path.Outputs["out"]),
+				testCheckStorePathExists(n, "", "nix_store_path.this", "outputs.dev", true),
+				func(*terraform.State) error {
+					if n.StorePathExists("", openssl.Path.Outputs["man"]) {
+						return errors.New("man output should not be built")
+					}
+					return nil
+				},
+			),
+		}, {
+			Config: `
+resource "nix_store_path" "this" {
+  installable  = "nixpkgs#openssl"
+  output_names = ["doc"]
+}
+`,
+			ExpectError: regexp.MustCompile(`no\s+output\s+named\s+"doc"`),
+		}},
+	})
+}
+
+func Test_resourceStorePath_drift(t *testing.T) {
+	for _, detectDrift := range []bool{true, false} {
+		t.Run(fmt.Sprintf("detect_drift=%t", detectDrift), func(t *testing.T) {
+			n := fake.New()
+			hello := testDerivation("hello-2.12.1")
+			newHello := testDerivation("hello-2.12.2")
+			n.AddDerivation("nixpkgs#hello", hello)
+
+			config := fmt.Sprintf(`
+resource "nix_store_path" "this" {
+  installable  = "nixpkgs#hello"
+  detect_drift = %t
+}
+`, detectDrift)
+
+			expectedDerivation, expectedPlanCheck := hello.Path.Derivation, plancheck.ExpectEmptyPlan()
+			if detectDrift {
+				expectedDerivation, expectedPlanCheck = newHello.Path.Derivation, plancheck.ExpectResourceAction("nix_store_path.this", plancheck.ResourceActionUpdate)
+			}
+
+			resource.UnitTest(t, resource.TestCase{
+				ProtoV6ProviderFactories: testProviderFactories(n, nil),
+				Steps: []resource.TestStep{{
+					Config: config,
+					Check:  resource.TestCheckResourceAttr("nix_store_path.this", "drv_path", hello.Path.Derivation),
+				}, {
+					PreConfig: func() { n.AddDerivation("nixpkgs#hello", newHello) },
+					Config:    config,
+					ConfigPlanChecks: resource.ConfigPlanChecks{
+						PreApply: []plancheck.PlanCheck{expectedPlanCheck},
+					},
+					Check: resource.ComposeAggregateTestCheckFunc(
+						resource.TestCheckResourceAttr("nix_store_path.this", "drv_path", expectedDerivation),
+						testCheckStorePathExists(n, "", "nix_store_path.this", "output_path", true),
+					),
+				}},
+			})
+		})
+	}
+}
+
+func Test_resourceStorePath_garbageCollected(t *testing.T) {
+	n := fake.New()
+	hello := testDerivation("hello")
+	n.AddDerivation("nixpkgs#hello", hello)
+
+	config := `
+resource "nix_store_path" "this" {
+  installable = "nixpkgs#hello"
+}
+`
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: config,
+		}, {
+			PreConfig: func() { n.DeleteStorePath("", hello.Path.Output) },
+			Config:    config,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{plancheck.ExpectResourceAction("nix_store_path.this", plancheck.ResourceActionCreate)},
+			},
+			Check: testCheckStorePathExists(n, "", "nix_store_path.this", "output_path", true),
+		}},
+	})
+}
+
+func Test_resourceStorePath_gcRoot(t *testing.T) {
+	n := fake.New()
+	hello := testDerivation("hello")
+	n.AddDerivation("nixpkgs#hello", hello)
+
+	checkGCRoots := func(expected int) resource.TestCheckFunc {
+		return func(*terraform.State) error {
+			if roots := n.GCRoots(); len(roots) != expected {
+				return fmt.Errorf("expected %d garbage collector roots, got %v", expected, roots)
+			}
+			return nil
+		}
+	}
+
+	config := func(gcRoot bool) string {
+		return fmt.Sprintf(`
+provider "nix" {
+  gc_root_dir = %q
+}
+
+resource "nix_store_path" "this" {
+  installable = "nixpkgs#hello"
+  gc_root     = %t
+}
+`, fake.GCRootDir, gcRoot)
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		CheckDestroy:             checkGCRoots(0),
+		Steps: []resource.TestStep{{
+			Config: config(true),
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestMatchResourceAttr("nix_store_path.this", "gc_roots.out", regexp.MustCompile("^"+fake.GCRootDir+"/")),
+				checkGCRoots(1),
+			),
+		}, {
+			PreConfig: func() {
+				for root := range n.GCRoots() {
+					_ = n.RemoveGCRoot(context.Background(), root)
+				}
+			},
+			Config: config(true),
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{plancheck.ExpectResourceAction("nix_store_path.this", plancheck.ResourceActionUpdate)},
+			},
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("nix_store_path.this", "gc_root", "true"),
+				resource.TestCheckResourceAttr("nix_store_path.this", "gc_roots_exist", "true"),
+				checkGCRoots(1),
+			),
+		}, {
+			Config: config(true),
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{plancheck.ExpectEmptyPlan()},
+			},
+		}, {
+			Config: config(false),
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckNoResourceAttr("nix_store_path.this", "gc_roots"),
+				checkGCRoots(0),
+			),
+		}, {
+			Config: config(true),
+			Check:  checkGCRoots(1),
+		}},
+	})
+}
+
+func Test_resourceStorePath_gcRootWithoutDirectory(t *testing.T) {
+	n := fake.New()
+	n.AddDerivation("nixpkgs#hello", testDerivation("hello"))
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: `
+resource "nix_store_path" "this" {
+  installable = "nixpkgs#hello"
+  gc_root     = true
+}
+`,
+			PlanOnly:    true,
+			ExpectError: regexp.MustCompile(`Missing garbage collector root directory`),
+		}},
+	})
+}
+
+func Test_resourceStorePath_errors(t *testing.T) {
+	n := fake.New()
+	n.AddDerivation("nixpkgs#hello", testDerivation("hello"))
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: `
+resource "nix_store_path" "this" {
+  installable = "nixpkgs#does-not-exist"
+}
+`,
+			ExpectError: regexp.MustCompile(`(?s)Unable to describe derivation: evaluation failed.*does-not-exist`),
+		}, {
+			PreConfig: func() {
+				n.SetError("Build", &nix.BuildError{
+					Message:    "builder failed with exit code 1",
+					Derivation: "/nix/store/aaa-hello.drv",
+					LogTail:    []string{"make: *** [Makefile:42: all] Error 1"},
+				})
+			},
+			Config: `
+resource "nix_store_path" "this" {
+  installable = "nixpkgs#hello"
+}
+`,
+			ExpectError: regexp.MustCompile(`(?s)build of /nix/store/aaa-hello.drv failed.*Makefile:42`),
+		}},
+	})
+}
+
+func Test_resourceStorePath_expr(t *testing.T) {
+	n := fake.New()
+	small, large := testDerivation("image-small"), testDerivation("image-large")
+	n.AddDerivationWithOptions("", nix.EvaluationOptions{
+		Expression: "import ./image.nix",
+		Args:       map[string]string{"size": "1", "ips": `[ "10.0.0.1" ]`},
+	}, small)
+	n.AddDerivationWithOptions("", nix.EvaluationOptions{
+		Expression: "import ./image.nix",
+		Args:       map[string]string{"size": "4", "ips": `[ "10.0.0.1" ]`},
+	}, large)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: `
+resource "nix_store_path" "this" {
+  output_names = ["out"]
+}
+`,
+			ExpectError: regexp.MustCompile(`One of installable or expr must be provided`),
+		}, {
+			Config: `
+resource "nix_store_path" "this" {
+  expr = "import ./image.nix"
+  args = {
+    size = 1
+    ips  = ["10.0.0.1"]
+  }
+}
+`,
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("nix_store_path.this", "drv_path", small.Path.Derivation),
+				resource.TestCheckResourceAttr("nix_store_path.this", "output_path", small.Path.Output),
+				resource.TestCheckNoResourceAttr("nix_store_path.this", "installable"),
+				testCheckStorePathExists(n, "", "nix_store_path.this", "output_path", true),
+			),
+		}, {
+			Config: `
+resource "nix_store_path" "this" {
+  expr = "import ./image.nix"
+  args = {
+    size = 4
+    ips  = ["10.0.0.1"]
+  }
+}
+`,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{
+					plancheck.ExpectResourceAction("nix_store_path.this", plancheck.ResourceActionUpdate),
+					plancheck.ExpectKnownValue("nix_store_path.this", tfjsonpath.New("drv_path"), knownvalue.StringExact(large.Path.Derivation)),
+				},
+			},
+			Check: resource.TestCheckResourceAttr("nix_store_path.this", "output_path", large.Path.Output),
+		}},
+	})
+}
+
+func Test_resourceStorePath_impure(t *testing.T) {
+	n := fake.New()
+	pure, impure := testDerivation("image"), testDerivation("image-42")
+	n.AddDerivation(".#image", pure)
+	n.AddDerivationWithOptions(".#image", nix.EvaluationOptions{
+		Impure: true,
+		Env:    map[string]string{"BUILD_ID": "42"},
+	}, impure)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: `
+resource "nix_store_path" "this" {
+  installable  = ".#image"
+  detect_drift = false
+}
+`,
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("nix_store_path.this", "impure", "false"),
+				resource.TestCheckResourceAttr("nix_store_path.this", "drv_path", pure.Path.Derivation),
+			),
+		}, {
+			Config: `
+provider "nix" {
+  impure   = true
+  eval_env = { BUILD_ID = "42" }
+}
+
+resource "nix_store_path" "this" {
+  installable  = ".#image"
+  detect_drift = false
+}
+`,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{
+					plancheck.ExpectResourceAction("nix_store_path.this", plancheck.ResourceActionUpdate),
+					plancheck.ExpectKnownValue("nix_store_path.this", tfjsonpath.New("impure"), knownvalue.Bool(true)),
+					plancheck.ExpectKnownValue("nix_store_path.this", tfjsonpath.New("drv_path"), knownvalue.StringExact(impure.Path.Derivation)),
+				},
+			},
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("nix_store_path.this", "output_path", impure.Path.Output),
+				testCheckStorePathExists(n, "", "nix_store_path.this", "output_path", true),
+			),
+		}, {
+			Config: `
+resource "nix_store_path" "this" {
+  installable  = ".#image"
+  detect_drift = false
+  impure       = true
+  eval_env     = { BUILD_ID = "42" }
+}
+`,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{
+					plancheck.ExpectKnownValue("nix_store_path.this", tfjsonpath.New("drv_path"), knownvalue.StringExact(impure.Path.Derivation)),
+				},
+			},
+			Check: resource.TestCheckResourceAttr("nix_store_path.this", "impure", "true"),
+		}},
+	})
+}
+
+func Test_resourceStorePath_overrideInputs(t *testing.T) {
+	n := fake.New()
+	overridden := nix.EvaluationOptions{OverrideInputs: map[string]string{"nixpkgs": "github:me/nixpkgs/fix-hello"}}
+	upstream, fork, forkUpdate := testDerivation("hello-2.12.1"), testDerivation("hello-2.12.2"), testDerivation("hello-2.12.3")
+	n.AddDerivation(".#hello", upstream)
+	n.AddDerivationWithOptions(".#hello", overridden, fork)
+	n.AddFlakeWithOptions(".", overridden, nix.FlakeMetadata{Inputs: map[string]nix.FlakeInput{"nixpkgs": {Revision: "0123abcd"}}})
+
+	config := func(detectDrift bool) string {
+		return fmt.Sprintf(`
+resource "nix_store_path" "this" {
+  installable     = ".#hello"
+  detect_drift    = %t
+  override_inputs = { nixpkgs = "github:me/nixpkgs/fix-hello" }
+}
+`, detectDrift)
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: `
+resource "nix_store_path" "this" {
+  installable  = ".#hello"
+  detect_drift = false
+}
+`,
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("nix_store_path.this", "drv_path", upstream.Path.Derivation),
+				resource.TestCheckNoResourceAttr("nix_store_path.this", "override_revisions"),
+			),
+		}, {
+			Config: config(false),
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{
+					plancheck.ExpectResourceAction("nix_store_path.this", plancheck.ResourceActionUpdate),
+					plancheck.ExpectKnownValue("nix_store_path.this", tfjsonpath.New("drv_path"), knownvalue.StringExact(fork.Path.Derivation)),
+					plancheck.ExpectKnownValue("nix_store_path.this", tfjsonpath.New("override_revisions"), knownvalue.MapExact(map[string]knownvalue.Check{
+						"nixpkgs": knownvalue.StringExact("0123abcd"),
+					})),
+				},
+			},
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("nix_store_path.this", "override_inputs.nixpkgs", "github:me/nixpkgs/fix-hello"),
+				resource.TestCheckResourceAttr("nix_store_path.this", "override_revisions.nixpkgs", "0123abcd"),
+				testCheckStorePathExists(n, "", "nix_store_path.this", "output_path", true),
+			),
+		}, {
+			// the branch of the overridden input moved, without changing the derivation: the built revision is kept
+			PreConfig: func() {
+				n.AddFlakeWithOptions(".", overridden, nix.FlakeMetadata{Inputs: map[string]nix.FlakeInput{"nixpkgs": {Revision: "4567cdef"}}})
+			},
+			Config: config(true),
+			Check:  resource.TestCheckResourceAttr("nix_store_path.this", "override_revisions.nixpkgs", "0123abcd"),
+		}, {
+			PreConfig: func() {
+				n.AddDerivationWithOptions(".#hello", overridden, forkUpdate)
+			},
+			Config: config(true),
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{
+					plancheck.ExpectKnownValue("nix_store_path.this", tfjsonpath.New("drv_path"), knownvalue.StringExact(forkUpdate.Path.Derivation)),
+					plancheck.ExpectKnownValue("nix_store_path.this", tfjsonpath.New("override_revisions"), knownvalue.MapExact(map[string]knownvalue.Check{
+						"nixpkgs": knownvalue.StringExact("4567cdef"),
+					})),
+				},
+			},
+			Check: resource.TestCheckResourceAttr("nix_store_path.this", "override_revisions.nixpkgs", "4567cdef"),
+		}},
+	})
+}
+
+func Test_resourceStorePath_buildPlan(t *testing.T) {
+	n := fake.New()
+	hello := testDerivation("hello")
+	n.AddDerivation("nixpkgs#hello", hello)
+	n.SetError("PlanBuild", &nix.EvaluationError{Message: "unable to query substituters"})
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			// build plans only inform, failing to plan the build does not prevent to build
+			Config: `
+resource "nix_store_path" "this" {
+  installable = "nixpkgs#hello"
+}
+`,
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("nix_store_path.this", "output_path", hello.Path.Output),
+				func(*terraform.State) error {
+					if n.Calls("PlanBuild") == 0 {
+						return errors.New("expected the build to be planned")
+					}
+					return nil
+				},
+			),
+		}},
+	})
+}
+
+func Test_resourceStorePath_buildOptions(t *testing.T) {
+	n := fake.New()
+	hello := testDerivation("hello")
+	n.AddDerivation("nixpkgs#hello", hello)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: `
+resource "nix_store_path" "this" {
+  installable = "nixpkgs#hello"
+
+  build_options {
+    max_jobs = -1
+  }
+}
+`,
+			ExpectError: regexp.MustCompile(`max_jobs must be positive or 0, got -1`),
+		}, {
+			Config: `
+resource "nix_store_path" "this" {
+  installable = "nixpkgs#hello"
+
+  build_options {
+    max_jobs   = 0
+    keep_going = true
+    timeout    = 3600
+  }
+}
+`,
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("nix_store_path.this", "build_options.max_jobs", "0"),
+				resource.TestCheckResourceAttr("nix_store_path.this", "build_options.keep_going", "true"),
+				resource.TestCheckResourceAttr("nix_store_path.this", "output_path", hello.Path.Output),
+				func(*terraform.State) error {
+					maxJobs, keepGoing, timeout := int64(0), true, int64(3600)
+					expected := []nix.BuildRequest{{
+						Installable: "nixpkgs#hello",
+						Options:     nix.BuildOptions{MaxJobs: &maxJobs, KeepGoing: &keepGoing, Timeout: &timeout},
+					}}
+					if builds := n.BuildRequests(); !reflect.DeepEqual(builds, expected) {
+						return fmt.Errorf("expected build requests %+v, got %+v", expected, builds)
+					}
+					return nil
+				},
+			),
+		}, {
+			// build options do not change what is built
+			Config: `
+resource "nix_store_path" "this" {
+  installable = "nixpkgs#hello"
+
+  build_options {
+    cores = 2
+  }
+}
+`,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{
+					plancheck.ExpectResourceAction("nix_store_path.this", plancheck.ResourceActionUpdate),
+					plancheck.ExpectKnownValue("nix_store_path.this", tfjsonpath.New("drv_path"), knownvalue.StringExact(hello.Path.Derivation)),
+				},
+			},
+			Check: func(*terraform.State) error {
+				if calls := n.Calls("Build"); calls != 1 {
+					return fmt.Errorf("expected the installable to be built once, built %d times", calls)
+				}
+				return nil
+			},
+		}},
+	})
+}
+
+func Test_resourceStorePath_builders(t *testing.T) {
+	n := fake.New()
+	image, armImage := testDerivation("image"), testDerivation("image-aarch64")
+	armImage.System = "aarch64-linux"
+	n.AddDerivation(".#image", image)
+	n.AddDerivationWithOptions(".#image", nix.EvaluationOptions{System: "aarch64-linux"}, armImage)
+
+	resource.UnitTest(t, resource.TestCase{
+		ProtoV6ProviderFactories: testProviderFactories(n, nil),
+		Steps: []resource.TestStep{{
+			Config: `
+resource "nix_store_path" "this" {
+  installable = ".#image"
+
+  build_options {
+    builders = [{ uri = "ssh://builder", systems = ["aarch64-linux x86_64-linux"] }]
+  }
+}
+`,
+			ExpectError: regexp.MustCompile(`systems cannot contain spaces, commas, nor semicolons`),
+		}, {
+			Config: `
+resource "nix_store_path" "this" {
+  installable = ".#image"
+
+  build_options {
+    system = "aarch64-linux"
+    builders = [{
+      uri      = "ssh-ng://builder@aarch64.example.com"
+      systems  = ["aarch64-linux"]
+      max_jobs = 4
+    }]
+  }
+}
+`,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{
+					plancheck.ExpectKnownValue("nix_store_path.this", tfjsonpath.New("drv_path"), knownvalue.StringExact(armImage.Path.Derivation)),
+				},
+			},
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("nix_store_path.this", "system", "aarch64-linux"),
+				resource.TestCheckResourceAttr("nix_store_path.this", "output_path", armImage.Path.Output),
+				func(*terraform.State) error {
+					expected := []nix.BuildRequest{{
+						EvaluationOptions: nix.EvaluationOptions{System: "aarch64-linux"},
+						Installable:       ".#image",
+						Options: nix.BuildOptions{Builders: []nix.Builder{{
+							URI:     "ssh-ng://builder@aarch64.example.com",
+							Systems: []string{"aarch64-linux"},
+							MaxJobs: 4,
+						}}},
+					}}
+					if builds := n.BuildRequests(); !reflect.DeepEqual(builds, expected) {
+						return fmt.Errorf("expected build requests %+v, got %+v", expected, builds)
+					}
+					return nil
+				},
+			),
+		}, {
+			// builders do not change what is built
+			Config: `
+resource "nix_store_path" "this" {
+  installable = ".#image"
+
+  build_options {
+    system          = "aarch64-linux"
+    extra_platforms = ["aarch64-linux"]
+    builders        = []
+  }
+}
+`,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{
+					plancheck.ExpectResourceAction("nix_store_path.this", plancheck.ResourceActionUpdate),
+					plancheck.ExpectKnownValue("nix_store_path.this", tfjsonpath.New("drv_path"), knownvalue.StringExact(armImage.Path.Derivation)),
+				},
+			},
+			Check: func(*terraform.State) error {
+				if calls := n.Calls("Build"); calls != 1 {
+					return fmt.Errorf("expected the installable to be built once, built %d times", calls)
+				}
+				return nil
+			},
+		}, {
+			// the system does
+			Config: `
+resource "nix_store_path" "this" {
+  installable = ".#image"
+}
+`,
+			ConfigPlanChecks: resource.ConfigPlanChecks{
+				PreApply: []plancheck.PlanCheck{
+					plancheck.ExpectKnownValue("nix_store_path.this", tfjsonpath.New("drv_path"), knownvalue.StringExact(image.Path.Derivation)),
+				},
+			},
+			Check: resource.ComposeAggregateTestCheckFunc(
+				resource.TestCheckResourceAttr("nix_store_path.this", "output_path", image.Path.Output),
+				resource.TestCheckResourceAttr("nix_store_path.this", "system", image.System),
+			),
+		}},
+	})
+}
@@ -0,0 +1,46 @@
+# Self-contained flake used by acceptance tests: it has no inputs, and its derivations
+# are built with the sandbox shell, so it can be evaluated and built offline.
+{
+  outputs = {self}: let
+    systems = ["aarch64-darwin" "aarch64-linux" "x86_64-darwin" "x86_64-linux"];
+    forEachSystem = f: builtins.listToAttrs (builtins.map (system: {
+        name = system;
+        value = f system;
+      })
+      systems);
+    version = builtins.replaceStrings ["\n"] [""] (builtins.readFile ./version);
+  in {
+    lib = {
+      inherit version;
+      greeting = {
+        message = "hello";
+        names = ["world" "nix"];
+      };
+    };
+
+    packages = forEachSystem (system: rec {
+      hello = builtins.derivation {
+        inherit system;
+        name = "hello-${version}";
+        builder = "/bin/sh";
+        args = ["-c" "echo hello ${version} > $out"];
+      };
+
+      # references hello, so its closure has two store paths
+      greeter = builtins.derivation {
+        inherit system;
+        name = "greeter-${version}";
+        builder = "/bin/sh";
+        args = ["-c" "echo ${hello} > $out"];
+      };
+
+      multi = builtins.derivation {
+        inherit system;
+        name = "multi-${version}";
+        outputs = ["out" "dev" "doc"];
+        builder = "/bin/sh";
+        args = ["-c" "echo out > $out; echo dev > $dev; echo doc > $doc"];
+      };
+    });
+  };
+}
@@ -0,0 +1,42 @@
+package provider
+
+import (
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// stringMapValue converts values, like derivation outputs, to a terraform map value, an empty map if values is nil.
+func stringMapValue(values map[string]string) types.Map {
+	elements := make(map[string]attr.Value, len(values))
+	for key, value := range values {
+		elements[key] = types.StringValue(value)
+	}
+	return types.MapValueMust(types.StringType, elements)
+}
+
+// stringsValue converts values to a terraform list value, an empty list if values is nil.
+func stringsValue(values []string) types.List {
+	elements := make([]attr.Value, 0, len(values))
+	for _, value := range values {
+		elements = append(elements, types.StringValue(value))
+	}
+	return types.ListValueMust(types.StringType, elements)
+}
+
+// optionalStringValue returns a null string if s is empty.
+func optionalStringValue(s string) types.String {
+	if s == "" {
+		return types.StringNull()
+	}
+	return types.StringValue(s)
+}
+
+// timestampValue returns the unix time in RFC3339 format, or a null string if the time is unknown.
+func timestampValue(unix int64) types.String {
+	if unix <= 0 {
+		return types.StringNull()
+	}
+	return types.StringValue(time.Unix(unix, 0).UTC().Format(time.RFC3339))
+}